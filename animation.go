@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/stewi1014/glfractal/programs"
+)
+
+// Curve shapes how a parameter moves from one keyframe to the next.
+type Curve int
+
+const (
+	CurveLinear Curve = iota
+	CurveEase
+	CurveEaseIn
+	CurveEaseOut
+	CurveStep
+)
+
+var curveNames = []string{"Linear", "Ease", "Ease In", "Ease Out", "Step"}
+
+func (c Curve) String() string { return curveNames[c] }
+
+func (c Curve) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+func (c *Curve) UnmarshalText(b []byte) error {
+	i, err := parseEnum(curveNames, string(b))
+	*c = Curve(i)
+	return err
+}
+
+// apply maps t, the fraction of time between two keyframes, to the fraction of the change made.
+func (c Curve) apply(t float64) float64 {
+	switch c {
+	case CurveEase:
+		return t * t * (3 - 2*t)
+	case CurveEaseIn:
+		return t * t
+	case CurveEaseOut:
+		return 1 - (1-t)*(1-t)
+	case CurveStep:
+		return 0
+	default:
+		return t
+	}
+}
+
+// animatedParameters names each parameter given its own curve.
+// Zoom is always interpolated logarithmically, with its curve applied on top.
+var animatedParameters = []string{
+	"Zoom",
+	"Position",
+	"Camera",
+	"Iterations",
+	"Slider 0",
+	"Slider 1",
+	"Slider 2",
+	"Slider 3",
+	"Slider 4",
+	"Julia C",
+	"Roots",
+	"Bailout",
+	"Empty Colour",
+	"Colour Pallet",
+	"Pallet Scale",
+	"Pallet Offset",
+	"Flame",
+}
+
+func defaultCurves() map[string]Curve {
+	curves := make(map[string]Curve)
+	for _, name := range animatedParameters {
+		curves[name] = CurveLinear
+	}
+	curves["Position"] = CurveEase
+	curves["Camera"] = CurveEase
+	return curves
+}
+
+// Keyframe is a complete view of the fractal at a point in time.
+type Keyframe struct {
+	Time     float64 // seconds from the start of the animation
+	Program  string
+	Uniforms programs.Uniforms
+}
+
+// Animation is a timeline of keyframes, sorted by time.
+// Frames between keyframes are interpolated using the curve for each parameter.
+type Animation struct {
+	FPS       float64
+	Curves    map[string]Curve
+	Keyframes []Keyframe
+}
+
+func NewAnimation() *Animation {
+	return &Animation{
+		FPS:    30,
+		Curves: defaultCurves(),
+	}
+}
+
+// LoadAnimation reads an animation saved by Save.
+func LoadAnimation(name string) (*Animation, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	a := NewAnimation()
+	if err := json.Unmarshal(b, a); err != nil {
+		return nil, fmt.Errorf("%v: %w", name, err)
+	}
+
+	for i, k := range a.Keyframes {
+		program, ok := programs.ProgramByName(k.Program)
+		if !ok {
+			return nil, fmt.Errorf("%v: keyframe at %vs uses unknown program %q", name, k.Time, k.Program)
+		}
+		// saved before pallets could be scaled
+		if k.Uniforms.PalletScale == 0 {
+			a.Keyframes[i].Uniforms.PalletScale = 1
+		}
+		// saved before the bailout could be changed
+		if k.Uniforms.Bailout == 0 {
+			a.Keyframes[i].Uniforms.SetBailout(program.DefaultBailout())
+		}
+		// saved before density programs
+		if k.Uniforms.DensitySamples == 0 {
+			a.Keyframes[i].Uniforms.DensitySamples = programs.DefaultDensitySamples
+		}
+		// saved before 3D programs had a camera
+		if k.Uniforms.FieldOfView == 0 && program.Is3D() {
+			a.Keyframes[i].Uniforms.SetCamera3D(program.Camera3D)
+		}
+	}
+	if a.FPS <= 0 {
+		return nil, fmt.Errorf("%v: frame rate must be positive, not %v", name, a.FPS)
+	}
+
+	a.sort()
+	return a, nil
+}
+
+// Save writes the animation as JSON.
+func (a *Animation) Save(name string) error {
+	b, err := json.MarshalIndent(a, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, b, 0o644)
+}
+
+func (a *Animation) sort() {
+	slices.SortStableFunc(a.Keyframes, func(i, j Keyframe) int {
+		switch {
+		case i.Time < j.Time:
+			return -1
+		case i.Time > j.Time:
+			return 1
+		default:
+			return 0
+		}
+	})
+}
+
+// Add inserts k, keeping the keyframes sorted, and returns its index.
+func (a *Animation) Add(k Keyframe) int {
+	i := sort.Search(len(a.Keyframes), func(i int) bool {
+		return a.Keyframes[i].Time > k.Time
+	})
+	a.Keyframes = slices.Insert(a.Keyframes, i, k)
+	return i
+}
+
+// Remove deletes the keyframe at index i.
+func (a *Animation) Remove(i int) {
+	a.Keyframes = slices.Delete(a.Keyframes, i, i+1)
+}
+
+// SetTime moves the keyframe at index i to time t, returning its new index.
+func (a *Animation) SetTime(i int, t float64) int {
+	k := a.Keyframes[i]
+	a.Remove(i)
+	k.Time = t
+	return a.Add(k)
+}
+
+// Duration returns the time of the last keyframe.
+func (a *Animation) Duration() float64 {
+	if len(a.Keyframes) == 0 {
+		return 0
+	}
+	return a.Keyframes[len(a.Keyframes)-1].Time
+}
+
+// Frames returns the number of frames in the animation, including both ends.
+func (a *Animation) Frames() int {
+	if len(a.Keyframes) == 0 {
+		return 0
+	}
+	return int(a.Duration()*a.FPS) + 1
+}
+
+func (a *Animation) curve(name string) Curve {
+	if c, ok := a.Curves[name]; ok {
+		return c
+	}
+	return CurveLinear
+}
+
+// At returns the view at time t, interpolated between the surrounding keyframes.
+// Times outside the animation hold the first or last keyframe.
+// The program switches when its keyframe is reached.
+func (a *Animation) At(t float64) Keyframe {
+	if len(a.Keyframes) == 0 {
+		return Keyframe{Time: t}
+	}
+
+	next := sort.Search(len(a.Keyframes), func(i int) bool {
+		return a.Keyframes[i].Time > t
+	})
+	if next == 0 || next == len(a.Keyframes) {
+		k := a.Keyframes[max(next-1, 0)]
+		k.Time = t
+		return k
+	}
+
+	from, to := a.Keyframes[next-1], a.Keyframes[next]
+	u := (t - from.Time) / (to.Time - from.Time)
+	f := func(name string) float64 {
+		return a.curve(name).apply(u)
+	}
+	lerp := func(a, b, t float64) float64 {
+		return a + (b-a)*t
+	}
+
+	k := Keyframe{
+		Time:     t,
+		Program:  from.Program,
+		Uniforms: from.Uniforms,
+	}
+	uniforms, fu, tu := &k.Uniforms, &from.Uniforms, &to.Uniforms
+
+	uniforms.Zoom = math.Exp(lerp(math.Log(fu.Zoom), math.Log(tu.Zoom), f("Zoom")))
+
+	p := f("Position")
+	uniforms.Pos = fu.Pos.Add(tu.Pos.Sub(fu.Pos).Mul(p))
+
+	// the camera turns the short way round
+	c := f("Camera")
+	yaw := math.Remainder(tu.CameraYaw-fu.CameraYaw, 360)
+	uniforms.SetCamera3D(programs.Camera3D{
+		Position:    fu.CameraPos.Add(tu.CameraPos.Sub(fu.CameraPos).Mul(c)),
+		Yaw:         fu.CameraYaw + yaw*c,
+		Pitch:       lerp(fu.CameraPitch, tu.CameraPitch, c),
+		FieldOfView: lerp(fu.FieldOfView, tu.FieldOfView, c),
+	})
+
+	uniforms.Iterations = uint32(math.Round(lerp(float64(fu.Iterations), float64(tu.Iterations), f("Iterations"))))
+
+	for i := range uniforms.Sliders {
+		uniforms.Sliders[i] = lerp(fu.Sliders[i], tu.Sliders[i], f(fmt.Sprintf("Slider %v", i)))
+	}
+
+	j := f("Julia C")
+	uniforms.JuliaC = fu.JuliaC.Add(tu.JuliaC.Sub(fu.JuliaC).Mul(j))
+
+	// like pallets, polynomials of different degrees switch at the keyframe
+	if fu.RootCount == tu.RootCount {
+		r := f("Roots")
+		for i := range uniforms.Roots {
+			uniforms.Roots[i] = fu.Roots[i].Add(tu.Roots[i].Sub(fu.Roots[i]).Mul(r))
+		}
+	}
+
+	// colours are mixed in linear light, like supersampling
+	mix := func(a, b mgl32.Vec3, t float64) mgl32.Vec3 {
+		a, b = programs.SRGBToLinear(a), programs.SRGBToLinear(b)
+		return programs.LinearToSRGB(a.Add(b.Sub(a).Mul(float32(t))))
+	}
+
+	// the test switches at the keyframe like the program, and the radius is interpolated logarithmically like zoom
+	uniforms.Bailout = math.Exp(lerp(math.Log(fu.Bailout), math.Log(tu.Bailout), f("Bailout")))
+
+	uniforms.EmptyColour = mix(fu.EmptyColour, tu.EmptyColour, f("Empty Colour"))
+
+	// pallets of different lengths can't be mixed, so switch at the keyframe like the program
+	if len(fu.ColourPallet) == len(tu.ColourPallet) {
+		c := f("Colour Pallet")
+		uniforms.ColourPallet = make(programs.ColourPallet, len(fu.ColourPallet))
+		for i := range uniforms.ColourPallet {
+			uniforms.ColourPallet[i] = mix(fu.ColourPallet[i], tu.ColourPallet[i], c)
+		}
+	}
+
+	uniforms.PalletScale = float32(lerp(float64(fu.PalletScale), float64(tu.PalletScale), f("Pallet Scale")))
+	uniforms.PalletOffset = uint32(math.Round(lerp(float64(fu.PalletOffset), float64(tu.PalletOffset), f("Pallet Offset"))))
+
+	// flames with different transforms or variations switch at the keyframe too
+	if flame, ok := fu.Flame.Lerp(tu.Flame, f("Flame")); ok {
+		uniforms.Flame = flame
+	}
+
+	return k
+}
+
+// frameRenderer renders a single frame of an animation as a PNG.
+type frameRenderer func(ctx context.Context, w io.Writer, program programs.Program, uniforms programs.Uniforms) error
+
+// cpuFrameRenderer renders frames with the native implementation, as configured by opts.
+func cpuFrameRenderer(opts SaveOptions) frameRenderer {
+	opts.Format = FormatPNG
+	return func(ctx context.Context, w io.Writer, program programs.Program, uniforms programs.Uniforms) error {
+		_, err := renderTo(ctx, w, opts, program, uniforms, discardProgress{}, nil)
+		return err
+	}
+}
+
+// frameName returns the file name of frame i.
+func frameName(dir string, i int) string {
+	return filepath.Join(dir, fmt.Sprintf("frame_%05d.png", i))
+}
+
+// renderFrames renders every frame of a to a numbered PNG in dir.
+func renderFrames(
+	ctx context.Context,
+	dir string,
+	a *Animation,
+	render frameRenderer,
+	progress progressReporter,
+) error {
+	if len(a.Keyframes) == 0 {
+		return fmt.Errorf("animation has no keyframes")
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	frames := a.Frames()
+	done := addFrameProgress(ctx, progress, frames)
+
+	for i := 0; i < frames; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		k := a.At(float64(i) / a.FPS)
+		program, ok := programs.ProgramByName(k.Program)
+		if !ok {
+			return fmt.Errorf("no program named %q", k.Program)
+		}
+
+		if err := renderFrame(ctx, frameName(dir, i), render, program, k.Uniforms); err != nil {
+			return err
+		}
+		done()
+	}
+
+	return nil
+}
+
+// addFrameProgress reports the progress of rendering frames,
+// returning a function to call as each frame is finished.
+func addFrameProgress(ctx context.Context, progress progressReporter, frames int) func() {
+	var done atomic.Int64
+	start := time.Now()
+	progress.AddProgressSupplier(ctx, func() Progress {
+		n := done.Load()
+		return Progress{
+			Fraction: float64(n) / float64(frames),
+			Samples:  uint64(n),
+			Elapsed:  time.Since(start),
+		}
+	}, fmt.Sprintf("Rendering %v frames", frames))
+
+	return func() {
+		done.Add(1)
+	}
+}
+
+func renderFrame(
+	ctx context.Context,
+	name string,
+	render frameRenderer,
+	program programs.Program,
+	uniforms programs.Uniforms,
+) error {
+	return createFile(name, func(file *os.File) error {
+		return render(ctx, file, program, uniforms)
+	})
+}
+
+// createFile calls write with a new file, removing the file if writing fails.
+func createFile(name string, write func(file *os.File) error) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	err = write(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(name)
+	}
+	return err
+}
+
+// discardProgress ignores progress, for renders that report it some other way.
+type discardProgress struct{}
+
+func (discardProgress) AddProgressSupplier(context.Context, func() Progress, string) {}
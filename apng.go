@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"io"
+	"math"
+
+	"github.com/stewi1014/glfractal/programs"
+)
+
+// apngWriter writes a looping animated PNG with 8 bit RGB frames.
+//
+// Rows are filtered and compressed as they arrive,
+// and the compressed data is written in chunks as it fills.
+type apngWriter struct {
+	w             *bufio.Writer
+	width, height int
+	compression   int
+	delay         [2]uint16 // numerator and denominator in seconds
+	sequence      uint32
+	frames        int
+
+	previous, current, filtered []byte
+}
+
+// apngChunkSize is the most image data held before it is written as a chunk.
+const apngChunkSize = 1 << 16
+
+func newAPNGWriter(w io.Writer, width, height int, fps float64, frames int, compression png.CompressionLevel) (*apngWriter, error) {
+	a := &apngWriter{
+		w:           bufio.NewWriter(w),
+		width:       width,
+		height:      height,
+		compression: zlibLevel(compression),
+		previous:    make([]byte, width*3),
+		current:     make([]byte, width*3),
+		filtered:    make([]byte, 1+width*3),
+	}
+
+	// the delay is the reciprocal of the frame rate
+	rate, scale := frameRate(fps, 1000)
+	for rate > math.MaxUint16 || scale > math.MaxUint16 {
+		rate, scale = rate/2, scale/2
+	}
+	a.delay = [2]uint16{uint16(scale), uint16(rate)}
+
+	if _, err := a.w.WriteString("\x89PNG\r\n\x1a\n"); err != nil {
+		return nil, err
+	}
+
+	ihdr := binary.BigEndian.AppendUint32(nil, uint32(width))
+	ihdr = binary.BigEndian.AppendUint32(ihdr, uint32(height))
+	ihdr = append(ihdr, 8, 2, 0, 0, 0) // 8 bit RGB, not interlaced
+
+	actl := binary.BigEndian.AppendUint32(nil, uint32(frames))
+	actl = binary.BigEndian.AppendUint32(actl, 0) // loop forever
+
+	chunks := []pngChunk{{typ: "IHDR", data: ihdr}}
+	chunks = append(chunks, colourSpaceChunks()...)
+	chunks = append(chunks, textChunk("Software", "glfractal"))
+	chunks = append(chunks, pngChunk{typ: "acTL", data: actl})
+
+	for _, chunk := range chunks {
+		if err := chunk.writeTo(a.w); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// zlibLevel returns the zlib level matching a png.CompressionLevel.
+func zlibLevel(level png.CompressionLevel) int {
+	switch level {
+	case png.NoCompression:
+		return zlib.NoCompression
+	case png.BestSpeed:
+		return zlib.BestSpeed
+	case png.BestCompression:
+		return zlib.BestCompression
+	default:
+		return zlib.DefaultCompression
+	}
+}
+
+func (a *apngWriter) WriteFrame(ctx context.Context, img image.Image, _ programs.Uniforms) error {
+	fctl := binary.BigEndian.AppendUint32(nil, a.sequence)
+	fctl = binary.BigEndian.AppendUint32(fctl, uint32(a.width))
+	fctl = binary.BigEndian.AppendUint32(fctl, uint32(a.height))
+	fctl = binary.BigEndian.AppendUint32(fctl, 0) // x offset
+	fctl = binary.BigEndian.AppendUint32(fctl, 0) // y offset
+	fctl = binary.BigEndian.AppendUint16(fctl, a.delay[0])
+	fctl = binary.BigEndian.AppendUint16(fctl, a.delay[1])
+	fctl = append(fctl, 0, 0) // no disposal, replace the previous frame
+	a.sequence++
+
+	if err := (pngChunk{typ: "fcTL", data: fctl}).writeTo(a.w); err != nil {
+		return err
+	}
+
+	// the first frame is the default image, seen by decoders that don't support animation
+	data := &apngDataWriter{apng: a, fdat: a.frames > 0}
+	a.frames++
+
+	compressor, err := zlib.NewWriterLevel(data, a.compression)
+	if err != nil {
+		return err
+	}
+
+	clear(a.previous)
+	err = streamRows(ctx, img, func(pix []byte) error {
+		for x := 0; x < a.width; x++ {
+			copy(a.current[x*3:x*3+3], pix[x*4:])
+		}
+
+		filterRow(a.filtered, a.current, a.previous)
+		a.previous, a.current = a.current, a.previous
+
+		_, err := compressor.Write(a.filtered)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := compressor.Close(); err != nil {
+		return err
+	}
+	return data.flush()
+}
+
+func (a *apngWriter) Close() error {
+	if err := (pngChunk{typ: "IEND"}).writeTo(a.w); err != nil {
+		return err
+	}
+	return a.w.Flush()
+}
+
+// apngDataWriter writes compressed frame data as IDAT chunks, or fdAT chunks after the first frame.
+type apngDataWriter struct {
+	apng *apngWriter
+	fdat bool
+	buff []byte
+}
+
+func (d *apngDataWriter) Write(p []byte) (int, error) {
+	d.buff = append(d.buff, p...)
+	if len(d.buff) >= apngChunkSize {
+		return len(p), d.flush()
+	}
+	return len(p), nil
+}
+
+func (d *apngDataWriter) flush() error {
+	if len(d.buff) == 0 {
+		return nil
+	}
+
+	chunk := pngChunk{typ: "IDAT", data: d.buff}
+	if d.fdat {
+		chunk.typ = "fdAT"
+		chunk.data = append(binary.BigEndian.AppendUint32(nil, d.apng.sequence), d.buff...)
+		d.apng.sequence++
+	}
+
+	d.buff = d.buff[:0]
+	return chunk.writeTo(d.apng.w)
+}
+
+// filterRow writes row to dst filtered with whichever PNG filter gives the smallest sum of absolute differences,
+// the heuristic suggested by the PNG specification. dst begins with the filter type.
+func filterRow(dst, row, previous []byte) {
+	const bpp = 3
+
+	best := math.MaxInt
+	var candidate [5][]byte
+	for filter := range candidate {
+		out := make([]byte, len(row))
+		for i := range row {
+			var a, b, c byte
+			if i >= bpp {
+				a, c = row[i-bpp], previous[i-bpp]
+			}
+			b = previous[i]
+
+			switch filter {
+			case 0:
+				out[i] = row[i]
+			case 1:
+				out[i] = row[i] - a
+			case 2:
+				out[i] = row[i] - b
+			case 3:
+				out[i] = row[i] - byte((int(a)+int(b))/2)
+			case 4:
+				out[i] = row[i] - paeth(a, b, c)
+			}
+		}
+		candidate[filter] = out
+
+		sum := 0
+		for _, v := range out {
+			sum += min(int(v), 256-int(v))
+		}
+		if sum < best {
+			best = sum
+			dst[0] = byte(filter)
+		}
+	}
+
+	copy(dst[1:], candidate[dst[0]])
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	default:
+		return c
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io"
+	"math"
+
+	"github.com/stewi1014/glfractal/programs"
+)
+
+// ErrAVITooLarge is returned when an AVI would outgrow its 32 bit RIFF sizes.
+var ErrAVITooLarge = errors.New("AVI files are limited to 4GiB, try Y4M or lower JPEG quality")
+
+// offsets of the fields filled in when an AVI is closed
+const (
+	aviRIFFSize        = 4
+	aviTotalFrames     = 48
+	aviSuggestedBuffer = 60
+	aviStreamLength    = 140
+	aviStreamBuffer    = 144
+	aviMoviSize        = 216
+	aviHeaderSize      = 224
+)
+
+// aviWriter writes a Motion JPEG AVI with an idx1 index.
+//
+// JPEG encodes whole images, so each frame is buffered before it is encoded,
+// but the buffer is reused for every frame.
+type aviWriter struct {
+	w             io.WriteSeeker
+	width, height int
+	quality       int
+
+	frame   *image.NRGBA
+	jpeg    bytes.Buffer
+	index   []byte
+	offset  int64 // bytes written after the movi fourcc
+	frames  int
+	maxSize int
+}
+
+func newAVIWriter(w io.WriteSeeker, width, height int, fps float64, frames, quality int) (*aviWriter, error) {
+	a := &aviWriter{
+		w:       w,
+		width:   width,
+		height:  height,
+		quality: quality,
+		frame:   image.NewNRGBA(image.Rect(0, 0, width, height)),
+		offset:  4,
+	}
+
+	rate, scale := frameRate(fps, 1000)
+
+	header := make([]byte, 0, aviHeaderSize)
+	le := binary.LittleEndian
+	u32 := func(v ...uint32) {
+		for _, v := range v {
+			header = le.AppendUint32(header, v)
+		}
+	}
+	fourcc := func(s string) {
+		header = append(header, s...)
+	}
+
+	fourcc("RIFF")
+	u32(0)
+	fourcc("AVI ")
+
+	fourcc("LIST")
+	u32(4 + 8 + 56 + 8 + 4 + 8 + 56 + 8 + 40)
+	fourcc("hdrl")
+
+	fourcc("avih")
+	u32(56)
+	u32(
+		uint32(math.Round(1e6/fps)), // microseconds per frame
+		0,                           // max bytes per second
+		0,                           // padding granularity
+		0x10,                        // AVIF_HASINDEX
+		uint32(frames),
+		0, // initial frames
+		1, // streams
+		0, // suggested buffer size
+		uint32(width),
+		uint32(height),
+		0, 0, 0, 0,
+	)
+
+	fourcc("LIST")
+	u32(4 + 8 + 56 + 8 + 40)
+	fourcc("strl")
+
+	fourcc("strh")
+	u32(56)
+	fourcc("vids")
+	fourcc("MJPG")
+	u32(
+		0, // flags
+		0, // priority and language
+		0, // initial frames
+		uint32(scale),
+		uint32(rate),
+		0, // start
+		uint32(frames),
+		0,          // suggested buffer size
+		0xffffffff, // default quality
+		0,          // sample size
+	)
+	header = le.AppendUint16(header, 0)
+	header = le.AppendUint16(header, 0)
+	header = le.AppendUint16(header, uint16(width))
+	header = le.AppendUint16(header, uint16(height))
+
+	fourcc("strf")
+	u32(40)
+	u32(40, uint32(width), uint32(height))
+	header = le.AppendUint16(header, 1)  // planes
+	header = le.AppendUint16(header, 24) // bits per pixel
+	fourcc("MJPG")
+	u32(uint32(width*height*3), 0, 0, 0, 0)
+
+	fourcc("LIST")
+	u32(0)
+	fourcc("movi")
+
+	_, err := w.Write(header)
+	return a, err
+}
+
+func (a *aviWriter) WriteFrame(ctx context.Context, img image.Image, _ programs.Uniforms) error {
+	y := 0
+	err := streamRows(ctx, img, func(pix []byte) error {
+		copy(a.frame.Pix[y*a.frame.Stride:], pix)
+		y++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	a.jpeg.Reset()
+	if err := jpeg.Encode(&a.jpeg, a.frame, &jpeg.Options{Quality: a.quality}); err != nil {
+		return err
+	}
+	size := a.jpeg.Len()
+
+	// chunks are padded to an even length
+	chunkSize := 8 + int64(size+size&1)
+	if aviHeaderSize+a.offset+chunkSize+int64(len(a.index)+16*(a.frames+1)) > math.MaxUint32 {
+		return ErrAVITooLarge
+	}
+
+	chunk := []byte("00dc")
+	chunk = binary.LittleEndian.AppendUint32(chunk, uint32(size))
+	chunk = append(chunk, a.jpeg.Bytes()...)
+	if size&1 == 1 {
+		chunk = append(chunk, 0)
+	}
+	if _, err := a.w.Write(chunk); err != nil {
+		return err
+	}
+
+	a.index = append(a.index, "00dc"...)
+	a.index = binary.LittleEndian.AppendUint32(a.index, 0x10) // AVIIF_KEYFRAME
+	a.index = binary.LittleEndian.AppendUint32(a.index, uint32(a.offset))
+	a.index = binary.LittleEndian.AppendUint32(a.index, uint32(size))
+
+	a.offset += chunkSize
+	a.frames++
+	a.maxSize = max(a.maxSize, size)
+	return nil
+}
+
+func (a *aviWriter) Close() error {
+	index := []byte("idx1")
+	index = binary.LittleEndian.AppendUint32(index, uint32(len(a.index)))
+	index = append(index, a.index...)
+	if _, err := a.w.Write(index); err != nil {
+		return err
+	}
+
+	end, err := a.w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	for _, field := range []struct {
+		offset int64
+		value  uint32
+	}{
+		{aviRIFFSize, uint32(end - 8)},
+		{aviTotalFrames, uint32(a.frames)},
+		{aviSuggestedBuffer, uint32(a.maxSize + 8)},
+		{aviStreamLength, uint32(a.frames)},
+		{aviStreamBuffer, uint32(a.maxSize + 8)},
+		{aviMoviSize, uint32(a.offset)},
+	} {
+		if _, err := a.w.Seek(field.offset, io.SeekStart); err != nil {
+			return err
+		}
+		if err := binary.Write(a.w, binary.LittleEndian, field.value); err != nil {
+			return err
+		}
+	}
+
+	_, err = a.w.Seek(end, io.SeekStart)
+	return err
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"time"
+
+	"github.com/stewi1014/glfractal/programs"
+)
+
+// densityRefresh is how often buffered density renders are tone mapped again to show the orbits counted so far.
+const densityRefresh = time.Second
+
+// histogramProgress reports the orbits counted into h.
+func histogramProgress(h *programs.Histogram) func() Progress {
+	start := time.Now()
+	var elapsed time.Duration
+	return func() Progress {
+		samples := h.Samples()
+		if samples < h.Target() || elapsed == 0 {
+			elapsed = time.Since(start)
+		}
+
+		return Progress{
+			Fraction: float64(samples) / float64(h.Target()),
+			Samples:  samples,
+			Elapsed:  elapsed,
+		}
+	}
+}
+
+// renderDensity counts the orbits of a density program into a histogram the size of the image in opts,
+// returning it tone mapped with the number of threads that counted them.
+//
+// If opts.Multithread is set, every render thread counts orbits and the image is buffered.
+// If onBuffer is not nil it's called with the buffer before it's filled,
+// and the buffer is filled again as orbits are counted to show their progress.
+func renderDensity(
+	ctx context.Context,
+	opts SaveOptions,
+	program programs.Program,
+	uniforms programs.Uniforms,
+	progress progressReporter,
+	onBuffer func(*BufferedImage),
+) (image.Image, int, error) {
+	if opts.ExpMap {
+		return nil, 0, fmt.Errorf("density programs can't be rendered as exponential maps")
+	}
+
+	h, err := program.GetHistogram(uniforms, opts.Width, opts.Height)
+	if err != nil {
+		return nil, 0, err
+	}
+	histogram := h.Image(&uniforms)
+	img := ToImage(histogram, opts.BitDepth, opts.Dither)
+	progress.AddProgressSupplier(ctx, histogramProgress(h), "Counting Orbits")
+
+	if !opts.Multithread {
+		err = h.Accumulate(ctx, 1)
+		histogram.Update()
+		return img, 1, err
+	}
+
+	buff := BufferImage(img)
+	if onBuffer != nil {
+		onBuffer(buff)
+		if err := buff.Buffer(ctx); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	threads := renderThreads()
+	done := make(chan error, 1)
+	go func() {
+		done <- h.Accumulate(ctx, threads)
+	}()
+
+	ticker := time.NewTicker(densityRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				return nil, threads, err
+			}
+			histogram.Update()
+			return buff, threads, buff.Buffer(ctx)
+
+		case <-ticker.C:
+			if onBuffer == nil {
+				continue
+			}
+			histogram.Update()
+			if err := buff.Buffer(ctx); err != nil {
+				return nil, threads, err
+			}
+		}
+	}
+}
@@ -90,7 +90,60 @@ func NewErrorDialog(
 
 type ProgressBarWindow interface {
 	gtk.IWindow
-	AddProgressSupplier(context.Context, func() float64, string)
+	AddProgressSupplier(context.Context, func() Progress, string)
+}
+
+// Progress is a snapshot of how far through its work a stage is.
+type Progress struct {
+	Fraction float64
+	Samples  uint64
+	Elapsed  time.Duration
+}
+
+// Rate returns the number of samples processed per second.
+func (p Progress) Rate() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.Samples) / p.Elapsed.Seconds()
+}
+
+// Remaining estimates the time left, returning -1 if it cannot yet be estimated.
+func (p Progress) Remaining() time.Duration {
+	if p.Fraction <= 0 || p.Elapsed <= 0 {
+		return -1
+	}
+	if p.Fraction >= 1 {
+		return 0
+	}
+	return time.Duration(float64(p.Elapsed) * (1 - p.Fraction) / p.Fraction)
+}
+
+func (p Progress) String() string {
+	remaining := "unknown"
+	if r := p.Remaining(); r >= 0 {
+		remaining = r.Round(time.Second).String()
+	}
+
+	return fmt.Sprintf(
+		"%v/s, %v elapsed, %v remaining",
+		formatSI(p.Rate()),
+		p.Elapsed.Round(time.Second),
+		remaining,
+	)
+}
+
+func formatSI(n float64) string {
+	switch {
+	case n >= 1e9:
+		return fmt.Sprintf("%.1fG", n/1e9)
+	case n >= 1e6:
+		return fmt.Sprintf("%.1fM", n/1e6)
+	case n >= 1e3:
+		return fmt.Sprintf("%.1fk", n/1e3)
+	default:
+		return fmt.Sprintf("%.0f", n)
+	}
 }
 
 func NewProgressBar(ctx context.Context) *ProgressBar {
@@ -106,7 +159,7 @@ func NewProgressBar(ctx context.Context) *ProgressBar {
 
 type progressSupplier struct {
 	description string
-	supplier    func() float64
+	supplier    func() Progress
 }
 
 type ProgressBar struct {
@@ -126,7 +179,7 @@ func (dialog *ProgressBar) SetFinished(description string) {
 	})
 }
 
-func (dialog *ProgressBar) AddProgressSupplier(ctx context.Context, supplier func() float64, description string) {
+func (dialog *ProgressBar) AddProgressSupplier(ctx context.Context, supplier func() Progress, description string) {
 	dialog.suppliersMutex.Lock()
 	defer dialog.suppliersMutex.Unlock()
 
@@ -153,15 +206,35 @@ func (dialog *ProgressBar) updateProgress(ctx context.Context) {
 				continue
 			}
 
+			var total Progress
+			stage := -1
+			progresses := make([]Progress, len(dialog.suppliers))
+			for i, s := range dialog.suppliers {
+				progresses[i] = s.supplier()
+				total.Fraction += progresses[i].Fraction / float64(len(dialog.suppliers))
+				total.Samples += progresses[i].Samples
+				total.Elapsed += progresses[i].Elapsed
+
+				if stage < 0 && progresses[i].Fraction < 1 {
+					stage = i
+				}
+			}
+
 			progress := float64(1)
-			description := ""
-			for i := 0; progress >= 1; i++ {
-				if i >= len(dialog.suppliers) {
-					description = "Finished"
-					break
+			description := "Finished"
+			if stage >= 0 {
+				remaining := "unknown"
+				if r := total.Remaining(); r >= 0 {
+					remaining = r.Round(time.Second).String()
 				}
-				progress = dialog.suppliers[i].supplier()
-				description = dialog.suppliers[i].description
+
+				progress = progresses[stage].Fraction
+				description = fmt.Sprintf(
+					"%v (%v); %v remaining overall",
+					dialog.suppliers[stage].description,
+					progresses[stage],
+					remaining,
+				)
 			}
 			dialog.suppliersMutex.Unlock()
 
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"regexp"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/stewi1014/glfractal/programs"
+)
+
+// expMapRadius is the radius of the view at the top of an exponential map strip.
+// It reaches the corners of a square view, so frames of any shape can be rebuilt from the strip.
+const expMapRadius = math.Sqrt2
+
+// expMap maps positions on an exponential map strip to positions in the view.
+//
+// Across the strip is once around the centre of the view,
+// and down the strip the radius shrinks exponentially,
+// at the rate that keeps pixels square, so a strip w pixels wide and h high
+// covers a zoom of e^(2πh/w) from expMapRadius at the top.
+type expMap struct {
+	angle  float64 // radians per unit across the strip, and log radius per unit down it
+	centre float64 // log radius at the middle of the strip
+}
+
+func newExpMap(bounds image.Rectangle) expMap {
+	return expMap{
+		angle:  2 * math.Pi * float64(pixelScale(bounds)) / float64(bounds.Dx()),
+		centre: math.Log(expMapRadius) - math.Pi*float64(bounds.Dy())/float64(bounds.Dx()),
+	}
+}
+
+// expMapDepth returns the natural log of the zoom covered by a width by height strip.
+func expMapDepth(width, height int) float64 {
+	return 2 * math.Pi * float64(height) / float64(width)
+}
+
+func (m expMap) view(pos mgl32.Vec2) mgl32.Vec2 {
+	theta := m.angle * float64(pos[0])
+	r := math.Exp(m.centre + m.angle*float64(pos[1]))
+	return mgl32.Vec2{float32(r * math.Cos(theta)), float32(r * math.Sin(theta))}
+}
+
+// strip is the inverse of view, returning the strip position of a view position.
+func (m expMap) strip(pos mgl64.Vec2) (x, y float64) {
+	return math.Atan2(pos[1], pos[0]) / m.angle, (math.Log(pos.Len()) - m.centre) / m.angle
+}
+
+// ExpMap wraps img so its bounds show an exponential map of the view instead of the view itself.
+// Any program's image can be mapped, as only the positions it is sampled at change.
+func ExpMap(img programs.Image) programs.Image {
+	return &expMapImage{
+		Image: img,
+		m:     newExpMap(img.Bounds()),
+	}
+}
+
+type expMapImage struct {
+	programs.Image
+	m expMap
+}
+
+func (i *expMapImage) GetPixel(pos mgl32.Vec2) mgl32.Vec3 {
+	return i.Image.GetPixel(i.m.view(pos))
+}
+
+// ExpMapData is ExpMap for raw iteration results.
+func ExpMapData(img programs.DataImage) programs.DataImage {
+	return &expMapDataImage{
+		DataImage: img,
+		m:         newExpMap(img.Bounds()),
+	}
+}
+
+type expMapDataImage struct {
+	programs.DataImage
+	m expMap
+}
+
+func (i *expMapDataImage) GetData(pos mgl32.Vec2) programs.PixelData {
+	return i.DataImage.GetData(i.m.view(pos))
+}
+
+var (
+	fragmentInput = regexp.MustCompile(`\bin\s+vec2\s+frag\s*;`)
+	fragmentMain  = regexp.MustCompile(`\bvoid\s+main\s*\(\s*\)`)
+	vertexOutput  = regexp.MustCompile(`\bfrag\b`)
+)
+
+// expMapProgram rewrites program's shaders to render a width by height exponential map strip.
+//
+// The fragment shader's main is renamed and called from a new main that sets frag from the strip position,
+// so it works with any shader that takes its position from frag.
+// The strip size is part of the name, as the mapping is compiled into the shader.
+func expMapProgram(program programs.Program, width, height int) (programs.Program, error) {
+	if !fragmentInput.MatchString(program.FragmentShader) || !fragmentMain.MatchString(program.FragmentShader) {
+		return program, fmt.Errorf("%v doesn't take its position from frag, so can't be exponentially mapped", program.Name)
+	}
+
+	m := newExpMap(image.Rect(-width/2, -height/2, width/2, height/2))
+
+	program.Name = fmt.Sprintf("%v (Exponential Map %vx%v)", program.Name, width, height)
+	program.VertexShader = vertexOutput.ReplaceAllString(program.VertexShader, "strip")
+	program.FragmentShader = fragmentInput.ReplaceAllString(program.FragmentShader, "in vec2 strip;\nvec2 frag;")
+	program.FragmentShader = fragmentMain.ReplaceAllString(program.FragmentShader, "void fractal_main()")
+	program.FragmentShader += fmt.Sprintf(`
+const float EXP_MAP_ANGLE = %.9e;
+const float EXP_MAP_CENTRE = %.9e;
+
+void main() {
+    float theta = EXP_MAP_ANGLE * strip.x;
+    frag = exp(EXP_MAP_CENTRE + EXP_MAP_ANGLE * strip.y) * vec2(cos(theta), sin(theta));
+    fractal_main();
+}
+`, m.angle, m.centre)
+
+	// the CPU implementation would render the view, not the strip
+	program.GetPixel, program.GetData = nil, nil
+	return program, nil
+}
+
+// Strip is a rendered exponential map, from which frames zooming into its centre can be rebuilt.
+type Strip struct {
+	width, height int
+	m             expMap
+	scale         float64
+	pix           []mgl32.Vec3 // linear light
+}
+
+// NewStrip reads the pixels of an exponential map rendered by ExpMap.
+func NewStrip(img image.Image) *Strip {
+	bounds := img.Bounds()
+	s := &Strip{
+		width:  bounds.Dx(),
+		height: bounds.Dy(),
+		m:      newExpMap(image.Rect(0, 0, bounds.Dx(), bounds.Dy())),
+		scale:  float64(pixelScale(bounds)),
+		pix:    make([]mgl32.Vec3, 0, bounds.Dx()*bounds.Dy()),
+	}
+
+	// a table is quicker than converting every channel
+	linear := make([]float32, 0x10000)
+	for i := range linear {
+		linear[i] = programs.SRGBToLinear(mgl32.Vec3{float32(i) / 0xffff})[0]
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+			s.pix = append(s.pix, mgl32.Vec3{linear[c.R], linear[c.G], linear[c.B]})
+		}
+	}
+	return s
+}
+
+// LoadStrip reads an exponential map from an image file.
+func LoadStrip(name string) (*Strip, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", name, err)
+	}
+	return NewStrip(img), nil
+}
+
+// MaxDepth returns the natural log of the furthest zoom that can be rebuilt at the given size,
+// where the pixels next to the centre are still inside the strip.
+func (s *Strip) MaxDepth(width, height int) float64 {
+	scale := float64(pixelScale(image.Rect(0, 0, width, height)))
+	return expMapDepth(s.width, s.height) - math.Log(expMapRadius*scale)
+}
+
+// Frame returns a width by height view zoomed in by e^depth from the top of the strip.
+func (s *Strip) Frame(width, height int, depth float64) programs.Image {
+	width, height = width/2, height/2
+	return &stripFrame{
+		strip:  s,
+		bounds: image.Rect(-width, -height, width, height),
+		zoom:   math.Exp(-depth),
+	}
+}
+
+// sample returns the colour at strip position x, y,
+// interpolated in linear light, wrapping around the strip and clamped to its ends.
+func (s *Strip) sample(x, y float64) mgl32.Vec3 {
+	col := x*s.scale + float64(s.width)/2
+	row := float64(s.height)/2 - y*s.scale
+	row = math.Max(0, math.Min(row, float64(s.height-1)))
+
+	c0, r0 := math.Floor(col), math.Floor(row)
+	fc, fr := float32(col-c0), float32(row-r0)
+
+	x0 := (int(c0)%s.width + s.width) % s.width
+	x1 := (x0 + 1) % s.width
+	y0 := int(r0)
+	y1 := min(y0+1, s.height-1)
+
+	at := func(x, y int) mgl32.Vec3 {
+		return s.pix[y*s.width+x]
+	}
+	top := at(x0, y0).Mul(1 - fc).Add(at(x1, y0).Mul(fc))
+	bottom := at(x0, y1).Mul(1 - fc).Add(at(x1, y1).Mul(fc))
+	return top.Mul(1 - fr).Add(bottom.Mul(fr))
+}
+
+type stripFrame struct {
+	strip  *Strip
+	bounds image.Rectangle
+	zoom   float64
+}
+
+func (f *stripFrame) GetPixel(pos mgl32.Vec2) mgl32.Vec3 {
+	view := mgl64.Vec2{float64(pos[0]), float64(pos[1])}.Mul(f.zoom)
+	if view.Len() == 0 {
+		// the centre is always past the bottom of the strip
+		view[0] = math.SmallestNonzeroFloat64
+	}
+
+	x, y := f.strip.m.strip(view)
+	return programs.LinearToSRGB(f.strip.sample(x, y))
+}
+
+func (f *stripFrame) Bounds() image.Rectangle {
+	return f.bounds
+}
+
+// stripFrames returns frames zooming into s, at the size and supersampling set in opts,
+// taking decadeSeconds to zoom in by each factor of ten.
+// The frames are coloured by uniforms, so GIFs need the uniforms the strip was rendered with.
+func stripFrames(s *Strip, uniforms programs.Uniforms, opts SaveOptions, fps, decadeSeconds float64) (int, frameSource) {
+	step := math.Ln10 / (decadeSeconds * fps)
+	frames := int(s.MaxDepth(opts.Width, opts.Height)/step) + 1
+
+	return max(frames, 0), func(ctx context.Context, i int) (image.Image, programs.Uniforms, error) {
+		frame := s.Frame(opts.Width, opts.Height, float64(i)*step)
+		return ToImage(Supersample(frame, opts.Supersample), 8, opts.Dither), uniforms, nil
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/stewi1014/glfractal/programs"
+)
+
+// loadFlame reads a flam3 or Apophysis file into uniforms, returning the size of the image it was made for.
+func loadFlame(name string, uniforms *programs.Uniforms) (int, int, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	pallet := uniforms.ColourPallet
+	width, height, err := programs.ReadFlame(file, uniforms)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%v: %w", name, err)
+	}
+	if !slices.Equal(uniforms.ColourPallet, pallet) {
+		uniforms.PalletSource = name // the flame brought its own palette
+	}
+	return width, height, nil
+}
+
+// saveFlame writes the flame of uniforms as a flam3 file, viewed as in an image of the given size.
+func saveFlame(name string, uniforms *programs.Uniforms, width, height int) error {
+	title := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	return createFile(name, func(file *os.File) error {
+		return programs.WriteFlame(file, title, uniforms, width, height)
+	})
+}
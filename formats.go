@@ -0,0 +1,59 @@
+package main
+
+import "image/png"
+
+type ImageFormat int
+
+const (
+	FormatPNG ImageFormat = iota
+	FormatJPEG
+	FormatTIFF
+	FormatWebP
+	FormatPFM
+	FormatEXR
+	FormatEXRData
+	FormatNPYData
+)
+
+var imageFormatNames = []string{"PNG", "JPEG", "TIFF", "WebP", "PFM", "OpenEXR", "OpenEXR Data", "NumPy Data"}
+
+func (f ImageFormat) String() string { return imageFormatNames[f] }
+
+// Extension returns the file extension for the format, including the dot.
+func (f ImageFormat) Extension() string {
+	switch f {
+	case FormatJPEG:
+		return ".jpg"
+	case FormatTIFF:
+		return ".tif"
+	case FormatWebP:
+		return ".webp"
+	case FormatPFM:
+		return ".pfm"
+	case FormatEXR, FormatEXRData:
+		return ".exr"
+	case FormatNPYData:
+		return ".npy"
+	default:
+		return ".png"
+	}
+}
+
+// IsRaw reports whether the format stores floating point values rather than an image.Image.
+func (f ImageFormat) IsRaw() bool {
+	return f >= FormatPFM
+}
+
+// IsData reports whether the format stores raw iteration results rather than colours.
+func (f ImageFormat) IsData() bool {
+	return f == FormatEXRData || f == FormatNPYData
+}
+
+var pngCompressionNames = []string{"Default", "None", "Fastest", "Best"}
+
+var pngCompressionLevels = []png.CompressionLevel{
+	png.DefaultCompression,
+	png.NoCompression,
+	png.BestSpeed,
+	png.BestCompression,
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"compress/lzw"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"slices"
+
+	"github.com/stewi1014/glfractal/programs"
+)
+
+// gifWriter writes a looping animated GIF.
+//
+// Each frame has its own colour table made from the fractal's colours,
+// so frames rendered without supersampling keep their exact colours.
+// Pixels are matched to the table and compressed a row at a time.
+type gifWriter struct {
+	w             *bufio.Writer
+	width, height int
+	fps           float64
+	frames        int
+}
+
+func newGIFWriter(w io.Writer, width, height int, fps float64) (*gifWriter, error) {
+	if width > math.MaxUint16 || height > math.MaxUint16 {
+		return nil, fmt.Errorf("GIF images can't be larger than %vx%v", math.MaxUint16, math.MaxUint16)
+	}
+
+	g := &gifWriter{
+		w:      bufio.NewWriter(w),
+		width:  width,
+		height: height,
+		fps:    fps,
+	}
+
+	header := []byte("GIF89a")
+	header = binary.LittleEndian.AppendUint16(header, uint16(width))
+	header = binary.LittleEndian.AppendUint16(header, uint16(height))
+	header = append(header, 0, 0, 0) // no global colour table
+
+	// loop forever
+	header = append(header, 0x21, 0xff, 11)
+	header = append(header, "NETSCAPE2.0"...)
+	header = append(header, 3, 1, 0, 0, 0)
+
+	_, err := g.w.Write(header)
+	return g, err
+}
+
+// gifPalette returns the colours of uniforms as a 256 entry GIF colour table.
+// Pallets longer than 255 colours keep every few colours.
+func gifPalette(uniforms programs.Uniforms) [][3]uint8 {
+	pallet := uniforms.ColourPallet
+	if len(pallet) > 255 {
+		pallet = make(programs.ColourPallet, 255)
+		for i := range pallet {
+			pallet[i] = uniforms.ColourPallet[i*len(uniforms.ColourPallet)/len(pallet)]
+		}
+	}
+
+	palette := make([][3]uint8, 0, 256)
+	for _, c := range append(slices.Clip(pallet), uniforms.EmptyColour) {
+		palette = append(palette, [3]uint8{
+			uint8(limit(c[0])*255 + .5),
+			uint8(limit(c[1])*255 + .5),
+			uint8(limit(c[2])*255 + .5),
+		})
+	}
+	for len(palette) < 256 {
+		palette = append(palette, [3]uint8{})
+	}
+	return palette[:256]
+}
+
+func (g *gifWriter) WriteFrame(ctx context.Context, img image.Image, uniforms programs.Uniforms) error {
+	// GIF delays are in hundredths of a second, so round each frame's end time to keep in step
+	delay := math.Round(float64(g.frames+1)*100/g.fps) - math.Round(float64(g.frames)*100/g.fps)
+	g.frames++
+
+	frame := []byte{0x21, 0xf9, 4, 0x04} // graphic control, leave the frame in place
+	frame = binary.LittleEndian.AppendUint16(frame, uint16(delay))
+	frame = append(frame, 0, 0)
+
+	frame = append(frame, 0x2c, 0, 0, 0, 0)
+	frame = binary.LittleEndian.AppendUint16(frame, uint16(g.width))
+	frame = binary.LittleEndian.AppendUint16(frame, uint16(g.height))
+	frame = append(frame, 0x80|7) // 256 entry local colour table
+
+	palette := gifPalette(uniforms)
+	for _, c := range palette {
+		frame = append(frame, c[:]...)
+	}
+	frame = append(frame, 8) // LZW minimum code size
+
+	if _, err := g.w.Write(frame); err != nil {
+		return err
+	}
+
+	blocks := &gifBlockWriter{w: g.w}
+	compressor := lzw.NewWriter(blocks, lzw.LSB, 8)
+
+	nearest := make(map[[3]uint8]uint8)
+	indices := make([]byte, g.width)
+	err := streamRows(ctx, img, func(pix []byte) error {
+		for x := range indices {
+			c := [3]uint8{pix[x*4], pix[x*4+1], pix[x*4+2]}
+			i, ok := nearest[c]
+			if !ok {
+				i = nearestColour(palette, c)
+				nearest[c] = i
+			}
+			indices[x] = i
+		}
+		_, err := compressor.Write(indices)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := compressor.Close(); err != nil {
+		return err
+	}
+	return blocks.Close()
+}
+
+func nearestColour(palette [][3]uint8, c [3]uint8) uint8 {
+	best, bestDistance := 0, math.MaxInt
+	for i, p := range palette {
+		distance := 0
+		for j := range p {
+			d := int(p[j]) - int(c[j])
+			distance += d * d
+		}
+		if distance < bestDistance {
+			best, bestDistance = i, distance
+		}
+	}
+	return uint8(best)
+}
+
+func (g *gifWriter) Close() error {
+	if err := g.w.WriteByte(0x3b); err != nil {
+		return err
+	}
+	return g.w.Flush()
+}
+
+// gifBlockWriter splits image data into GIF sub-blocks of at most 255 bytes.
+type gifBlockWriter struct {
+	w     io.Writer
+	block [256]byte
+	n     int
+}
+
+func (b *gifBlockWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		k := copy(b.block[1+b.n:], p)
+		b.n += k
+		p = p[k:]
+		written += k
+
+		if b.n == 255 {
+			if err := b.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (b *gifBlockWriter) flush() error {
+	if b.n == 0 {
+		return nil
+	}
+	b.block[0] = uint8(b.n)
+	_, err := b.w.Write(b.block[:1+b.n])
+	b.n = 0
+	return err
+}
+
+// Close writes any remaining data and the block terminator.
+func (b *gifBlockWriter) Close() error {
+	if err := b.flush(); err != nil {
+		return err
+	}
+	_, err := b.w.Write([]byte{0})
+	return err
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"math"
+
+	"github.com/gotk3/gotk3/cairo"
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/stewi1014/glfractal/programs"
+)
+
+// gradientMarkerHeight is the space below the gradient where stops are drawn.
+const gradientMarkerHeight = 10
+
+// GradientEditor edits the stops of a gradient.
+//
+// Stops are dragged along the gradient to move them, and double clicking adds one.
+// The selected stop's colour is set with Colour, and it is removed with Remove.
+type GradientEditor struct {
+	Area   *gtk.DrawingArea
+	Colour *gtk.ColorButton
+	Remove *gtk.Button
+
+	gradient *programs.Gradient
+	selected int
+	dragging bool
+	changed  func()
+}
+
+// NewGradientEditor edits gradient in place, calling changed after every edit.
+func NewGradientEditor(gradient *programs.Gradient, changed func()) *GradientEditor {
+	e := &GradientEditor{
+		gradient: gradient,
+		changed:  changed,
+	}
+
+	e.Area, _ = gtk.DrawingAreaNew()
+	e.Area.SetSizeRequest(300, 40)
+	e.Area.SetHExpand(true)
+	e.Area.AddEvents(int(gdk.BUTTON_PRESS_MASK | gdk.BUTTON_RELEASE_MASK | gdk.BUTTON1_MOTION_MASK))
+	e.Area.Connect("draw", e.draw)
+	e.Area.Connect("button-press-event", e.button)
+	e.Area.Connect("button-release-event", e.button)
+	e.Area.Connect("motion-notify-event", e.motion)
+
+	e.Colour, _ = gtk.ColorButtonNewWithRGBA(gdk.NewRGBA(0, 0, 0, 1))
+	e.Colour.SetTooltipText("Colour of the selected stop")
+	e.Colour.Connect("color-set", func() {
+		if e.selected < len(e.gradient.Stops) {
+			c := e.Colour.GetRGBA()
+			e.gradient.Stops[e.selected].Colour = [3]float32{float32(c.GetRed()), float32(c.GetGreen()), float32(c.GetBlue())}
+			e.edited()
+		}
+	})
+
+	e.Remove, _ = gtk.ButtonNewWithLabel("Remove Stop")
+	e.Remove.Connect("clicked", func() {
+		if len(e.gradient.Stops) > 1 && e.selected < len(e.gradient.Stops) {
+			e.gradient.Stops = append(e.gradient.Stops[:e.selected], e.gradient.Stops[e.selected+1:]...)
+			e.selected = min(e.selected, len(e.gradient.Stops)-1)
+			e.edited()
+		}
+	})
+
+	e.Refresh()
+	return e
+}
+
+// Refresh redraws the editor after the gradient is replaced.
+func (e *GradientEditor) Refresh() {
+	e.gradient.Sort()
+	e.selected = max(min(e.selected, len(e.gradient.Stops)-1), 0)
+	if e.selected < len(e.gradient.Stops) {
+		c := e.gradient.Stops[e.selected].Colour
+		e.Colour.SetRGBA(gdk.NewRGBA(float64(c[0]), float64(c[1]), float64(c[2]), 1))
+	}
+	e.Area.QueueDraw()
+}
+
+func (e *GradientEditor) edited() {
+	e.Refresh()
+	e.changed()
+}
+
+func (e *GradientEditor) draw(da *gtk.DrawingArea, cr *cairo.Context) bool {
+	width := float64(da.GetAllocatedWidth())
+	height := float64(da.GetAllocatedHeight()) - gradientMarkerHeight
+
+	for x := 0.; x < width; x++ {
+		c := e.gradient.At(float32(x / width))
+		cr.SetSourceRGB(float64(c[0]), float64(c[1]), float64(c[2]))
+		cr.Rectangle(x, 0, 1, height)
+		cr.Fill()
+	}
+
+	for i, stop := range e.gradient.Stops {
+		x := float64(stop.Pos) * width
+		cr.MoveTo(x, height)
+		cr.LineTo(x-gradientMarkerHeight/2, height+gradientMarkerHeight)
+		cr.LineTo(x+gradientMarkerHeight/2, height+gradientMarkerHeight)
+		cr.ClosePath()
+
+		c := stop.Colour
+		cr.SetSourceRGB(float64(c[0]), float64(c[1]), float64(c[2]))
+		cr.FillPreserve()
+		if i == e.selected {
+			cr.SetSourceRGB(1, 0.2, 0.2)
+		} else {
+			cr.SetSourceRGB(0.5, 0.5, 0.5)
+		}
+		cr.SetLineWidth(1.5)
+		cr.Stroke()
+	}
+	return true
+}
+
+// stopAt returns the index of the stop under x, or -1 if there isn't one.
+func (e *GradientEditor) stopAt(x float64) int {
+	width := float64(e.Area.GetAllocatedWidth())
+	for i, stop := range e.gradient.Stops {
+		if math.Abs(float64(stop.Pos)*width-x) <= gradientMarkerHeight/2 {
+			return i
+		}
+	}
+	return -1
+}
+
+func (e *GradientEditor) button(da *gtk.DrawingArea, event *gdk.Event) bool {
+	button := gdk.EventButtonNewFromEvent(event)
+	if button.Button() != gdk.BUTTON_PRIMARY {
+		return false
+	}
+
+	switch button.Type() {
+	case gdk.EVENT_BUTTON_PRESS:
+		if i := e.stopAt(button.X()); i >= 0 {
+			e.selected = i
+			e.dragging = true
+			e.Refresh()
+		}
+
+	case gdk.EVENT_2BUTTON_PRESS:
+		if e.stopAt(button.X()) < 0 {
+			pos := limit(float32(button.X() / float64(da.GetAllocatedWidth())))
+			e.gradient.Stops = append(e.gradient.Stops, programs.GradientStop{
+				Pos:    pos,
+				Colour: e.gradient.At(pos),
+			})
+			e.selected = e.move(len(e.gradient.Stops)-1, pos)
+			e.edited()
+		}
+
+	case gdk.EVENT_BUTTON_RELEASE:
+		e.dragging = false
+	}
+	return true
+}
+
+func (e *GradientEditor) motion(da *gtk.DrawingArea, event *gdk.Event) bool {
+	if !e.dragging || e.selected >= len(e.gradient.Stops) {
+		return false
+	}
+
+	x, _ := gdk.EventMotionNewFromEvent(event).MotionVal()
+	pos := limit(float32(x / float64(da.GetAllocatedWidth())))
+	e.selected = e.move(e.selected, pos)
+	e.edited()
+	return true
+}
+
+// move moves stop i to pos, returning its index once it's past any neighbours it crossed.
+// Stops are followed by index rather than position, as several can share one.
+func (e *GradientEditor) move(i int, pos float32) int {
+	stops := e.gradient.Stops
+	stops[i].Pos = pos
+	for ; i > 0 && stops[i-1].Pos > pos; i-- {
+		stops[i-1], stops[i] = stops[i], stops[i-1]
+	}
+	for ; i < len(stops)-1 && stops[i+1].Pos < pos; i++ {
+		stops[i+1], stops[i] = stops[i], stops[i+1]
+	}
+	return i
+}
+
+// swatchWidth and swatchHeight are the size of the pallet previews in the preset menu.
+const (
+	swatchWidth  = 96
+	swatchHeight = 16
+)
+
+// palletSwatch draws pallet across a pixbuf, for previewing it in menus.
+func palletSwatch(pallet programs.ColourPallet) (*gdk.Pixbuf, error) {
+	pixbuf, err := gdk.PixbufNew(gdk.COLORSPACE_RGB, false, 8, swatchWidth, swatchHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	pix, stride := pixbuf.GetPixels(), pixbuf.GetRowstride()
+	for x := 0; x < swatchWidth; x++ {
+		c := pallet[x*len(pallet)/swatchWidth]
+		for y := 0; y < swatchHeight; y++ {
+			i := y*stride + x*3
+			pix[i] = uint8(c[0]*255 + .5)
+			pix[i+1] = uint8(c[1]*255 + .5)
+			pix[i+2] = uint8(c[2]*255 + .5)
+		}
+	}
+	return pixbuf, nil
+}
+
+// newPresetMenu returns a menu of the built-in gradients, each with a preview.
+func newPresetMenu() (*gtk.ComboBox, error) {
+	store, err := gtk.ListStoreNew(gdk.PixbufGetType(), glib.TYPE_STRING)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, preset := range programs.PalletPresets {
+		swatch, err := palletSwatch(preset.Gradient.Pallet(swatchWidth))
+		if err != nil {
+			return nil, err
+		}
+		if err := store.Set(store.Append(), []int{0, 1}, []interface{}{swatch, preset.Name}); err != nil {
+			return nil, err
+		}
+	}
+
+	menu, err := gtk.ComboBoxNewWithModel(store)
+	if err != nil {
+		return nil, err
+	}
+
+	swatch, _ := gtk.CellRendererPixbufNew()
+	menu.PackStart(swatch, false)
+	menu.AddAttribute(swatch, "pixbuf", 0)
+
+	name, _ := gtk.CellRendererTextNew()
+	menu.PackStart(name, true)
+	menu.AddAttribute(name, "text", 1)
+
+	return menu, nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/stewi1014/glfractal/programs"
+)
+
+// PalletGenerator is how the colour pallet is made.
+type PalletGenerator int
+
+const (
+	GenerateRandomWalk PalletGenerator = iota
+	GenerateGradient
+)
+
+var palletGeneratorNames = []string{"Random Walk", "Gradient"}
+
+func (g PalletGenerator) String() string { return palletGeneratorNames[g] }
+
+// gradientsFile returns where named gradients are saved.
+func gradientsFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "glfractal", "gradients.json"), nil
+}
+
+// loadGradients reads the saved gradients, by name.
+// There are none until the first is saved.
+func loadGradients() (map[string]programs.Gradient, error) {
+	gradients := make(map[string]programs.Gradient)
+
+	name, err := gradientsFile()
+	if err != nil {
+		return gradients, err
+	}
+
+	b, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return gradients, nil
+	}
+	if err != nil {
+		return gradients, err
+	}
+
+	return gradients, json.Unmarshal(b, &gradients)
+}
+
+// saveGradients replaces the saved gradients.
+func saveGradients(gradients map[string]programs.Gradient) error {
+	name, err := gradientsFile()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(gradients, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, b, 0o644)
+}
+
+// importPallet reads a pallet file from other software, picking the format by its extension.
+func importPallet(name string) (programs.Gradient, error) {
+	format, err := programs.PalletFormatOf(name)
+	if err != nil {
+		return programs.Gradient{}, err
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return programs.Gradient{}, err
+	}
+	defer file.Close()
+
+	gradient, err := programs.ReadPallet(file, format)
+	if err != nil {
+		return gradient, fmt.Errorf("%v: %w", name, err)
+	}
+	return gradient, nil
+}
+
+// exportPallet writes pallet for other software, in the format matching the extension of name.
+func exportPallet(name string, pallet programs.ColourPallet) error {
+	format, err := programs.PalletFormatOf(name)
+	if err != nil {
+		return err
+	}
+
+	title := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	return createFile(name, func(file *os.File) error {
+		return programs.WritePallet(file, format, title, pallet)
+	})
+}
+
+// loadPalletImage reads an image to extract a pallet from.
+func loadPalletImage(name string) (image.Image, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", name, err)
+	}
+	return img, nil
+}
+
+// palletImageSource describes a pallet extracted from the image name, to record where it came from.
+func palletImageSource(name string, opts programs.ExtractOptions) string {
+	return fmt.Sprintf("%v (%v colours by %v, ordered by %v)", name, opts.Colours, opts.Method, opts.Order)
+}
@@ -0,0 +1,580 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"image"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/go-gl/mathgl/mgl64"
+	"github.com/stewi1014/glfractal/programs"
+)
+
+// headlessFlags configure a render made from the command line without opening any windows.
+type headlessFlags struct {
+	output      string
+	animation   string
+	strip       string
+	video       string
+	fps         float64
+	decade      float64
+	expMap      bool
+	format      string
+	program     string
+	flame       string
+	width       int
+	height      int
+	zoom        float64
+	x, y        float64
+	iterations  uint
+	sliders     string
+	juliaC      string
+	roots       string
+	bailout     float64
+	bailoutTest string
+	camera      string
+	cameraAngle string
+	fieldOfView float64
+	sampling    string
+	orbits      float64
+	toneMap     string
+
+	colourSeed   int64
+	colourWalk   float64
+	colourStart  string
+	emptyColour  string
+	gradient     string
+	pallet       string
+	palletImage  string
+	imageColours int
+	imageMethod  string
+	imageOrder   string
+	palletLength int
+	palletScale  float64
+	palletOffset uint
+	palletLinear bool
+
+	supersample string
+	samples     int
+	filter      string
+	sampleSeed  int64
+	adaptive    bool
+	threshold   float64
+
+	bitDepth       int
+	dither         bool
+	metadata       bool
+	pngCompression string
+	jpegQuality    int
+}
+
+func (f *headlessFlags) register(set *flag.FlagSet) {
+	set.StringVar(&f.output, "render", "", "render to this file without opening any windows")
+	set.StringVar(&f.animation, "animation", "", "render the keyframes in this file to -render, which is - for stdout")
+	set.StringVar(&f.strip, "strip", "", "rebuild frames zooming into the centre of this exponential map, rendered with -expmap, to -render")
+	set.Float64Var(&f.fps, "fps", 30, "frame rate of frames rebuilt with -strip")
+	set.Float64Var(&f.decade, "decade-seconds", 2, "seconds to zoom in by each factor of ten with -strip")
+	set.BoolVar(&f.expMap, "expmap", false, "render an exponential map strip; -width goes once around the centre, and each -width of -height zooms in by e^2π")
+	set.StringVar(&f.video, "video", "", "animation output; one of "+strings.Join(videoFormatNames, ", ")+". Defaults to the format matching the -render extension, or PNG frames in a directory")
+	set.StringVar(&f.format, "format", "", "image format; one of "+strings.Join(imageFormatNames, ", ")+". Defaults to the format matching the file extension")
+	set.StringVar(&f.program, "program", "", "name of the program to render, or a hybrid such as \"Hybrid (2 Mandelbrot, Burning Ship)\". Defaults to the first program, or "+programs.FlameProgram+" with -flame")
+	set.StringVar(&f.flame, "flame", "", "render the first flame in this flam3 or Apophysis file; its view, quality, background and palette replace -zoom, -x, -y, -orbits, -empty-colour and the random pallet")
+	set.IntVar(&f.width, "width", 0, "width of the rendered image; 0 for 1920, or the width of the -flame")
+	set.IntVar(&f.height, "height", 0, "height of the rendered image; 0 for 1080, or the height of the -flame")
+	set.Float64Var(&f.zoom, "zoom", 2, "zoom level, smaller is further in")
+	set.Float64Var(&f.x, "x", 0, "horizontal position")
+	set.Float64Var(&f.y, "y", 0, "vertical position")
+	set.UintVar(&f.iterations, "iterations", 500, "maximum iterations")
+	set.StringVar(&f.sliders, "sliders", "", "comma separated slider values")
+	set.StringVar(&f.juliaC, "julia-c", "", "comma separated c of Julia set programs")
+	set.Float64Var(&f.bailout, "bailout", 0, "radius past which points have escaped; 0 for the program's default")
+	set.StringVar(&f.bailoutTest, "bailout-test", "", "what is compared to -bailout; one of "+strings.Join(programs.BailoutTestNames, ", ")+". Defaults to the program's test")
+	set.StringVar(&f.roots, "roots", "", "semicolon separated roots of the polynomial Newton's method programs solve, each a comma separated complex number")
+	set.StringVar(&f.camera, "camera", "", "comma separated position of the camera of 3D programs. Defaults to the program's")
+	set.StringVar(&f.cameraAngle, "camera-angle", "", "comma separated yaw and pitch in degrees of the camera of 3D programs, turning right and looking up from along -z")
+	set.Float64Var(&f.fieldOfView, "fov", 0, "field of view in degrees of 3D programs, across the longer side; 0 for the program's default")
+	set.StringVar(&f.sampling, "sampling", programs.SampleUniform.String(), "how density programs choose the points whose orbits they count; one of "+strings.Join(programs.DensitySamplingNames, ", "))
+	set.Float64Var(&f.orbits, "orbits", programs.DefaultDensitySamples, "orbits density programs count for each pixel")
+	set.StringVar(&f.toneMap, "tone-map", programs.ToneSquareRoot.String(), "how density programs turn counts into brightness; one of "+strings.Join(programs.ToneMapNames, ", "))
+
+	set.Int64Var(&f.colourSeed, "colour-seed", time.Now().Unix(), "seed for the random colour pallet")
+	set.Float64Var(&f.colourWalk, "colour-walk", 0.3, "random walk rate of the colour pallet")
+	set.StringVar(&f.colourStart, "colour-start", "", "comma separated starting RGB of the colour pallet")
+	set.StringVar(&f.gradient, "gradient", "", "colour with this gradient saved in the config window or built-in preset, instead of a random walk")
+	set.StringVar(&f.pallet, "pallet", "", "colour with this .map, .ugr, .ggr, .gpl, .csv or .json pallet file, instead of a random walk")
+	set.StringVar(&f.emptyColour, "empty-colour", "0.1,0.1,0.1", "comma separated RGB of empty space")
+	set.StringVar(&f.palletImage, "pallet-image", "", "colour with the dominant colours of this PNG or JPEG, instead of a random walk")
+	set.IntVar(&f.imageColours, "image-colours", 8, "number of colours to extract with -pallet-image")
+	set.StringVar(&f.imageMethod, "image-method", programs.ExtractKMeans.String(), "how -pallet-image colours are found; one of "+strings.Join(programs.ExtractMethodNames, ", "))
+	set.StringVar(&f.imageOrder, "image-order", programs.OrderLightness.String(), "how -pallet-image colours are ordered; one of "+strings.Join(programs.PalletOrderNames, ", "))
+	set.IntVar(&f.palletLength, "pallet-length", programs.DefaultPalletLength, "number of colours in the pallet")
+	set.Float64Var(&f.palletScale, "pallet-scale", 1, "colours moved along the pallet each iteration; less than 1 stretches the pallet over more iterations")
+	set.UintVar(&f.palletOffset, "pallet-offset", 0, "colours to shift the pallet by")
+	set.BoolVar(&f.palletLinear, "pallet-linear", false, "mix between pallet colours instead of taking the nearest")
+
+	set.StringVar(&f.supersample, "supersample", SampleGrid.String(), "supersampling pattern; one of "+strings.Join(samplePatternNames, ", "))
+	set.IntVar(&f.samples, "samples", 3, "supersamples along each axis")
+	set.StringVar(&f.filter, "filter", FilterBox.String(), "supersampling filter; one of "+strings.Join(sampleFilterNames, ", "))
+	set.Int64Var(&f.sampleSeed, "sample-seed", 0, "seed for jittered supersampling")
+	set.BoolVar(&f.adaptive, "adaptive", false, "only supersample pixels that differ from their neighbours")
+	set.Float64Var(&f.threshold, "threshold", 0.05, "colour difference that causes a pixel to be supersampled with -adaptive")
+
+	set.IntVar(&f.bitDepth, "depth", 8, "bits per colour channel; 8 or 16")
+	set.BoolVar(&f.dither, "dither", false, "dither 8 bit images to hide banding")
+	set.BoolVar(&f.metadata, "metadata", false, "write render statistics into PNG images")
+	set.StringVar(&f.pngCompression, "png-compression", pngCompressionNames[0], "PNG compression; one of "+strings.Join(pngCompressionNames, ", "))
+	set.IntVar(&f.jpegQuality, "quality", 90, "JPEG quality from 1 to 100")
+}
+
+func parseFloats(s string, n int) ([]float64, error) {
+	fields := strings.Split(s, ",")
+	if len(fields) > n {
+		return nil, fmt.Errorf("%q has more than %v values", s, n)
+	}
+
+	floats := make([]float64, len(fields))
+	for i, field := range fields {
+		var err error
+		floats[i], err = strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return floats, nil
+}
+
+func parseColour(s string) (mgl32.Vec3, error) {
+	floats, err := parseFloats(s, 3)
+	if err != nil {
+		return mgl32.Vec3{}, err
+	}
+	if len(floats) != 3 {
+		return mgl32.Vec3{}, fmt.Errorf("colour %q does not have 3 values", s)
+	}
+	return mgl32.Vec3{float32(floats[0]), float32(floats[1]), float32(floats[2])}, nil
+}
+
+// saveOptions returns the options to save with, where size is that of the -flame, if any.
+func (f *headlessFlags) saveOptions(size image.Point) (SaveOptions, error) {
+	opts := SaveOptions{
+		Name:        f.output,
+		Width:       cmp.Or(f.width, size.X, 1920),
+		Height:      cmp.Or(f.height, size.Y, 1080),
+		JPEGQuality: f.jpegQuality,
+		BitDepth:    f.bitDepth,
+		Dither:      f.dither,
+		Multithread: true,
+		Metadata:    f.metadata,
+		ExpMap:      f.expMap,
+		Supersample: SupersampleOptions{
+			Samples:   f.samples,
+			Seed:      f.sampleSeed,
+			Adaptive:  f.adaptive,
+			Threshold: float32(f.threshold),
+		},
+	}
+
+	if f.animation != "" || f.strip != "" {
+		opts.Format = FormatPNG
+	} else if f.format != "" {
+		format, err := parseEnum(imageFormatNames, f.format)
+		if err != nil {
+			return opts, err
+		}
+		opts.Format = ImageFormat(format)
+	} else {
+		ext := filepath.Ext(f.output)
+		opts.Format = -1
+		for i := range imageFormatNames {
+			if strings.EqualFold(ext, ImageFormat(i).Extension()) {
+				opts.Format = ImageFormat(i)
+				break
+			}
+		}
+		if opts.Format < 0 {
+			return opts, fmt.Errorf("unknown file extension %q, set -format", ext)
+		}
+	}
+
+	if f.bitDepth != 8 && f.bitDepth != 16 {
+		return opts, fmt.Errorf("bit depth must be 8 or 16, not %v", f.bitDepth)
+	}
+
+	compression, err := parseEnum(pngCompressionNames, f.pngCompression)
+	if err != nil {
+		return opts, err
+	}
+	opts.PNGCompression = pngCompressionLevels[compression]
+
+	pattern, err := parseEnum(samplePatternNames, f.supersample)
+	if err != nil {
+		return opts, err
+	}
+	opts.Supersample.Pattern = SamplePattern(pattern)
+
+	filter, err := parseEnum(sampleFilterNames, f.filter)
+	if err != nil {
+		return opts, err
+	}
+	opts.Supersample.Filter = SampleFilter(filter)
+
+	return opts, nil
+}
+
+func (f *headlessFlags) videoFormat() (VideoFormat, error) {
+	if f.video != "" {
+		format, err := parseEnum(videoFormatNames, f.video)
+		if err == nil && f.output == "-" && VideoFormat(format) == VideoPNGFrames {
+			err = fmt.Errorf("PNG frames can't be written to stdout")
+		}
+		if err == nil && f.output == "-" && VideoFormat(format) == VideoAVI {
+			// its sizes are filled in once every frame is written, which needs to seek back
+			err = fmt.Errorf("%v can't be written to stdout", VideoAVI)
+		}
+		return VideoFormat(format), err
+	}
+
+	ext := filepath.Ext(f.output)
+	for i := range videoFormatNames {
+		if ext != "" && strings.EqualFold(ext, VideoFormat(i).Extension()) {
+			return VideoFormat(i), nil
+		}
+	}
+	if f.output == "-" {
+		return 0, fmt.Errorf("set -video to render an animation to stdout")
+	}
+	return VideoPNGFrames, nil
+}
+
+// uniforms returns the uniforms to render program with, and the size of the image the -flame was made for, if any.
+func (f *headlessFlags) uniforms(program programs.Program) (programs.Uniforms, image.Point, error) {
+	var uniforms programs.Uniforms
+	var size image.Point
+	uniforms.DefaultValues()
+	uniforms.Zoom = f.zoom
+	uniforms.Pos = mgl64.Vec2{f.x, f.y}
+	uniforms.Iterations = uint32(f.iterations)
+	uniforms.PalletScale = float32(f.palletScale)
+	uniforms.PalletOffset = uint32(f.palletOffset)
+	uniforms.PalletLinear = f.palletLinear
+
+	if f.palletLength < 1 {
+		return uniforms, size, fmt.Errorf("pallet length must be at least 1, not %v", f.palletLength)
+	}
+
+	uniforms.SetBailout(program.DefaultBailout())
+	uniforms.Sliders = program.DefaultSliders()
+	if program.Is3D() {
+		uniforms.SetCamera3D(program.Camera3D)
+	}
+
+	if f.sliders != "" {
+		sliders, err := parseFloats(f.sliders, len(uniforms.Sliders))
+		if err != nil {
+			return uniforms, size, err
+		}
+		copy(uniforms.Sliders[:], sliders)
+	}
+
+	if f.juliaC != "" {
+		c, err := parseFloats(f.juliaC, 2)
+		if err != nil {
+			return uniforms, size, err
+		}
+		copy(uniforms.JuliaC[:], c)
+	}
+
+	// 0 is left for the program's default
+	if f.bailout < 0 {
+		return uniforms, size, fmt.Errorf("bailout radius must be positive, not %v", f.bailout)
+	}
+	if f.bailout != 0 {
+		uniforms.Bailout = f.bailout
+	}
+	if f.bailoutTest != "" {
+		test, err := parseEnum(programs.BailoutTestNames, f.bailoutTest)
+		if err != nil {
+			return uniforms, size, err
+		}
+		uniforms.BailoutTest = programs.BailoutTest(test)
+	}
+
+	if f.roots != "" {
+		roots := strings.Split(f.roots, ";")
+		if len(roots) > programs.MaxRoots {
+			return uniforms, size, fmt.Errorf("%q has more than %v roots", f.roots, programs.MaxRoots)
+		}
+		for i, root := range roots {
+			r, err := parseFloats(root, 2)
+			if err != nil {
+				return uniforms, size, err
+			}
+			uniforms.Roots[i] = mgl64.Vec2{}
+			copy(uniforms.Roots[i][:], r)
+		}
+		uniforms.RootCount = uint32(len(roots))
+	}
+
+	if f.camera != "" {
+		position, err := parseFloats(f.camera, 3)
+		if err != nil {
+			return uniforms, size, err
+		}
+		copy(uniforms.CameraPos[:], position)
+	}
+	if f.cameraAngle != "" {
+		angle, err := parseFloats(f.cameraAngle, 2)
+		if err != nil {
+			return uniforms, size, err
+		}
+		uniforms.CameraYaw = angle[0]
+		if len(angle) > 1 {
+			uniforms.CameraPitch = angle[1]
+		}
+	}
+	if f.fieldOfView != 0 {
+		uniforms.FieldOfView = f.fieldOfView
+	}
+
+	sampling, err := parseEnum(programs.DensitySamplingNames, f.sampling)
+	if err != nil {
+		return uniforms, size, err
+	}
+	uniforms.DensitySampling = programs.DensitySampling(sampling)
+	toneMap, err := parseEnum(programs.ToneMapNames, f.toneMap)
+	if err != nil {
+		return uniforms, size, err
+	}
+	uniforms.ToneMap = programs.ToneMap(toneMap)
+	if f.orbits <= 0 {
+		return uniforms, size, fmt.Errorf("orbits per pixel must be positive, not %v", f.orbits)
+	}
+	uniforms.DensitySamples = f.orbits
+
+	random := rand.New(rand.NewSource(f.colourSeed))
+	start := mgl32.Vec3{random.Float32(), random.Float32(), random.Float32()}
+	if f.colourStart != "" {
+		var err error
+		start, err = parseColour(f.colourStart)
+		if err != nil {
+			return uniforms, size, err
+		}
+	}
+	uniforms.ColourPallet = programs.RandomColourPallet(
+		start,
+		float32(f.colourWalk),
+		rand.New(rand.NewSource(f.colourSeed)),
+		f.palletLength,
+	)
+
+	if uniforms.EmptyColour, err = parseColour(f.emptyColour); err != nil {
+		return uniforms, size, err
+	}
+
+	if f.flame != "" {
+		if size.X, size.Y, err = loadFlame(f.flame, &uniforms); err != nil {
+			return uniforms, size, err
+		}
+	}
+
+	if f.gradient != "" {
+		gradients, err := loadGradients()
+		if err != nil {
+			return uniforms, size, err
+		}
+		gradient, ok := gradients[f.gradient]
+		if !ok {
+			gradient, ok = programs.PalletPresetByName(f.gradient)
+		}
+		if !ok {
+			return uniforms, size, fmt.Errorf("no gradient or preset named %q", f.gradient)
+		}
+		uniforms.ColourPallet = gradient.Pallet(f.palletLength)
+	}
+
+	if f.pallet != "" {
+		gradient, err := importPallet(f.pallet)
+		if err != nil {
+			return uniforms, size, err
+		}
+		uniforms.ColourPallet = gradient.Pallet(f.palletLength)
+		uniforms.PalletSource = f.pallet
+	}
+
+	if f.palletImage != "" {
+		method, err := parseEnum(programs.ExtractMethodNames, f.imageMethod)
+		if err != nil {
+			return uniforms, size, err
+		}
+		order, err := parseEnum(programs.PalletOrderNames, f.imageOrder)
+		if err != nil {
+			return uniforms, size, err
+		}
+		opts := programs.ExtractOptions{
+			Colours: f.imageColours,
+			Method:  programs.ExtractMethod(method),
+			Order:   programs.PalletOrder(order),
+		}
+
+		img, err := loadPalletImage(f.palletImage)
+		if err != nil {
+			return uniforms, size, err
+		}
+		gradient, err := programs.ExtractPallet(img, opts)
+		if err != nil {
+			return uniforms, size, err
+		}
+		uniforms.ColourPallet = gradient.Pallet(f.palletLength)
+		uniforms.PalletSource = palletImageSource(f.palletImage, opts)
+	}
+
+	return uniforms, size, nil
+}
+
+// programName returns the name of the program to render, which -flame chooses unless -program names another.
+func (f *headlessFlags) programName() (string, error) {
+	if f.flame == "" {
+		return cmp.Or(f.program, programs.GetProgram(0).Name), nil
+	}
+	if f.program != "" && f.program != programs.FlameProgram {
+		return "", fmt.Errorf("-flame renders with %v, not %v", programs.FlameProgram, f.program)
+	}
+	return programs.FlameProgram, nil
+}
+
+// renderHeadless renders the image described by f, logging progress as it goes.
+func renderHeadless(ctx context.Context, f *headlessFlags) error {
+	name, err := f.programName()
+	if err != nil {
+		return err
+	}
+	program, ok := programs.ProgramByName(name)
+	if !ok {
+		return fmt.Errorf("no program named %q", name)
+	}
+
+	// animations bring their own uniforms
+	var uniforms programs.Uniforms
+	var size image.Point
+	if f.animation == "" {
+		if uniforms, size, err = f.uniforms(program); err != nil {
+			return err
+		}
+	}
+
+	opts, err := f.saveOptions(size)
+	if err != nil {
+		return err
+	}
+
+	if f.animation != "" || f.strip != "" {
+		return renderHeadlessFrames(ctx, f, opts, uniforms)
+	}
+
+	file, err := os.Create(opts.Name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stats, err := renderTo(ctx, file, opts, program, uniforms, progressLog{}, nil)
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	log.Printf("saved %v: %v", file.Name(), stats)
+	return file.Close()
+}
+
+// renderHeadlessFrames renders the animation or exponential map zoom described by f,
+// where uniforms are those of the zoom.
+func renderHeadlessFrames(ctx context.Context, f *headlessFlags, opts SaveOptions, uniforms programs.Uniforms) error {
+	format, err := f.videoFormat()
+	if err != nil {
+		return err
+	}
+
+	var animation *Animation
+	var frames int
+	var fps float64
+	var source frameSource
+
+	if f.strip != "" {
+		if f.fps <= 0 || f.decade <= 0 {
+			return fmt.Errorf("-fps and -decade-seconds must be positive")
+		}
+
+		strip, err := LoadStrip(f.strip)
+		if err != nil {
+			return err
+		}
+
+		fps = f.fps
+		frames, source = stripFrames(strip, uniforms, opts, fps, f.decade)
+	} else {
+		animation, err = LoadAnimation(f.animation)
+		if err != nil {
+			return err
+		}
+
+		frames, fps = animation.Frames(), animation.FPS
+		source = animationFrames(animation, cpuFrameImage(opts))
+	}
+
+	start := time.Now()
+	switch {
+	case format == VideoPNGFrames && animation != nil:
+		err = renderFrames(ctx, f.output, animation, cpuFrameRenderer(opts), progressLog{})
+	case format == VideoPNGFrames:
+		err = saveFrames(ctx, f.output, frames, source, opts, progressLog{})
+	case f.output == "-":
+		err = renderVideo(ctx, os.Stdout, format, frames, fps, source, opts, progressLog{})
+	default:
+		err = renderVideoFile(ctx, f.output, format, frames, fps, source, opts, progressLog{})
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("rendered %v frames to %v in %v", frames, f.output, time.Since(start))
+	return nil
+}
+
+// progressLog logs the progress of each stage in place of a progress bar.
+type progressLog struct{}
+
+func (progressLog) AddProgressSupplier(ctx context.Context, supplier func() Progress, description string) {
+	go func() {
+		ticker := time.NewTicker(time.Second * 2)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				progress := supplier()
+				if progress.Fraction >= 1 {
+					log.Printf("%v: finished in %v", description, progress.Elapsed.Round(time.Millisecond))
+					return
+				}
+				if progress.Fraction > 0 {
+					log.Printf("%v: %.1f%% (%v)", description, progress.Fraction*100, progress)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -5,12 +5,16 @@ import (
 	"fmt"
 	"image"
 	"image/color"
+	"image/jpeg"
 	"image/png"
+	"io"
 	"log"
 	"os"
 	"runtime"
+	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 
 	"github.com/go-gl/mathgl/mgl32"
@@ -20,7 +24,7 @@ import (
 	"github.com/stewi1014/glfractal/programs"
 )
 
-func WrapWithProgress(img *image.Image) func() float64 {
+func WrapWithProgress(img *image.Image) func() Progress {
 	p := &ProgressImage{
 		Image: *img,
 	}
@@ -32,59 +36,46 @@ func WrapWithProgress(img *image.Image) func() float64 {
 type ProgressImage struct {
 	image.Image
 	count atomic.Uint64
+	start atomic.Int64
+	end   atomic.Int64
 }
 
 func (i *ProgressImage) At(x, y int) color.Color {
-	i.count.Add(1)
-	return i.Image.At(x, y)
-}
-
-func (i *ProgressImage) Progress() float64 {
-	end := i.Bounds().Dx() * i.Bounds().Dy()
-	return float64(i.count.Load()) / float64(end)
-}
+	if i.start.Load() == 0 {
+		i.start.CompareAndSwap(0, time.Now().UnixNano())
+	}
 
-func (i *ProgressImage) Opaque() bool {
-	return true
+	c := i.Image.At(x, y)
+	if i.count.Add(1) == i.pixels() {
+		i.end.Store(time.Now().UnixNano())
+	}
+	return c
 }
 
-// AntiAlias9x samples 9 posititions for each sampled position,
-// returning the average colour.
-//
-// antialias is the number of pixels apart the sampled locations are.
-func AntiAlias9x(img programs.Image, antialias float32) programs.Image {
-	if antialias == 0 {
-		log.Println("image uselessly antialiased with distance of 0")
+func (i *ProgressImage) Progress() Progress {
+	count := i.count.Load()
+	progress := Progress{
+		Fraction: float64(count) / float64(i.pixels()),
+		Samples:  count,
 	}
 
-	scaleFactor := float32(img.Bounds().Dx())
-	if img.Bounds().Dy() > img.Bounds().Dx() {
-		scaleFactor = float32(img.Bounds().Dy())
+	if start := i.start.Load(); start != 0 {
+		end := i.end.Load()
+		if end == 0 {
+			end = time.Now().UnixNano()
+		}
+		progress.Elapsed = time.Duration(end - start)
 	}
 
-	return &antialias9xImage{
-		Image:  img,
-		offset: antialias / scaleFactor,
-	}
+	return progress
 }
 
-type antialias9xImage struct {
-	programs.Image
-	offset float32
+func (i *ProgressImage) pixels() uint64 {
+	return uint64(i.Bounds().Dx() * i.Bounds().Dy())
 }
 
-func (i *antialias9xImage) GetPixel(pos mgl32.Vec2) mgl32.Vec3 {
-	avg := mgl32.Vec3{}
-	avg = avg.Add(i.Image.GetPixel(mgl32.Vec2{pos[0] + i.offset, pos[1] + i.offset}))
-	avg = avg.Add(i.Image.GetPixel(mgl32.Vec2{pos[0] + i.offset, pos[1]}))
-	avg = avg.Add(i.Image.GetPixel(mgl32.Vec2{pos[0] + i.offset, pos[1] - i.offset}))
-	avg = avg.Add(i.Image.GetPixel(mgl32.Vec2{pos[0], pos[1] + i.offset}))
-	avg = avg.Add(i.Image.GetPixel(mgl32.Vec2{pos[0], pos[1]}))
-	avg = avg.Add(i.Image.GetPixel(mgl32.Vec2{pos[0], pos[1] - i.offset}))
-	avg = avg.Add(i.Image.GetPixel(mgl32.Vec2{pos[0] - i.offset, pos[1] + i.offset}))
-	avg = avg.Add(i.Image.GetPixel(mgl32.Vec2{pos[0] - i.offset, pos[1]}))
-	avg = avg.Add(i.Image.GetPixel(mgl32.Vec2{pos[0] - i.offset, pos[1] - i.offset}))
-	return avg.Mul(1 / float32(9))
+func (i *ProgressImage) Opaque() bool {
+	return true
 }
 
 func BufferImage(img image.Image) *BufferedImage {
@@ -93,11 +84,15 @@ func BufferImage(img image.Image) *BufferedImage {
 	}
 }
 
+// BufferedImage holds a rendered copy of an image.
+// 8 bit images are buffered in a gdk.Pixbuf,
+// while 16 bit images are buffered in memory and scaled down by hand for previews.
 type BufferedImage struct {
 	image.Image
 	rowstride int
 	buff      *gdk.Pixbuf
 	asSlice   []byte
+	deep      bool
 }
 
 func (b *BufferedImage) Bounds() image.Rectangle {
@@ -105,11 +100,20 @@ func (b *BufferedImage) Bounds() image.Rectangle {
 }
 
 func (b *BufferedImage) At(x, y int) color.Color {
+	if b.deep {
+		return *(*color.NRGBA64)(unsafe.Pointer(&b.asSlice[y*b.rowstride+x*8]))
+	}
 	return (*color.NRGBA)(unsafe.Pointer(&b.asSlice[y*b.rowstride+x*4]))
 }
 
-func (b *BufferedImage) Buffer(ctx context.Context) error {
-	ctx, quit := WithErrorDialogCancelCause(nil, ctx)
+// allocate makes the buffer, as a pixbuf that can be shown unless the image is 16 bit.
+func (b *BufferedImage) allocate() error {
+	if b.Image.ColorModel() == color.NRGBA64Model {
+		b.deep = true
+		b.rowstride = b.Bounds().Dx() * 8
+		b.asSlice = make([]byte, b.rowstride*b.Bounds().Dy())
+		return nil
+	}
 
 	var err error
 	b.buff, err = gdk.PixbufNew(
@@ -129,6 +133,23 @@ func (b *BufferedImage) Buffer(ctx context.Context) error {
 
 	b.rowstride = b.buff.GetRowstride()
 	b.asSlice = b.buff.GetPixels()
+	return nil
+}
+
+func (b *BufferedImage) Buffer(ctx context.Context) error {
+	ctx, quit := WithErrorDialogCancelCause(nil, ctx)
+
+	pixelSize := 4
+	if b.Image.ColorModel() == color.NRGBA64Model {
+		pixelSize = 8
+	}
+
+	// buffers are filled again in place, so density renders can show their progress
+	if b.asSlice == nil {
+		if err := b.allocate(); err != nil {
+			return err
+		}
+	}
 
 	min, max := b.Image.Bounds().Min, b.Image.Bounds().Max
 	chunkSize := 50 * 2000 / image.Black.Bounds().Dx()
@@ -136,12 +157,7 @@ func (b *BufferedImage) Buffer(ctx context.Context) error {
 		chunkSize = 1
 	}
 
-	numThreads := int(float64(runtime.NumCPU()-1) * .9)
-	if numThreads < 1 {
-		numThreads = 1
-	}
-
-	threads := make(chan struct{}, numThreads)
+	threads := make(chan struct{}, renderThreads())
 	var wg sync.WaitGroup
 
 	for chunkMin := min.Y; chunkMin < max.Y; chunkMin += chunkSize {
@@ -160,14 +176,16 @@ func (b *BufferedImage) Buffer(ctx context.Context) error {
 				return
 			}
 
-			i := (chunkMin - min.Y) * b.rowstride
 			for y := chunkMin; y < chunkMax; y++ {
+				i := (y - min.Y) * b.rowstride
 				for x := min.X; x < max.X; x++ {
-					c := b.Image.At(x, y)
-					if nrgba, ok := c.(color.NRGBA); ok {
-						*(*color.NRGBA)(unsafe.Pointer(&b.asSlice[i])) = nrgba
+					switch c := b.Image.At(x, y).(type) {
+					case color.NRGBA:
+						*(*color.NRGBA)(unsafe.Pointer(&b.asSlice[i])) = c
+					case color.NRGBA64:
+						*(*color.NRGBA64)(unsafe.Pointer(&b.asSlice[i])) = c
 					}
-					i += 4
+					i += pixelSize
 				}
 			}
 		}()
@@ -178,11 +196,25 @@ func (b *BufferedImage) Buffer(ctx context.Context) error {
 	return ctx.Err()
 }
 
+// renderThreads returns the number of goroutines used to buffer an image.
+func renderThreads() int {
+	numThreads := int(float64(runtime.NumCPU()-1) * .9)
+	if numThreads < 1 {
+		numThreads = 1
+	}
+	return numThreads
+}
+
 func (i *BufferedImage) Opaque() bool {
 	return true
 }
 
 func (i *BufferedImage) Scale(dest *gdk.Pixbuf, width, height int, interpType gdk.InterpType) {
+	if i.deep {
+		i.scaleDeep(dest, width, height)
+		return
+	}
+
 	if i.buff == nil {
 		return
 	}
@@ -199,41 +231,110 @@ func (i *BufferedImage) Scale(dest *gdk.Pixbuf, width, height int, interpType gd
 	)
 }
 
-func ToImage(img programs.Image) image.Image {
-	scaleFactor := img.Bounds().Dx()
-	if img.Bounds().Dy() > img.Bounds().Dx() {
-		scaleFactor = img.Bounds().Dy()
+// scaleDeep does a nearest neighbour scale of the 16 bit buffer into the 8 bit dest.
+func (i *BufferedImage) scaleDeep(dest *gdk.Pixbuf, width, height int) {
+	if dest.GetNChannels() != 4 {
+		return
 	}
 
+	pixels := dest.GetPixels()
+	rowstride := dest.GetRowstride()
+	bounds := i.Bounds()
+
+	for y := 0; y < height; y++ {
+		sy := y * bounds.Dy() / height
+		for x := 0; x < width; x++ {
+			sx := x * bounds.Dx() / width
+			c := *(*color.NRGBA64)(unsafe.Pointer(&i.asSlice[sy*i.rowstride+sx*8]))
+			copy(pixels[y*rowstride+x*4:], []byte{
+				uint8(c.R >> 8),
+				uint8(c.G >> 8),
+				uint8(c.B >> 8),
+				uint8(c.A >> 8),
+			})
+		}
+	}
+}
+
+// ToImage converts img to an image.Image with the given bits per channel, either 8 or 16.
+//
+// If dither is set, 8 bit images are ordered dithered to hide banding.
+func ToImage(img programs.Image, bitDepth int, dither bool) image.Image {
 	return &imageImage{
 		Image:       img,
-		scaleFactor: float32(scaleFactor) / 2,
+		scaleFactor: pixelScale(img.Bounds()),
+		deep:        bitDepth == 16,
+		dither:      dither,
 	}
 }
 
 type imageImage struct {
 	programs.Image
 	scaleFactor float32
+	deep        bool
+	dither      bool
 }
 
-func (i *imageImage) At(x, y int) color.Color {
+var bayer8x8 = [8][8]uint8{
+	{0, 32, 8, 40, 2, 34, 10, 42},
+	{48, 16, 56, 24, 50, 18, 58, 26},
+	{12, 44, 4, 36, 14, 46, 6, 38},
+	{60, 28, 52, 20, 62, 30, 54, 22},
+	{3, 35, 11, 43, 1, 33, 9, 41},
+	{51, 19, 59, 27, 49, 17, 57, 25},
+	{15, 47, 7, 39, 13, 45, 5, 37},
+	{63, 31, 55, 23, 61, 29, 53, 21},
+}
+
+// pixelScale returns the number of pixels per unit of programs.Image position.
+func pixelScale(bounds image.Rectangle) float32 {
+	scaleFactor := bounds.Dx()
+	if bounds.Dy() > bounds.Dx() {
+		scaleFactor = bounds.Dy()
+	}
+	return float32(scaleFactor) / 2
+}
+
+// pixelPos returns the programs.Image position of pixel x, y.
+func pixelPos(scaleFactor float32, x, y int) mgl32.Vec2 {
 	// oh how I wish I understood why this was needed
 	y = -y
 
-	c := i.GetPixel(mgl32.Vec2{
-		float32(x) / i.scaleFactor,
-		float32(y) / i.scaleFactor,
-	})
+	return mgl32.Vec2{
+		float32(x) / scaleFactor,
+		float32(y) / scaleFactor,
+	}
+}
+
+func (i *imageImage) At(x, y int) color.Color {
+	c := i.GetPixel(pixelPos(i.scaleFactor, x, y))
+
+	if i.deep {
+		return color.NRGBA64{
+			R: uint16(limit(c[0])*0xffff + .5),
+			G: uint16(limit(c[1])*0xffff + .5),
+			B: uint16(limit(c[2])*0xffff + .5),
+			A: 0xffff,
+		}
+	}
+
+	threshold := float32(.5)
+	if i.dither {
+		threshold = (float32(bayer8x8[y&7][x&7]) + .5) / 64
+	}
 
 	return color.NRGBA{
-		R: uint8(c[0] * 255),
-		G: uint8(c[1] * 255),
-		B: uint8(c[2] * 255),
+		R: uint8(limit(c[0])*255 + threshold),
+		G: uint8(limit(c[1])*255 + threshold),
+		B: uint8(limit(c[2])*255 + threshold),
 		A: 0xff,
 	}
 }
 
 func (i *imageImage) ColorModel() color.Model {
+	if i.deep {
+		return color.NRGBA64Model
+	}
 	return color.NRGBAModel
 }
 
@@ -242,10 +343,54 @@ func (i *imageImage) Opaque() bool {
 }
 
 type SaveOptions struct {
-	Name          string
-	Width, Height int
-	Antialias     float32
-	Multithread   bool
+	Name           string
+	Width, Height  int
+	Format         ImageFormat
+	PNGCompression png.CompressionLevel
+	JPEGQuality    int
+	Supersample    SupersampleOptions
+	BitDepth       int
+	Dither         bool
+	Multithread    bool
+	Metadata       bool
+	ExpMap         bool // render an exponential map strip of the view
+}
+
+// progressReporter is told about each stage of a render as it starts.
+type progressReporter interface {
+	AddProgressSupplier(context.Context, func() Progress, string)
+}
+
+// RenderStats describes a finished render.
+type RenderStats struct {
+	Duration time.Duration
+	Pixels   int
+	Threads  int
+}
+
+func (s RenderStats) PixelsPerSecond() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return float64(s.Pixels) / s.Duration.Seconds()
+}
+
+func (s RenderStats) String() string {
+	return fmt.Sprintf(
+		"%v pixels in %v (%v px/s) using %v threads",
+		s.Pixels,
+		s.Duration.Round(time.Millisecond),
+		formatSI(s.PixelsPerSecond()),
+		s.Threads,
+	)
+}
+
+func (s RenderStats) textChunks() []pngChunk {
+	return []pngChunk{
+		textChunk("Render Time", s.Duration.String()),
+		textChunk("Pixels Per Second", fmt.Sprintf("%.0f", s.PixelsPerSecond())),
+		textChunk("Threads", strconv.Itoa(s.Threads)),
+	}
 }
 
 func save(
@@ -300,47 +445,27 @@ func save(
 		}
 	}
 
-	image, err := program.GetImage(uniforms, opts.Width, opts.Height)
-	if err != nil {
-		cancel(err)
-		return
-	}
-
 	go func() {
 		defer CatchPanicToContext(cancel)
-		if opts.Antialias > 0 {
-			image = AntiAlias9x(image, opts.Antialias)
-		}
-
-		imageImage := ToImage(image)
-
-		if opts.Multithread {
-			progressWindow.AddProgressSupplier(ctx, WrapWithProgress(&imageImage), "Rendering to Buffer")
-			buff := BufferImage(imageImage)
-			imageImage = buff
-			progressWindow.AddProgressSupplier(ctx, WrapWithProgress(&imageImage), "Encoding PNG")
 
+		stats, err := renderTo(ctx, file, opts, program, uniforms, progressWindow, func(buff *BufferedImage) {
 			if imageWindow, ok := progressWindow.(*ImagePreviewWindow); ok {
 				imageWindow.SetImageSupplier(ctx, func(dest *gdk.Pixbuf) {
 					buff.Scale(dest, dest.GetWidth(), dest.GetHeight(), gdk.INTERP_NEAREST)
 				})
 			}
-
-			err = buff.Buffer(ctx)
-			if err != nil {
-				cancel(err)
-				return
-			}
-		} else {
-			progressWindow.AddProgressSupplier(ctx, WrapWithProgress(&imageImage), "Rendering to PNG")
-		}
-
-		err = png.Encode(file, imageImage)
+		})
 		if err != nil {
 			cancel(err)
 			return
 		}
 
+		log.Printf("saved %v: %v", file.Name(), stats)
+
+		if imageWindow, ok := progressWindow.(*ImagePreviewWindow); ok {
+			imageWindow.SetFinished(stats.String())
+		}
+
 		if progressBarDialog, ok := progressWindow.(*ProgressBarDialog); ok {
 			glib.IdleAdd(func() {
 				progressBarDialog.Destroy()
@@ -362,8 +487,144 @@ func save(
 				}
 
 				previewWindow.OpenImage(file.Name())
-				previewWindow.SetFinished("Finished")
+				previewWindow.SetFinished(stats.String())
 			})
 		}
 	}()
 }
+
+// renderTo renders program to w as configured by opts,
+// reporting the progress of each stage to progress.
+//
+// If opts.Multithread is set the image is buffered first,
+// and onBuffer is called with the buffer before it is filled.
+func renderTo(
+	ctx context.Context,
+	w io.Writer,
+	opts SaveOptions,
+	program programs.Program,
+	uniforms programs.Uniforms,
+	progress progressReporter,
+	onBuffer func(*BufferedImage),
+) (RenderStats, error) {
+	if opts.Format.IsRaw() {
+		return renderRawTo(ctx, w, opts, program, uniforms, progress)
+	}
+
+	stats := RenderStats{
+		Pixels:  opts.Width * opts.Height,
+		Threads: 1,
+	}
+	start := time.Now()
+
+	if opts.Format == FormatWebP && (opts.Width > maxWebPSize || opts.Height > maxWebPSize) {
+		return stats, ErrWebPTooLarge
+	}
+
+	var imageImage image.Image
+	var err error
+	if program.Density != nil {
+		imageImage, stats.Threads, err = renderDensity(ctx, opts, program, uniforms, progress, onBuffer)
+		if err == nil {
+			progress.AddProgressSupplier(ctx, WrapWithProgress(&imageImage), "Encoding "+opts.Format.String())
+		}
+	} else {
+		imageImage, stats.Threads, err = renderImage(ctx, opts, program, uniforms, progress, onBuffer)
+	}
+	if err != nil {
+		return stats, err
+	}
+
+	parameters := renderParameters(program, uniforms)
+
+	switch opts.Format {
+	case FormatJPEG:
+		err = jpeg.Encode(
+			&jpegCommentWriter{w: w, comment: parametersText(parameters)},
+			imageImage,
+			&jpeg.Options{Quality: opts.JPEGQuality},
+		)
+
+	case FormatTIFF:
+		err = encodeTIFF(w, imageImage, parametersText(parameters))
+
+	case FormatWebP:
+		err = encodeWebP(w, imageImage, xmpPacket(parametersText(parameters)))
+
+	default:
+		var trailer func() []pngChunk
+		if opts.Metadata {
+			trailer = func() []pngChunk {
+				stats.Duration = time.Since(start)
+				return stats.textChunks()
+			}
+		}
+		err = encodePNG(w, imageImage, opts.PNGCompression, parameters, trailer)
+	}
+
+	stats.Duration = time.Since(start)
+	return stats, err
+}
+
+// renderImage renders program pixel by pixel as configured by opts,
+// returning the image with the number of threads that rendered it.
+//
+// If opts.Multithread is set the image is buffered first,
+// and onBuffer is called with the buffer before it is filled.
+func renderImage(
+	ctx context.Context,
+	opts SaveOptions,
+	program programs.Program,
+	uniforms programs.Uniforms,
+	progress progressReporter,
+	onBuffer func(*BufferedImage),
+) (image.Image, int, error) {
+	image, err := program.GetImage(uniforms, opts.Width, opts.Height)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if opts.ExpMap {
+		image = ExpMap(image)
+	}
+	image = Supersample(image, opts.Supersample)
+	imageImage := ToImage(image, opts.BitDepth, opts.Dither)
+
+	if !opts.Multithread {
+		progress.AddProgressSupplier(ctx, WrapWithProgress(&imageImage), "Rendering to "+opts.Format.String())
+		return imageImage, 1, nil
+	}
+
+	progress.AddProgressSupplier(ctx, WrapWithProgress(&imageImage), "Rendering to Buffer")
+	buff := BufferImage(imageImage)
+	imageImage = buff
+	progress.AddProgressSupplier(ctx, WrapWithProgress(&imageImage), "Encoding "+opts.Format.String())
+
+	if onBuffer != nil {
+		onBuffer(buff)
+	}
+
+	return imageImage, renderThreads(), buff.Buffer(ctx)
+}
+
+// encodePNG encodes img with parameters as text chunks.
+// If trailer is not nil, the chunks it returns are written after the image data.
+func encodePNG(
+	w io.Writer,
+	img image.Image,
+	compression png.CompressionLevel,
+	parameters []renderParameter,
+	trailer func() []pngChunk,
+) error {
+	metadata := &pngMetadataWriter{
+		w:       w,
+		header:  colourSpaceChunks(),
+		trailer: trailer,
+	}
+	for _, p := range parameters {
+		metadata.header = append(metadata.header, textChunk(p.key, p.value))
+	}
+
+	encoder := png.Encoder{CompressionLevel: compression}
+	return encoder.Encode(metadata, img)
+}
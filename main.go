@@ -4,6 +4,7 @@ import (
 	"context"
 	_ "embed"
 	"encoding/gob"
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -43,9 +44,24 @@ func getDisplaySize() (width, height int) {
 func init() {
 	gob.Register(&programs.Uniforms{})
 	gob.Register(&programs.Program{})
+	gob.Register(&FrameRequest{})
+	gob.Register(&Frame{})
+	gob.Register(&PalletCycle{})
+	gob.Register(&CameraControl{})
 }
 
 func main() {
+	var headless headlessFlags
+	headless.register(flag.CommandLine)
+	flag.Parse()
+
+	if headless.output != "" {
+		if err := renderHeadless(context.Background(), &headless); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	mainContext, mainQuit := context.WithCancelCause(context.Background())
 
 	go func() {
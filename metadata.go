@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/stewi1014/glfractal/programs"
+)
+
+type renderParameter struct {
+	key   string
+	value string
+}
+
+// renderParameters describes a render well enough to reproduce it.
+func renderParameters(program programs.Program, uniforms programs.Uniforms) []renderParameter {
+	float := func(f float64) string {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	floats := func(f ...float64) string {
+		s := make([]string, len(f))
+		for i := range f {
+			s[i] = float(f[i])
+		}
+		return strings.Join(s, ", ")
+	}
+
+	var pallet strings.Builder
+	for _, c := range uniforms.ColourPallet {
+		fmt.Fprintf(&pallet, "%02x%02x%02x", uint8(c[0]*255+.5), uint8(c[1]*255+.5), uint8(c[2]*255+.5))
+	}
+
+	roots := make([]string, min(max(uniforms.RootCount, 1), programs.MaxRoots))
+	for i := range roots {
+		roots[i] = floats(uniforms.Roots[i][:]...)
+	}
+
+	parameters := []renderParameter{
+		{"Software", "glfractal"},
+		{"Program", program.Name},
+		{"Zoom", float(uniforms.Zoom)},
+		{"Position", floats(uniforms.Pos[:]...)},
+		{"Iterations", strconv.Itoa(int(uniforms.Iterations))},
+		{"Sliders", floats(uniforms.Sliders[:]...)},
+		{"Julia C", floats(uniforms.JuliaC[:]...)},
+		{"Roots", strings.Join(roots, "; ")},
+		{"Bailout", fmt.Sprintf("%v > %v", uniforms.BailoutTest, float(uniforms.Bailout))},
+		{"Empty Colour", floats(float64(uniforms.EmptyColour[0]), float64(uniforms.EmptyColour[1]), float64(uniforms.EmptyColour[2]))},
+		{"Colour Pallet", pallet.String()},
+		{"Pallet Scale", float(float64(uniforms.PalletScale))},
+		{"Pallet Offset", strconv.Itoa(int(uniforms.PalletOffset))},
+		{"Linear Pallet", strconv.FormatBool(uniforms.PalletLinear)},
+	}
+	if program.Is3D() {
+		parameters = append(parameters, renderParameter{"Camera", fmt.Sprintf(
+			"%v; yaw %v, pitch %v, field of view %v",
+			floats(uniforms.CameraPos[:]...), float(uniforms.CameraYaw), float(uniforms.CameraPitch), float(uniforms.FieldOfView),
+		)})
+	}
+	if program.Density != nil {
+		parameters = append(parameters, renderParameter{"Density", fmt.Sprintf(
+			"%v orbits per pixel, %v sampling, %v tone map",
+			float(uniforms.DensitySamples), uniforms.DensitySampling, uniforms.ToneMap,
+		)})
+	}
+	if program.IsFlame() {
+		// each transform by its weight, colour, affines in flam3's order and variations
+		transformText := func(t *programs.FlameTransform) string {
+			variations := make([]string, len(t.Variations))
+			for i, v := range t.Variations {
+				variations[i] = fmt.Sprintf("%v %v", v.Kind, float(v.Weight))
+			}
+			return fmt.Sprintf(
+				"weight %v, colour %v, speed %v, coefs %v, post %v, %v",
+				float(t.Weight), float(t.Colour), float(t.ColourSpeed),
+				floats(t.Affine[:]...), floats(t.Post[:]...), strings.Join(variations, ", "),
+			)
+		}
+
+		flame := &uniforms.Flame
+		transforms := make([]string, len(flame.Transforms))
+		for i := range flame.Transforms {
+			transforms[i] = transformText(&flame.Transforms[i])
+		}
+		if flame.Final != nil {
+			transforms = append(transforms, "final "+transformText(flame.Final))
+		}
+		parameters = append(parameters,
+			renderParameter{"Flame", fmt.Sprintf(
+				"brightness %v, gamma %v, vibrancy %v",
+				float(flame.Brightness), float(flame.Gamma), float(flame.Vibrancy),
+			)},
+			renderParameter{"Flame Transforms", strings.Join(transforms, "; ")},
+		)
+	}
+	if uniforms.PalletSource != "" {
+		parameters = append(parameters, renderParameter{"Pallet Source", uniforms.PalletSource})
+	}
+	return parameters
+}
+
+// parametersText formats parameters as "key: value" lines.
+func parametersText(parameters []renderParameter) string {
+	var b strings.Builder
+	for _, p := range parameters {
+		fmt.Fprintf(&b, "%v: %v\n", p.key, p.value)
+	}
+	return b.String()
+}
+
+// xmpPacket returns an XMP packet naming glfractal as the creator, with description as the image description.
+func xmpPacket(description string) string {
+	var escaped strings.Builder
+	xml.EscapeText(&escaped, []byte(description))
+
+	return `<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>` +
+		`<x:xmpmeta xmlns:x="adobe:ns:meta/">` +
+		`<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+		`<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:xmp="http://ns.adobe.com/xap/1.0/">` +
+		`<xmp:CreatorTool>glfractal</xmp:CreatorTool>` +
+		`<dc:description><rdf:Alt><rdf:li xml:lang="x-default">` + escaped.String() + `</rdf:li></rdf:Alt></dc:description>` +
+		`</rdf:Description>` +
+		`</rdf:RDF>` +
+		`</x:xmpmeta>` +
+		`<?xpacket end="w"?>`
+}
+
+// jpegCommentWriter copies a JPEG stream to w, inserting comment as a COM segment after the SOI marker.
+type jpegCommentWriter struct {
+	w       io.Writer
+	comment string
+	pending []byte
+	written bool
+}
+
+func (j *jpegCommentWriter) Write(b []byte) (int, error) {
+	if j.written {
+		return j.w.Write(b)
+	}
+
+	n := min(2-len(j.pending), len(b))
+	j.pending = append(j.pending, b[:n]...)
+	if len(j.pending) < 2 {
+		return n, nil
+	}
+	j.written = true
+
+	// the segment length includes itself, and can't exceed 16 bits
+	comment := j.comment[:min(len(j.comment), 0xffff-2)]
+	segment := []byte{0xff, 0xfe, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(comment)+2))
+	segment = append(segment, comment...)
+
+	if _, err := j.w.Write(append(j.pending, segment...)); err != nil {
+		return 0, err
+	}
+
+	written, err := j.w.Write(b[n:])
+	return n + written, err
+}
+
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+func textChunk(keyword, text string) pngChunk {
+	data := append([]byte(keyword), 0)
+	return pngChunk{
+		typ:  "tEXt",
+		data: append(data, text...),
+	}
+}
+
+func (c pngChunk) writeTo(w io.Writer) error {
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(len(c.data)))
+	copy(header[4:], c.typ)
+
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(c.data)
+
+	var footer [4]byte
+	binary.BigEndian.PutUint32(footer[:], crc.Sum32())
+
+	for _, b := range [][]byte{header[:], c.data, footer[:]} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// colourSpaceChunks mark an image as sRGB,
+// with a matching gAMA chunk for decoders that don't understand sRGB.
+func colourSpaceChunks() []pngChunk {
+	gamma := make([]byte, 4)
+	binary.BigEndian.PutUint32(gamma, 45455)
+
+	return []pngChunk{
+		{typ: "sRGB", data: []byte{0}}, // perceptual rendering intent
+		{typ: "gAMA", data: gamma},
+	}
+}
+
+// pngMetadataWriter copies a PNG stream to w,
+// inserting header just after IHDR and the chunks returned by trailer just before IEND.
+//
+// trailer is called after all image data has been written,
+// so it can describe the encode itself.
+type pngMetadataWriter struct {
+	w       io.Writer
+	header  []pngChunk
+	trailer func() []pngChunk
+
+	pending   []byte // buffered signature or chunk header
+	remaining int64  // bytes of the current chunk left to copy
+	signature bool
+	inIHDR    bool
+}
+
+func (p *pngMetadataWriter) Write(b []byte) (n int, err error) {
+	for len(b) > 0 {
+		if p.remaining > 0 {
+			k := min(int64(len(b)), p.remaining)
+			written, err := p.w.Write(b[:k])
+			n += written
+			if err != nil {
+				return n, err
+			}
+			p.remaining -= k
+			b = b[k:]
+
+			if p.remaining == 0 && p.inIHDR {
+				p.inIHDR = false
+				for _, chunk := range p.header {
+					if err := chunk.writeTo(p.w); err != nil {
+						return n, err
+					}
+				}
+			}
+			continue
+		}
+
+		k := min(8-len(p.pending), len(b))
+		p.pending = append(p.pending, b[:k]...)
+		n += k
+		b = b[k:]
+		if len(p.pending) < 8 {
+			continue
+		}
+
+		if p.signature {
+			if string(p.pending[4:]) == "IEND" && p.trailer != nil {
+				for _, chunk := range p.trailer() {
+					if err := chunk.writeTo(p.w); err != nil {
+						return n, err
+					}
+				}
+			}
+			// chunk data followed by the CRC
+			p.remaining = int64(binary.BigEndian.Uint32(p.pending[:4])) + 4
+			p.inIHDR = string(p.pending[4:]) == "IHDR"
+		}
+		p.signature = true
+
+		if _, err := p.w.Write(p.pending); err != nil {
+			return n, err
+		}
+		p.pending = p.pending[:0]
+	}
+	return n, nil
+}
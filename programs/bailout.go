@@ -0,0 +1,55 @@
+package programs
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// BailoutTest is the measure of z compared to the bailout radius to decide if a point has escaped.
+// Shaders switch on its value, so the order matters.
+type BailoutTest uint32
+
+const (
+	BailoutManhattan BailoutTest = iota // sum of the absolute real and imaginary parts
+	BailoutModulus
+	BailoutReal              // real part, for maps that grow exponentially to the right
+	BailoutAbsoluteReal      // absolute real part, for hyperbolic maps
+	BailoutAbsoluteImaginary // absolute imaginary part, for trigonometric maps
+)
+
+var BailoutTestNames = []string{"Manhattan", "Modulus", "Real Part", "Absolute Real Part", "Absolute Imaginary Part"}
+
+func (t BailoutTest) String() string { return BailoutTestNames[t] }
+
+// Escaped returns true if z is past radius by the test.
+func (t BailoutTest) Escaped(z complex128, radius float64) bool {
+	switch t {
+	case BailoutModulus:
+		return cmplx.Abs(z) > radius
+	case BailoutReal:
+		return real(z) > radius
+	case BailoutAbsoluteReal:
+		return math.Abs(real(z)) > radius
+	case BailoutAbsoluteImaginary:
+		return math.Abs(imag(z)) > radius
+	default:
+		return math.Abs(real(z))+math.Abs(imag(z)) > radius
+	}
+}
+
+// Bailout is when a program counts a point as escaped.
+type Bailout struct {
+	Test   BailoutTest
+	Radius float64
+}
+
+// defaultBailout is the bailout of programs that don't set their own.
+var defaultBailout = Bailout{BailoutManhattan, 4}
+
+// DefaultBailout returns the bailout the program is designed for.
+func (p *Program) DefaultBailout() Bailout {
+	if p.Bailout.Radius == 0 {
+		return defaultBailout
+	}
+	return p.Bailout
+}
@@ -0,0 +1,115 @@
+package programs
+
+import (
+	_ "embed"
+)
+
+//go:embed shaders/density.frag
+var densityFragment string
+
+// buddhabrotBailout is the usual escape radius of the Mandelbrot set; every orbit past 2 escapes.
+var buddhabrotBailout = Bailout{BailoutModulus, 2}
+
+// mandelbrotOrbit appends the orbit of c under z² + c to orbit, up to when it escapes,
+// returning it with whether it did.
+func mandelbrotOrbit(uniforms *Uniforms, c complex128, orbit []complex128) ([]complex128, bool) {
+	z := complex(0, 0)
+	for range uniforms.Iterations {
+		z = z*z + c
+		if uniforms.BailoutTest.Escaped(z, uniforms.Bailout) {
+			return orbit, true
+		}
+		orbit = append(orbit, z)
+	}
+	return orbit, false
+}
+
+// inMainBulbs returns true if c is in the main cardioid or period 2 bulb of the Mandelbrot set,
+// where orbits never escape.
+func inMainBulbs(c complex128) bool {
+	x, y := real(c)-.25, imag(c)
+	q := x*x + y*y
+	if q*(q+x) <= y*y/4 {
+		return true
+	}
+	x = real(c) + 1
+	return x*x+y*y <= 1./16
+}
+
+// buddhabrotOrbit counts the orbits that escape,
+// if they take at least as many iterations as slider 0.
+func buddhabrotOrbit(uniforms *Uniforms, c complex128, orbit []complex128) ([]complex128, uint8) {
+	if inMainBulbs(c) {
+		return orbit, 0
+	}
+
+	orbit, escaped := mandelbrotOrbit(uniforms, c, orbit)
+	if !escaped || float64(len(orbit)) < uniforms.Sliders[0] {
+		return orbit, 0
+	}
+	return orbit, 1
+}
+
+// antiBuddhabrotOrbit counts the orbits that don't escape.
+func antiBuddhabrotOrbit(uniforms *Uniforms, c complex128, orbit []complex128) ([]complex128, uint8) {
+	orbit, escaped := mandelbrotOrbit(uniforms, c, orbit)
+	if escaped {
+		return orbit, 0
+	}
+	return orbit, 1
+}
+
+// nebulabrotOrbit counts escaping orbits in red, and in green and blue if they escape
+// within the fractions of the iteration limit on sliders 0 and 1.
+func nebulabrotOrbit(uniforms *Uniforms, c complex128, orbit []complex128) ([]complex128, uint8) {
+	if inMainBulbs(c) {
+		return orbit, 0
+	}
+
+	orbit, escaped := mandelbrotOrbit(uniforms, c, orbit)
+	if !escaped {
+		return orbit, 0
+	}
+
+	channels := uint8(1)
+	iterations := float64(len(orbit) + 1)
+	for i, limit := range uniforms.Sliders[:2] {
+		if iterations <= limit*float64(uniforms.Iterations) {
+			channels |= 2 << i
+		}
+	}
+	return orbit, channels
+}
+
+func init() {
+	NewProgram(Program{
+		Name:           "Buddhabrot",
+		VertexShader:   defaultVertexShader,
+		FragmentShader: densityFragment,
+		Bailout:        buddhabrotBailout,
+		Sliders: []Slider{
+			{Name: "Minimum Iterations", Min: 0, Max: 100},
+		},
+		Density: &Density{Channels: 1, Orbit: buddhabrotOrbit},
+	})
+
+	NewProgram(Program{
+		Name:           "Anti-Buddhabrot",
+		VertexShader:   defaultVertexShader,
+		FragmentShader: densityFragment,
+		Bailout:        buddhabrotBailout,
+		Density:        &Density{Channels: 1, Orbit: antiBuddhabrotOrbit},
+	})
+
+	NewProgram(Program{
+		Name:           "Nebulabrot",
+		VertexShader:   defaultVertexShader,
+		FragmentShader: densityFragment,
+		Bailout:        buddhabrotBailout,
+		Sliders: []Slider{
+			{Name: "Green Limit", Min: 0, Max: 1, Default: .1},
+			{Name: "Blue Limit", Min: 0, Max: 1, Default: .01},
+		},
+		Density: &Density{Channels: 3, Orbit: nebulabrotOrbit},
+	})
+}
@@ -0,0 +1,72 @@
+package programs
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// Camera3D is where 3D programs are seen from.
+// With no turn it looks along -z, with y up.
+type Camera3D struct {
+	Position    mgl64.Vec3
+	Yaw         float64 // degrees turned to the right
+	Pitch       float64 // degrees looked up
+	FieldOfView float64 // degrees across the longer side of the view
+}
+
+// maxPitch stops the camera looking straight up or down, where yaw would turn it about its own view.
+const maxPitch = 89.9
+
+// defaultCamera3D is the camera of uniforms before a 3D program sets its own.
+var defaultCamera3D = Camera3D{
+	Position:    mgl64.Vec3{0, 0, 3},
+	FieldOfView: 55,
+}
+
+// Axes returns the directions the camera looks along, to its right and up.
+func (c Camera3D) Axes() (forward, right, up mgl64.Vec3) {
+	yaw, pitch := mgl64.DegToRad(c.Yaw), mgl64.DegToRad(c.Pitch)
+	forward = mgl64.Vec3{
+		math.Sin(yaw) * math.Cos(pitch),
+		math.Sin(pitch),
+		-math.Cos(yaw) * math.Cos(pitch),
+	}
+	right = mgl64.Vec3{math.Cos(yaw), 0, math.Sin(yaw)}
+	up = right.Cross(forward)
+	return forward, right, up
+}
+
+// Turn turns the camera in place by yaw and pitch degrees.
+func (c Camera3D) Turn(yaw, pitch float64) Camera3D {
+	c.Yaw = math.Mod(c.Yaw+yaw, 360)
+	c.Pitch = mgl64.Clamp(c.Pitch+pitch, -maxPitch, maxPitch)
+	return c
+}
+
+// Orbit turns the camera by yaw and pitch degrees around the point distance ahead of it,
+// which stays in the centre of the view.
+func (c Camera3D) Orbit(distance, yaw, pitch float64) Camera3D {
+	forward, _, _ := c.Axes()
+	pivot := c.Position.Add(forward.Mul(distance))
+
+	c = c.Turn(yaw, pitch)
+	forward, _, _ = c.Axes()
+	c.Position = pivot.Sub(forward.Mul(distance))
+	return c
+}
+
+// Move moves the camera by d along its own axes; right, up and forward.
+func (c Camera3D) Move(d mgl64.Vec3) Camera3D {
+	forward, right, up := c.Axes()
+	c.Position = c.Position.
+		Add(right.Mul(d[0])).
+		Add(up.Mul(d[1])).
+		Add(forward.Mul(d[2]))
+	return c
+}
+
+// Is3D returns true if the program is seen through a Camera3D rather than panned and zoomed.
+func (p *Program) Is3D() bool {
+	return p.Camera3D != Camera3D{}
+}
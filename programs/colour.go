@@ -0,0 +1,123 @@
+package programs
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// SRGBToLinear converts an sRGB encoded colour to linear light.
+func SRGBToLinear(c mgl32.Vec3) mgl32.Vec3 {
+	return mgl32.Vec3{
+		srgbToLinear(c[0]),
+		srgbToLinear(c[1]),
+		srgbToLinear(c[2]),
+	}
+}
+
+// LinearToSRGB converts a colour in linear light to sRGB encoding.
+func LinearToSRGB(c mgl32.Vec3) mgl32.Vec3 {
+	return mgl32.Vec3{
+		linearToSRGB(c[0]),
+		linearToSRGB(c[1]),
+		linearToSRGB(c[2]),
+	}
+}
+
+func srgbToLinear(n float32) float32 {
+	if n <= 0.04045 {
+		return n / 12.92
+	}
+	return float32(math.Pow((float64(n)+0.055)/1.055, 2.4))
+}
+
+func linearToSRGB(n float32) float32 {
+	if n <= 0.0031308 {
+		return n * 12.92
+	}
+	return float32(1.055*math.Pow(float64(n), 1/2.4) - 0.055)
+}
+
+// SRGBToOKLab converts an sRGB encoded colour to OKLab,
+// where distances and mixes follow perceived lightness and hue.
+func SRGBToOKLab(c mgl32.Vec3) mgl32.Vec3 {
+	c = SRGBToLinear(c)
+	r, g, b := float64(c[0]), float64(c[1]), float64(c[2])
+
+	l := math.Cbrt(0.4122214708*r + 0.5363325363*g + 0.0514459929*b)
+	m := math.Cbrt(0.2119034982*r + 0.6806995451*g + 0.1073969566*b)
+	s := math.Cbrt(0.0883024619*r + 0.2817188376*g + 0.6299787005*b)
+
+	return mgl32.Vec3{
+		float32(0.2104542553*l + 0.7936177850*m - 0.0040720468*s),
+		float32(1.9779984951*l - 2.4285922050*m + 0.4505937099*s),
+		float32(0.0259040371*l + 0.7827717662*m - 0.8086757660*s),
+	}
+}
+
+// OKLabToSRGB converts an OKLab colour to sRGB encoding, clamped to the sRGB gamut.
+func OKLabToSRGB(c mgl32.Vec3) mgl32.Vec3 {
+	L, a, b := float64(c[0]), float64(c[1]), float64(c[2])
+
+	l := math.Pow(L+0.3963377774*a+0.2158037573*b, 3)
+	m := math.Pow(L-0.1055613458*a-0.0638541728*b, 3)
+	s := math.Pow(L-0.0894841775*a-1.2914855480*b, 3)
+
+	return LinearToSRGB(mgl32.Vec3{
+		limit(float32(4.0767416621*l - 3.3077115913*m + 0.2309699292*s)),
+		limit(float32(-1.2684380046*l + 2.6097574011*m - 0.3413193965*s)),
+		limit(float32(-0.0041960863*l - 0.7034186147*m + 1.7076147010*s)),
+	})
+}
+
+// rgbToHSV converts a colour to hue, saturation and value, with hue from 0 to 1.
+func rgbToHSV(c mgl32.Vec3) mgl32.Vec3 {
+	hi := max(c[0], c[1], c[2])
+	lo := min(c[0], c[1], c[2])
+	delta := hi - lo
+
+	var h float32
+	switch {
+	case delta == 0:
+		h = 0
+	case hi == c[0]:
+		h = (c[1] - c[2]) / delta
+	case hi == c[1]:
+		h = 2 + (c[2]-c[0])/delta
+	default:
+		h = 4 + (c[0]-c[1])/delta
+	}
+	h /= 6
+	if h < 0 {
+		h++
+	}
+
+	var s float32
+	if hi > 0 {
+		s = delta / hi
+	}
+	return mgl32.Vec3{h, s, hi}
+}
+
+func hsvToRGB(c mgl32.Vec3) mgl32.Vec3 {
+	h, s, v := c[0], c[1], c[2]
+	h = (h - float32(math.Floor(float64(h)))) * 6
+	i := int(h) % 6
+	f := h - float32(int(h))
+
+	p, q, t := v*(1-s), v*(1-s*f), v*(1-s*(1-f))
+	switch i {
+	case 0:
+		return mgl32.Vec3{v, t, p}
+	case 1:
+		return mgl32.Vec3{q, v, p}
+	case 2:
+		return mgl32.Vec3{p, v, t}
+	case 3:
+		return mgl32.Vec3{p, q, v}
+	case 4:
+		return mgl32.Vec3{t, p, v}
+	default:
+		return mgl32.Vec3{v, p, q}
+	}
+}
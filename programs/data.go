@@ -0,0 +1,67 @@
+package programs
+
+import (
+	"math"
+	"math/cmplx"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// PixelData is the raw result of iterating a single point,
+// before it is coloured.
+//
+// Smooth is the continuous iteration count,
+// equal to Iterations for points that didn't escape.
+type PixelData struct {
+	Iterations uint32
+	Smooth     float64
+	Z          complex128
+	Escaped    bool
+}
+
+type DataFunc func(uniforms Uniforms, pos mgl32.Vec2) PixelData
+
+// escapeTime iterates step from z until it escapes or reaches the iteration limit.
+//
+// degree is the dominant power of step, used to smooth the iteration count,
+// or 0 for transcendental steps that don't have one.
+func escapeTime(uniforms Uniforms, z complex128, degree float64, step func(complex128) complex128) PixelData {
+	var data PixelData
+	for !uniforms.BailoutTest.Escaped(z, uniforms.Bailout) && data.Iterations < uniforms.Iterations {
+		z = step(z)
+		data.Iterations++
+	}
+
+	data.Z = z
+	data.Escaped = data.Iterations < uniforms.Iterations
+	data.Smooth = float64(data.Iterations)
+	if data.Escaped && degree > 1 {
+		data.Smooth += 1 - math.Log(math.Log(cmplx.Abs(z)))/math.Log(degree)
+	}
+
+	return data
+}
+
+// escapeOrConverge iterates step from z until it escapes, converges to attractor or reaches the iteration limit.
+//
+// Both are ways of leaving the set, so converged points are also marked Escaped and coloured the same way.
+func escapeOrConverge(uniforms Uniforms, z, attractor complex128, step func(complex128) complex128) PixelData {
+	var data PixelData
+	converged := false
+	for !uniforms.BailoutTest.Escaped(z, uniforms.Bailout) && !converged && data.Iterations < uniforms.Iterations {
+		z = step(z)
+		converged = cmplx.Abs(z-attractor) < convergeEpsilon
+		data.Iterations++
+	}
+
+	data.Z = z
+	data.Escaped = data.Iterations < uniforms.Iterations
+	data.Smooth = float64(data.Iterations)
+	return data
+}
+
+func colourData(dataFunc DataFunc) PixelFunc {
+	return func(uniforms Uniforms, pos mgl32.Vec2) mgl32.Vec3 {
+		return uniforms.Colour(dataFunc(uniforms, pos))
+	}
+}
@@ -0,0 +1,484 @@
+package programs
+
+import (
+	"context"
+	"errors"
+	"image"
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+var ErrDensityImage = errors.New("density programs are accumulated into a histogram, not rendered pixel by pixel")
+
+// Density describes a program that counts the orbits of many points into a histogram,
+// instead of colouring each pixel by the orbit of its own point.
+type Density struct {
+	Channels int // counted in the histogram; one is coloured by the pallet, three are red, green and blue
+	Orbit    OrbitFunc
+	Chaos    ChaosFunc // instead of Orbit, to plot one point that moves at random, counted with its colour in four channels
+}
+
+// OrbitFunc appends the orbit of c to orbit, returning it with the channels it's counted in as bits,
+// or none if it isn't counted.
+type OrbitFunc func(uniforms *Uniforms, c complex128, orbit []complex128) ([]complex128, uint8)
+
+// ChaosFunc moves a point one step through the chaos game, returning where it moved to and where it's plotted,
+// or false if it can't move.
+type ChaosFunc func(uniforms *Uniforms, random *rand.Rand, p ChaosPoint) (next, plotted ChaosPoint, ok bool)
+
+// ChaosPoint is a point in the chaos game, with its position along the pallet from 0 to 1.
+type ChaosPoint struct {
+	Z      complex128
+	Colour float64
+}
+
+// DensitySampling is how density programs choose the points whose orbits they count.
+type DensitySampling int
+
+const (
+	SampleUniform    DensitySampling = iota // evenly over the disc orbits start in
+	SampleMetropolis                        // Metropolis-Hastings, favouring points whose orbits cross the view
+)
+
+var DensitySamplingNames = []string{"Uniform", "Metropolis-Hastings"}
+
+func (s DensitySampling) String() string { return DensitySamplingNames[s] }
+
+// ToneMap is how density programs turn counts into brightness, relative to the highest count.
+type ToneMap int
+
+const (
+	ToneSquareRoot ToneMap = iota
+	ToneLogarithmic
+	ToneLinear
+)
+
+var ToneMapNames = []string{"Square Root", "Logarithmic", "Linear"}
+
+func (t ToneMap) String() string { return ToneMapNames[t] }
+
+// DefaultDensitySamples is the number of orbits counted for each pixel unless another number is chosen.
+const DefaultDensitySamples = 50
+
+const (
+	sampleRadius  = 2    // orbits start from points in this disc around the origin
+	densityBatch  = 1024 // samples each thread takes between checking if it's been cancelled
+	logToneRange  = 1e3  // counts the logarithmic tone map spans, relative to the highest
+	flameWhite    = 200  // flames are tone mapped by the logarithm of their density relative to this many times the average, like flam3's white level
+	uniformChance = .2   // of a Metropolis-Hastings proposal being taken anywhere, so chains find every part of the view
+	minMutation   = 1e-4 // range of the distance of other proposals from the current point, relative to the zoom
+	maxMutation   = .1
+)
+
+// apply returns the brightness of count, out of the highest.
+func (t ToneMap) apply(count, highest float32) float32 {
+	if highest <= 0 {
+		return 0
+	}
+
+	x := count / highest
+	switch t {
+	case ToneLogarithmic:
+		return float32(math.Log1p(float64(x)*logToneRange) / math.Log1p(logToneRange))
+	case ToneLinear:
+		return x
+	default:
+		return float32(math.Sqrt(float64(x)))
+	}
+}
+
+// Histogram counts the orbit points of a density program landing in each pixel of an image.
+// It is safe to read while it accumulates, to show its progress.
+type Histogram struct {
+	uniforms Uniforms
+	density  Density
+	bounds   image.Rectangle
+	scale    float64 // pixels per unit of screen position
+
+	// weighted counts of each channel of each pixel, as float32 bits so they can be added to atomically
+	counts []uint32
+
+	target  uint64
+	claimed atomic.Uint64 // samples threads have started
+	samples atomic.Uint64 // samples threads have finished
+}
+
+// GetHistogram returns an empty histogram of the program's orbits for an image of the given size.
+func (p *Program) GetHistogram(uniforms Uniforms, width, height int) (*Histogram, error) {
+	if p.Density == nil || (p.Density.Orbit == nil && p.Density.Chaos == nil) {
+		return nil, ErrNoCPUImplementation
+	}
+
+	bounds := histogramBounds(width, height)
+	return &Histogram{
+		uniforms: uniforms,
+		density:  *p.Density,
+		bounds:   bounds,
+		scale:    float64(max(bounds.Dx(), bounds.Dy())) / 2,
+		counts:   make([]uint32, bounds.Dx()*bounds.Dy()*p.Density.Channels),
+		target:   max(uint64(uniforms.DensitySamples*float64(bounds.Dx()*bounds.Dy())), 1),
+	}, nil
+}
+
+// histogramBounds returns the bounds of an image of the given size, centred like GetImage's.
+func histogramBounds(width, height int) image.Rectangle {
+	return image.Rect(-width/2, -height/2, width/2, height/2)
+}
+
+// Shows returns true if h counts the orbits shown with uniforms in an image of the given size,
+// so it only needs colouring again.
+func (h *Histogram) Shows(uniforms *Uniforms, width, height int) bool {
+	u := &h.uniforms
+	return h.bounds == histogramBounds(width, height) &&
+		u.Zoom == uniforms.Zoom &&
+		u.Pos == uniforms.Pos &&
+		u.Iterations == uniforms.Iterations &&
+		u.Sliders == uniforms.Sliders &&
+		u.Bailout == uniforms.Bailout &&
+		u.BailoutTest == uniforms.BailoutTest &&
+		u.DensitySampling == uniforms.DensitySampling &&
+		u.DensitySamples == uniforms.DensitySamples &&
+		(h.density.Chaos == nil || h.showsChaos(uniforms))
+}
+
+// showsChaos returns true if the points of the chaos game plotted with uniforms are the same,
+// along with the pallet their colours are counted from, so cycling the pallet counts them again.
+func (h *Histogram) showsChaos(uniforms *Uniforms) bool {
+	u := &h.uniforms
+	return reflect.DeepEqual(u.Flame.Transforms, uniforms.Flame.Transforms) &&
+		reflect.DeepEqual(u.Flame.Final, uniforms.Flame.Final) &&
+		slices.Equal(u.ColourPallet, uniforms.ColourPallet) &&
+		u.PalletScale == uniforms.PalletScale &&
+		u.PalletOffset == uniforms.PalletOffset &&
+		u.PalletLinear == uniforms.PalletLinear
+}
+
+// Bounds returns the bounds of the image the histogram counts orbits for.
+func (h *Histogram) Bounds() image.Rectangle {
+	return h.bounds
+}
+
+// Samples returns the number of orbits counted so far.
+func (h *Histogram) Samples() uint64 {
+	return h.samples.Load()
+}
+
+// Target returns the number of orbits h counts before it's finished.
+func (h *Histogram) Target() uint64 {
+	return h.target
+}
+
+// Accumulate counts orbits with the given number of goroutines until Target are counted,
+// returning early with the context's error if it's cancelled.
+func (h *Histogram) Accumulate(ctx context.Context, threads int) error {
+	var wg sync.WaitGroup
+	for i := range max(threads, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.accumulate(ctx, h.sampler(rand.New(rand.NewSource(int64(i)))))
+		}()
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (h *Histogram) accumulate(ctx context.Context, sampler densitySampler) {
+	for ctx.Err() == nil {
+		start := h.claimed.Add(densityBatch) - densityBatch
+		if start >= h.target {
+			return
+		}
+
+		n := min(densityBatch, h.target-start)
+		for range n {
+			sampler.sample()
+		}
+		h.samples.Add(n)
+	}
+}
+
+// index returns the index of the first channel of the pixel at x, y on the screen,
+// or -1 if it's outside the image.
+func (h *Histogram) index(x, y float64) int {
+	px := int(math.Floor(x*h.scale+.5)) - h.bounds.Min.X
+	py := int(math.Floor(-y*h.scale+.5)) - h.bounds.Min.Y
+	if px < 0 || py < 0 || px >= h.bounds.Dx() || py >= h.bounds.Dy() {
+		return -1
+	}
+	return (py*h.bounds.Dx() + px) * h.density.Channels
+}
+
+// pixels appends the indices of the pixels orbit crosses, along with those of its reflection in the real axis,
+// which is the orbit of the conjugate of its c.
+func (h *Histogram) pixels(orbit []complex128, pixels []int) []int {
+	u := &h.uniforms
+	for _, z := range orbit {
+		for _, z := range [2]complex128{z, cmplx.Conj(z)} {
+			if i := h.index((real(z)+u.Pos[0])/u.Zoom, (imag(z)+u.Pos[1])/u.Zoom); i >= 0 {
+				pixels = append(pixels, i)
+			}
+		}
+	}
+	return pixels
+}
+
+// add adds weight to the channels set in mask of each pixel.
+func (h *Histogram) add(pixels []int, mask uint8, weight float32) {
+	for _, i := range pixels {
+		for c := range h.density.Channels {
+			if mask&(1<<c) != 0 {
+				h.addCount(i+c, weight)
+			}
+		}
+	}
+}
+
+func (h *Histogram) addCount(i int, weight float32) {
+	count := &h.counts[i]
+	for {
+		old := atomic.LoadUint32(count)
+		if atomic.CompareAndSwapUint32(count, old, math.Float32bits(math.Float32frombits(old)+weight)) {
+			return
+		}
+	}
+}
+
+// densitySampler chooses points and adds their orbits to a histogram, one at a time.
+type densitySampler interface {
+	sample()
+}
+
+func (h *Histogram) sampler(random *rand.Rand) densitySampler {
+	if h.density.Chaos != nil {
+		return &chaosSampler{h: h, random: random}
+	}
+	if h.uniforms.DensitySampling == SampleMetropolis {
+		return &metropolisSampler{h: h, random: random}
+	}
+	return &uniformSampler{h: h, random: random}
+}
+
+// randomPoint returns a point taken evenly from the disc orbits start in.
+func randomPoint(random *rand.Rand) complex128 {
+	return cmplx.Rect(sampleRadius*math.Sqrt(random.Float64()), 2*math.Pi*random.Float64())
+}
+
+// uniformSampler counts the orbits of points taken evenly from the disc.
+type uniformSampler struct {
+	h      *Histogram
+	random *rand.Rand
+	orbit  []complex128
+	pixels []int
+}
+
+func (s *uniformSampler) sample() {
+	var mask uint8
+	s.orbit, mask = s.h.density.Orbit(&s.h.uniforms, randomPoint(s.random), s.orbit[:0])
+	if mask == 0 {
+		return
+	}
+
+	s.pixels = s.h.pixels(s.orbit, s.pixels[:0])
+	s.h.add(s.pixels, mask, 1)
+}
+
+// metropolisSampler walks from point to point, staying longer on points whose orbits cross more of the view,
+// so deep zooms don't waste most of their samples on orbits that miss it.
+//
+// Each orbit is weighted by the inverse of the pixels it crosses, which is how much more often it's counted,
+// so the histogram comes out the same as it would from uniform sampling.
+type metropolisSampler struct {
+	h      *Histogram
+	random *rand.Rand
+	orbit  []complex128
+
+	// the current point, and the pixels its orbit crosses
+	c      complex128
+	mask   uint8
+	pixels []int
+
+	proposed []int
+}
+
+func (s *metropolisSampler) sample() {
+	c := s.propose()
+
+	s.proposed = s.proposed[:0]
+	if cmplx.Abs(c) <= sampleRadius {
+		var mask uint8
+		s.orbit, mask = s.h.density.Orbit(&s.h.uniforms, c, s.orbit[:0])
+		if mask != 0 {
+			s.proposed = s.h.pixels(s.orbit, s.proposed)
+		}
+
+		// accepted in proportion to how many more pixels its orbit crosses
+		if len(s.proposed) > 0 && s.random.Float64()*float64(len(s.pixels)) < float64(len(s.proposed)) {
+			s.c, s.mask = c, mask
+			s.pixels, s.proposed = s.proposed, s.pixels
+		}
+	}
+
+	if len(s.pixels) > 0 {
+		s.h.add(s.pixels, s.mask, 1/float32(len(s.pixels)))
+	}
+}
+
+// propose returns a point near the current one, or anywhere in the disc.
+func (s *metropolisSampler) propose() complex128 {
+	if len(s.pixels) == 0 || s.random.Float64() < uniformChance {
+		return randomPoint(s.random)
+	}
+
+	r := s.h.uniforms.Zoom * maxMutation * math.Exp(-math.Log(maxMutation/minMutation)*s.random.Float64())
+	return s.c + cmplx.Rect(r, 2*math.Pi*s.random.Float64())
+}
+
+// chaosSampler plays the chaos game, plotting one point each sample with its colour from the pallet.
+type chaosSampler struct {
+	h      *Histogram
+	random *rand.Rand
+	p      ChaosPoint
+	fused  bool // set once p has been moved enough times to have reached the attractor
+}
+
+func (s *chaosSampler) sample() {
+	u := &s.h.uniforms
+	if !s.fused {
+		s.p = ChaosPoint{
+			Z:      complex(2*s.random.Float64()-1, 2*s.random.Float64()-1),
+			Colour: s.random.Float64(),
+		}
+		for range flameFuse {
+			s.p, _, _ = s.h.density.Chaos(u, s.random, s.p)
+		}
+		s.fused = true
+	}
+
+	next, plotted, ok := s.h.density.Chaos(u, s.random, s.p)
+	if !ok || !finite(next.Z) {
+		// start again somewhere else, as the point has nowhere to go
+		s.fused = false
+		return
+	}
+	s.p = next
+
+	// plotted upside down, as flames are drawn with y going down the image
+	i := s.h.index((real(plotted.Z)+u.Pos[0])/u.Zoom, (-imag(plotted.Z)+u.Pos[1])/u.Zoom)
+	if i < 0 || !finite(plotted.Z) {
+		return
+	}
+
+	colour := u.ColourPallet.At(float32(plotted.Colour)*float32(len(u.ColourPallet)-1)*u.PalletScale+float32(u.PalletOffset), u.PalletLinear)
+	for c := range 3 {
+		s.h.addCount(i+c, colour[c])
+	}
+	s.h.addCount(i+3, 1)
+}
+
+func finite(z complex128) bool {
+	return !cmplx.IsNaN(z) && !cmplx.IsInf(z)
+}
+
+// HistogramImage is a histogram tone mapped and coloured as an image.
+type HistogramImage struct {
+	h        *Histogram
+	uniforms Uniforms
+	highest  [4]float32 // count of each channel that's shown at full brightness
+	samples  uint64     // counted when highest was found
+}
+
+// Image returns the histogram tone mapped and coloured by uniforms.
+// It reads the counts as they are when it's read, so Update should be called as they change.
+func (h *Histogram) Image(uniforms *Uniforms) *HistogramImage {
+	img := &HistogramImage{
+		h:        h,
+		uniforms: *uniforms,
+	}
+	img.Update()
+	return img
+}
+
+// Update finds the highest counts again, to tone map the counts added since the image was made.
+func (i *HistogramImage) Update() {
+	i.samples = i.h.Samples()
+	i.highest = [4]float32{}
+	for j := range i.h.counts {
+		c := j % i.h.density.Channels
+		i.highest[c] = max(i.highest[c], i.h.count(j))
+	}
+}
+
+// Recolour colours the image with uniforms, keeping the highest counts found by the last Update.
+func (i *HistogramImage) Recolour(uniforms *Uniforms) {
+	i.uniforms = *uniforms
+}
+
+func (h *Histogram) count(i int) float32 {
+	return math.Float32frombits(atomic.LoadUint32(&h.counts[i]))
+}
+
+func (i *HistogramImage) Bounds() image.Rectangle {
+	return i.h.bounds
+}
+
+// GetPixel fades a single channel from the empty colour into the pallet as it gets brighter,
+// and fades each of three channels from the empty colour to full red, green and blue.
+// Four channels are the colours and density of the chaos game, tone mapped like flam3.
+func (i *HistogramImage) GetPixel(pos mgl32.Vec2) mgl32.Vec3 {
+	u := &i.uniforms
+	j := i.h.index(float64(pos[0]), float64(pos[1]))
+	if j < 0 {
+		return u.EmptyColour
+	}
+
+	if i.h.density.Channels == 4 {
+		return i.flamePixel(j)
+	}
+
+	if i.h.density.Channels == 1 {
+		t := u.ToneMap.apply(i.h.count(j), i.highest[0])
+		colour := u.ColourPallet.At(t*float32(len(u.ColourPallet)-1)*u.PalletScale+float32(u.PalletOffset), u.PalletLinear)
+		return u.EmptyColour.Mul(1 - t).Add(colour.Mul(t))
+	}
+
+	colour := u.EmptyColour
+	for c := range min(i.h.density.Channels, 3) {
+		t := u.ToneMap.apply(i.h.count(j+c), i.highest[c])
+		colour[c] += (1 - colour[c]) * t
+	}
+	return colour
+}
+
+// flamePixel tone maps the density of a pixel by its logarithm relative to the average,
+// then applies gamma to its brightness, or to each channel of its colour without vibrancy,
+// and lays it over the empty colour.
+func (i *HistogramImage) flamePixel(j int) mgl32.Vec3 {
+	u := &i.uniforms
+	f := &u.Flame
+	density := float64(i.h.count(j + 3))
+	if density <= 0 || i.samples == 0 {
+		return u.EmptyColour
+	}
+
+	pixels := float64(i.h.bounds.Dx() * i.h.bounds.Dy())
+	alpha := f.Brightness * math.Log1p(density*pixels/(float64(i.samples)*flameWhite))
+	gamma := 1 / max(f.Gamma, flameEpsilon)
+	alphaGamma := math.Pow(alpha, gamma)
+
+	var colour mgl32.Vec3
+	for c := range 3 {
+		mean := float64(i.h.count(j+c)) / density
+		v := f.Vibrancy*mean*alphaGamma + (1-f.Vibrancy)*math.Pow(mean*alpha, gamma)
+		colour[c] = float32(v + (1-min(alphaGamma, 1))*float64(u.EmptyColour[c]))
+		colour[c] = min(colour[c], 1)
+	}
+	return colour
+}
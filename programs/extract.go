@@ -0,0 +1,269 @@
+package programs
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"slices"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// ExtractMethod is how the dominant colours of an image are found.
+type ExtractMethod int
+
+const (
+	ExtractKMeans ExtractMethod = iota
+	ExtractMedianCut
+)
+
+var ExtractMethodNames = []string{"K-Means", "Median Cut"}
+
+func (m ExtractMethod) String() string { return ExtractMethodNames[m] }
+
+// PalletOrder is how extracted colours are ordered along the gradient.
+type PalletOrder int
+
+const (
+	OrderLightness PalletOrder = iota
+	OrderHue
+	OrderNearest // each colour followed by the closest remaining one, starting from the darkest
+)
+
+var PalletOrderNames = []string{"Lightness", "Hue", "Nearest Colour"}
+
+func (o PalletOrder) String() string { return PalletOrderNames[o] }
+
+// ExtractOptions configures ExtractPallet.
+type ExtractOptions struct {
+	Colours int
+	Method  ExtractMethod
+	Order   PalletOrder
+}
+
+// extractSamples is about the most pixels sampled from an image, as large photos don't need every pixel.
+const extractSamples = 1 << 16
+
+// kMeansIterations limits k-means if it hasn't settled.
+const kMeansIterations = 30
+
+// ExtractPallet finds the dominant colours of img in OKLab,
+// and orders them into a gradient mixed in OKLab so neighbouring colours blend smoothly.
+// Transparent pixels are ignored.
+func ExtractPallet(img image.Image, opts ExtractOptions) (Gradient, error) {
+	if opts.Colours < 1 {
+		return Gradient{}, fmt.Errorf("can't extract %v colours", opts.Colours)
+	}
+
+	samples := imageSamples(img)
+	if len(samples) == 0 {
+		return Gradient{}, errors.New("image has no opaque pixels")
+	}
+
+	var colours []mgl32.Vec3
+	switch opts.Method {
+	case ExtractMedianCut:
+		colours = medianCut(samples, opts.Colours)
+	default:
+		colours = kMeans(samples, opts.Colours)
+	}
+
+	colours = orderColours(colours, opts.Order)
+
+	g := Gradient{Interpolation: InterpolateOKLab, Repeat: 1}
+	for i, c := range colours {
+		g.Stops = append(g.Stops, GradientStop{
+			Pos:    float32(i) / float32(max(len(colours)-1, 1)),
+			Colour: OKLabToSRGB(c),
+		})
+	}
+	return g, nil
+}
+
+// imageSamples returns the OKLab colours of evenly spread pixels of img.
+func imageSamples(img image.Image) []mgl32.Vec3 {
+	bounds := img.Bounds()
+	step := max(1, int(math.Ceil(math.Sqrt(float64(bounds.Dx()*bounds.Dy())/extractSamples))))
+
+	samples := make([]mgl32.Vec3, 0, extractSamples)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A == 0 {
+				continue
+			}
+			samples = append(samples, SRGBToOKLab(mgl32.Vec3{
+				float32(c.R) / 255,
+				float32(c.G) / 255,
+				float32(c.B) / 255,
+			}))
+		}
+	}
+	return samples
+}
+
+func distanceSqr(a, b mgl32.Vec3) float32 {
+	d := a.Sub(b)
+	return d.Dot(d)
+}
+
+// kMeans clusters samples into at most k colours, returning the centre of each cluster.
+// Centres start spread out by k-means++, with a fixed seed so the same image always gives the same pallet.
+func kMeans(samples []mgl32.Vec3, k int) []mgl32.Vec3 {
+	random := rand.New(rand.NewSource(1))
+
+	centres := []mgl32.Vec3{samples[random.Intn(len(samples))]}
+	nearest := make([]float32, len(samples))
+	for i := range nearest {
+		nearest[i] = float32(math.Inf(1))
+	}
+	for len(centres) < k {
+		var total float64
+		for i, s := range samples {
+			nearest[i] = min(nearest[i], distanceSqr(s, centres[len(centres)-1]))
+			total += float64(nearest[i])
+		}
+		if total == 0 {
+			break // fewer distinct colours than k
+		}
+
+		pick := random.Float64() * total
+		i := 0
+		for ; i < len(samples)-1; i++ {
+			pick -= float64(nearest[i])
+			if pick <= 0 {
+				break
+			}
+		}
+		centres = append(centres, samples[i])
+	}
+
+	cluster := make([]int, len(samples))
+	for iteration := 0; iteration < kMeansIterations; iteration++ {
+		changed := false
+		for i, s := range samples {
+			best, bestDistance := 0, float32(math.Inf(1))
+			for j, c := range centres {
+				if d := distanceSqr(s, c); d < bestDistance {
+					best, bestDistance = j, d
+				}
+			}
+			if cluster[i] != best || iteration == 0 {
+				cluster[i] = best
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+
+		sums := make([]mgl32.Vec3, len(centres))
+		counts := make([]int, len(centres))
+		for i, s := range samples {
+			sums[cluster[i]] = sums[cluster[i]].Add(s)
+			counts[cluster[i]]++
+		}
+		for j := range centres {
+			if counts[j] > 0 {
+				centres[j] = sums[j].Mul(1 / float32(counts[j]))
+			}
+		}
+	}
+	return centres
+}
+
+// medianCut splits samples into at most n boxes, each time halving the box with the widest spread
+// along its widest axis, and returns the mean of each box.
+func medianCut(samples []mgl32.Vec3, n int) []mgl32.Vec3 {
+	// spread returns the widest axis of box and its range along it
+	spread := func(box []mgl32.Vec3) (int, float32) {
+		lo, hi := box[0], box[0]
+		for _, s := range box {
+			for i := range s {
+				lo[i], hi[i] = min(lo[i], s[i]), max(hi[i], s[i])
+			}
+		}
+		axis := 0
+		for i := range lo {
+			if hi[i]-lo[i] > hi[axis]-lo[axis] {
+				axis = i
+			}
+		}
+		return axis, hi[axis] - lo[axis]
+	}
+
+	boxes := [][]mgl32.Vec3{slices.Clone(samples)}
+	for len(boxes) < n {
+		widest, widestAxis, widestRange := -1, 0, float32(0)
+		for i, box := range boxes {
+			if axis, r := spread(box); r > widestRange {
+				widest, widestAxis, widestRange = i, axis, r
+			}
+		}
+		if widest < 0 {
+			break // every box is a single colour
+		}
+
+		box := boxes[widest]
+		slices.SortFunc(box, func(a, b mgl32.Vec3) int {
+			switch {
+			case a[widestAxis] < b[widestAxis]:
+				return -1
+			case a[widestAxis] > b[widestAxis]:
+				return 1
+			default:
+				return 0
+			}
+		})
+		boxes[widest] = box[:len(box)/2]
+		boxes = append(boxes, box[len(box)/2:])
+	}
+
+	colours := make([]mgl32.Vec3, len(boxes))
+	for i, box := range boxes {
+		var sum mgl32.Vec3
+		for _, s := range box {
+			sum = sum.Add(s)
+		}
+		colours[i] = sum.Mul(1 / float32(len(box)))
+	}
+	return colours
+}
+
+// orderColours sorts OKLab colours into order.
+func orderColours(colours []mgl32.Vec3, order PalletOrder) []mgl32.Vec3 {
+	colours = slices.Clone(colours)
+	by := func(key func(mgl32.Vec3) float32) {
+		slices.SortStableFunc(colours, func(a, b mgl32.Vec3) int {
+			switch ka, kb := key(a), key(b); {
+			case ka < kb:
+				return -1
+			case ka > kb:
+				return 1
+			default:
+				return 0
+			}
+		})
+	}
+
+	by(func(c mgl32.Vec3) float32 { return c[0] })
+	switch order {
+	case OrderHue:
+		by(func(c mgl32.Vec3) float32 { return float32(math.Atan2(float64(c[2]), float64(c[1]))) })
+
+	case OrderNearest:
+		for i := 1; i < len(colours); i++ {
+			next := i
+			for j := i + 1; j < len(colours); j++ {
+				if distanceSqr(colours[i-1], colours[j]) < distanceSqr(colours[i-1], colours[next]) {
+					next = j
+				}
+			}
+			colours[i], colours[next] = colours[next], colours[i]
+		}
+	}
+	return colours
+}
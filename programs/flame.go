@@ -0,0 +1,424 @@
+package programs
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+)
+
+// Flame is a fractal flame, the attractor of a set of transforms applied one at a time at random,
+// as made popular by Scott Draves' flam3 and Apophysis.
+// An iterated function system is a flame whose transforms are only linear.
+type Flame struct {
+	Transforms []FlameTransform
+	Final      *FlameTransform // applied to each point before it's plotted, if not nil
+
+	Brightness float64 // of the log density tone map
+	Gamma      float64
+	Vibrancy   float64 // how much gamma is applied to the brightness instead of each colour channel, from 0 to 1
+}
+
+// FlameTransform is one of the transforms of a flame,
+// an affine transform followed by a weighted sum of variations and another affine transform.
+type FlameTransform struct {
+	Weight      float64 // chance of being picked, relative to the other transforms
+	Colour      float64 // position along the pallet, usually from 0 to 1, that points move towards
+	ColourSpeed float64 // how far points move towards Colour, usually from 0 to 1
+	Affine      Affine
+	Post        Affine
+	Variations  []FlameVariation
+}
+
+// FlameVariation is a nonlinear function of a flame transform, with its weight in the sum.
+type FlameVariation struct {
+	Kind   Variation
+	Weight float64
+}
+
+// Affine is the coefficients of an affine transform in flam3's order,
+// so x' = A[0]x + A[2]y + A[4] and y' = A[1]x + A[3]y + A[5].
+type Affine [6]float64
+
+// IdentityAffine leaves points where they are.
+var IdentityAffine = Affine{1, 0, 0, 1, 0, 0}
+
+func (a Affine) Apply(z complex128) complex128 {
+	x, y := real(z), imag(z)
+	return complex(a[0]*x+a[2]*y+a[4], a[1]*x+a[3]*y+a[5])
+}
+
+// Variation is a nonlinear function flame transforms are made from.
+// They are the same as flam3's, with θ measured from the y axis like it does.
+type Variation int
+
+const (
+	VariationLinear Variation = iota
+	VariationSinusoidal
+	VariationSpherical
+	VariationSwirl
+	VariationHorseshoe
+	VariationPolar
+	VariationHandkerchief
+	VariationHeart
+	VariationDisc
+	VariationSpiral
+	VariationHyperbolic
+	VariationDiamond
+	VariationEx
+	VariationJulia
+	VariationBent
+	VariationWaves
+	VariationFisheye
+	VariationPopcorn
+	VariationExponential
+	VariationPower
+	VariationCosine
+	VariationRings
+	VariationFan
+	VariationEyefish
+	VariationBubble
+	VariationCylinder
+	VariationTangent
+	VariationCross
+	VariationBlur
+	VariationNoise
+	VariationSquare
+)
+
+// VariationNames are flam3's names for the variations, used as attributes in its files.
+var VariationNames = []string{
+	"linear", "sinusoidal", "spherical", "swirl", "horseshoe", "polar", "handkerchief", "heart",
+	"disc", "spiral", "hyperbolic", "diamond", "ex", "julia", "bent", "waves",
+	"fisheye", "popcorn", "exponential", "power", "cosine", "rings", "fan", "eyefish",
+	"bubble", "cylinder", "tangent", "cross", "blur", "noise", "square",
+}
+
+func (v Variation) String() string { return VariationNames[v] }
+
+// FlameProgram is the name of the program that renders flames.
+const FlameProgram = "Fractal Flame"
+
+// flameEpsilon keeps variations that divide by the distance from the origin finite there.
+const flameEpsilon = 1e-10
+
+// flameFuse is the number of times a new point is transformed before it's plotted,
+// so it has reached the attractor.
+const flameFuse = 20
+
+// apply returns the variation of z, the point after the transform's affine.
+func (v Variation) apply(t *FlameTransform, z complex128, random *rand.Rand) complex128 {
+	x, y := real(z), imag(z)
+	r2 := x*x + y*y
+	r := math.Sqrt(r2)
+	theta := math.Atan2(x, y)
+	sin, cos := x/(r+flameEpsilon), y/(r+flameEpsilon)
+
+	switch v {
+	case VariationSinusoidal:
+		return complex(math.Sin(x), math.Sin(y))
+	case VariationSpherical:
+		return complex(x/(r2+flameEpsilon), y/(r2+flameEpsilon))
+	case VariationSwirl:
+		s, c := math.Sincos(r2)
+		return complex(x*s-y*c, x*c+y*s)
+	case VariationHorseshoe:
+		r += flameEpsilon
+		return complex((x-y)*(x+y)/r, 2*x*y/r)
+	case VariationPolar:
+		return complex(theta/math.Pi, r-1)
+	case VariationHandkerchief:
+		return complex(r*math.Sin(theta+r), r*math.Cos(theta-r))
+	case VariationHeart:
+		s, c := math.Sincos(theta * r)
+		return complex(r*s, -r*c)
+	case VariationDisc:
+		s, c := math.Sincos(math.Pi * r)
+		return complex(theta/math.Pi*s, theta/math.Pi*c)
+	case VariationSpiral:
+		r += flameEpsilon
+		return complex((cos+math.Sin(r))/r, (sin-math.Cos(r))/r)
+	case VariationHyperbolic:
+		return complex(sin/(r+flameEpsilon), r*cos)
+	case VariationDiamond:
+		return complex(sin*math.Cos(r), cos*math.Sin(r))
+	case VariationEx:
+		n0, n1 := math.Sin(theta+r), math.Cos(theta-r)
+		m0, m1 := n0*n0*n0, n1*n1*n1
+		return complex(r*(m0+m1), r*(m0-m1))
+	case VariationJulia:
+		a := theta / 2
+		if random.Intn(2) == 0 {
+			a += math.Pi
+		}
+		s, c := math.Sincos(a)
+		r = math.Sqrt(r)
+		return complex(r*c, r*s)
+	case VariationBent:
+		if x < 0 {
+			x *= 2
+		}
+		if y < 0 {
+			y /= 2
+		}
+		return complex(x, y)
+	case VariationWaves:
+		a := &t.Affine
+		return complex(
+			x+a[2]*math.Sin(y/(a[4]*a[4]+flameEpsilon)),
+			y+a[3]*math.Sin(x/(a[5]*a[5]+flameEpsilon)),
+		)
+	case VariationFisheye:
+		r = 2 / (r + 1)
+		return complex(r*y, r*x)
+	case VariationPopcorn:
+		a := &t.Affine
+		return complex(x+a[4]*math.Sin(math.Tan(3*y)), y+a[5]*math.Sin(math.Tan(3*x)))
+	case VariationExponential:
+		s, c := math.Sincos(math.Pi * y)
+		d := math.Exp(x - 1)
+		return complex(d*c, d*s)
+	case VariationPower:
+		r = math.Pow(r, sin)
+		return complex(r*cos, r*sin)
+	case VariationCosine:
+		s, c := math.Sincos(math.Pi * x)
+		return complex(c*math.Cosh(y), -s*math.Sinh(y))
+	case VariationRings:
+		d := t.Affine[4]*t.Affine[4] + flameEpsilon
+		r = math.Mod(r+d, 2*d) - d + r*(1-d)
+		return complex(r*cos, r*sin)
+	case VariationFan:
+		d := math.Pi * (t.Affine[4]*t.Affine[4] + flameEpsilon)
+		a := theta
+		if math.Mod(a+t.Affine[5], d) > d/2 {
+			a -= d / 2
+		} else {
+			a += d / 2
+		}
+		s, c := math.Sincos(a)
+		return complex(r*c, r*s)
+	case VariationEyefish:
+		r = 2 / (r + 1)
+		return complex(r*x, r*y)
+	case VariationBubble:
+		r = 4 / (r2 + 4)
+		return complex(r*x, r*y)
+	case VariationCylinder:
+		return complex(math.Sin(x), y)
+	case VariationTangent:
+		return complex(math.Sin(x)/math.Cos(y), math.Tan(y))
+	case VariationCross:
+		s := x*x - y*y
+		r = math.Sqrt(1 / (s*s + flameEpsilon))
+		return complex(x*r, y*r)
+	case VariationBlur:
+		s, c := math.Sincos(2 * math.Pi * random.Float64())
+		r = random.Float64()
+		return complex(r*c, r*s)
+	case VariationNoise:
+		s, c := math.Sincos(2 * math.Pi * random.Float64())
+		r = random.Float64()
+		return complex(x*r*c, y*r*s)
+	case VariationSquare:
+		return complex(random.Float64()-.5, random.Float64()-.5)
+	default:
+		return z
+	}
+}
+
+// Apply transforms a point and its position along the pallet.
+func (t *FlameTransform) Apply(p ChaosPoint, random *rand.Rand) ChaosPoint {
+	z := t.Affine.Apply(p.Z)
+
+	var sum complex128
+	for _, v := range t.Variations {
+		sum += complex(v.Weight, 0) * v.Kind.apply(t, z, random)
+	}
+
+	return ChaosPoint{
+		Z:      t.Post.Apply(sum),
+		Colour: p.Colour*(1-t.ColourSpeed) + t.Colour*t.ColourSpeed,
+	}
+}
+
+// NewFlameTransform returns a transform with only the given affine and a linear variation,
+// the transforms of an iterated function system.
+func NewFlameTransform(weight, colour float64, affine Affine) FlameTransform {
+	return FlameTransform{
+		Weight:      weight,
+		Colour:      colour,
+		ColourSpeed: .5,
+		Affine:      affine,
+		Post:        IdentityAffine,
+		Variations:  []FlameVariation{{VariationLinear, 1}},
+	}
+}
+
+// Clone returns a copy of the flame that can be edited without changing the original,
+// as copies of Uniforms share their flame's transforms.
+func (f Flame) Clone() Flame {
+	f.Transforms = slices.Clone(f.Transforms)
+	for i := range f.Transforms {
+		f.Transforms[i].Variations = slices.Clone(f.Transforms[i].Variations)
+	}
+	if f.Final != nil {
+		final := *f.Final
+		final.Variations = slices.Clone(final.Variations)
+		f.Final = &final
+	}
+	return f
+}
+
+// Lerp returns the flame a fraction t of the way to another,
+// or false if their transforms and variations don't match, so they can't be mixed.
+func (f Flame) Lerp(to Flame, t float64) (Flame, bool) {
+	if len(f.Transforms) != len(to.Transforms) || (f.Final == nil) != (to.Final == nil) {
+		return f, false
+	}
+
+	lerp := func(a, b float64) float64 {
+		return a + (b-a)*t
+	}
+	mix := func(a, b *FlameTransform) (FlameTransform, bool) {
+		if len(a.Variations) != len(b.Variations) {
+			return *a, false
+		}
+
+		m := FlameTransform{
+			Weight:      lerp(a.Weight, b.Weight),
+			Colour:      lerp(a.Colour, b.Colour),
+			ColourSpeed: lerp(a.ColourSpeed, b.ColourSpeed),
+			Variations:  make([]FlameVariation, len(a.Variations)),
+		}
+		for i := range m.Affine {
+			m.Affine[i] = lerp(a.Affine[i], b.Affine[i])
+			m.Post[i] = lerp(a.Post[i], b.Post[i])
+		}
+		for i, v := range a.Variations {
+			if v.Kind != b.Variations[i].Kind {
+				return *a, false
+			}
+			m.Variations[i] = FlameVariation{v.Kind, lerp(v.Weight, b.Variations[i].Weight)}
+		}
+		return m, true
+	}
+
+	m := Flame{
+		Transforms: make([]FlameTransform, len(f.Transforms)),
+		Brightness: lerp(f.Brightness, to.Brightness),
+		Gamma:      lerp(f.Gamma, to.Gamma),
+		Vibrancy:   lerp(f.Vibrancy, to.Vibrancy),
+	}
+	for i := range f.Transforms {
+		var ok bool
+		if m.Transforms[i], ok = mix(&f.Transforms[i], &to.Transforms[i]); !ok {
+			return f, false
+		}
+	}
+	if f.Final != nil {
+		final, ok := mix(f.Final, to.Final)
+		if !ok {
+			return f, false
+		}
+		m.Final = &final
+	}
+	return m, true
+}
+
+// IsFlame returns true if the program plays the chaos game with the flame of its uniforms.
+func (p *Program) IsFlame() bool {
+	return p.Density != nil && p.Density.Chaos != nil
+}
+
+// pick returns a transform at random, in proportion to their weights, or nil if there are none.
+func (f *Flame) pick(random *rand.Rand) *FlameTransform {
+	var total float64
+	for _, t := range f.Transforms {
+		total += max(t.Weight, 0)
+	}
+	if total <= 0 {
+		return nil
+	}
+
+	n := random.Float64() * total
+	for i := range f.Transforms {
+		n -= max(f.Transforms[i].Weight, 0)
+		if n < 0 {
+			return &f.Transforms[i]
+		}
+	}
+	return &f.Transforms[len(f.Transforms)-1]
+}
+
+// flameChaos moves the point by one of the flame's transforms, and plots it after the final transform.
+func flameChaos(uniforms *Uniforms, random *rand.Rand, p ChaosPoint) (ChaosPoint, ChaosPoint, bool) {
+	t := uniforms.Flame.pick(random)
+	if t == nil {
+		return p, p, false
+	}
+
+	p = t.Apply(p, random)
+	if final := uniforms.Flame.Final; final != nil {
+		return p, final.Apply(p, random), true
+	}
+	return p, p, true
+}
+
+// FlamePreset is a built-in flame.
+type FlamePreset struct {
+	Name  string
+	Flame func() Flame
+}
+
+// FlamePresets are the built-in flames, the classic iterated function systems first.
+var FlamePresets = []FlamePreset{
+	{"Swirl", DefaultFlame},
+	{"Sierpinski Triangle", func() Flame {
+		return Flame{
+			Transforms: []FlameTransform{
+				NewFlameTransform(1, 0, Affine{.5, 0, 0, .5, -.5, .5}),
+				NewFlameTransform(1, .5, Affine{.5, 0, 0, .5, .5, .5}),
+				NewFlameTransform(1, 1, Affine{.5, 0, 0, .5, 0, -.5}),
+			},
+			Brightness: 4, Gamma: 4, Vibrancy: 1,
+		}
+	}},
+	{"Barnsley Fern", func() Flame {
+		return Flame{
+			Transforms: []FlameTransform{
+				NewFlameTransform(.01, 0, Affine{0, 0, 0, .16, 0, 0}),
+				NewFlameTransform(.85, .3, Affine{.85, -.04, .04, .85, 0, 1.6}),
+				NewFlameTransform(.07, .6, Affine{.2, .23, -.26, .22, 0, 1.6}),
+				NewFlameTransform(.07, 1, Affine{-.15, .26, .28, .24, 0, .44}),
+			},
+			Final:      &FlameTransform{Weight: 1, Affine: Affine{.2, 0, 0, -.2, 0, 1}, Post: IdentityAffine, Variations: []FlameVariation{{VariationLinear, 1}}},
+			Brightness: 4, Gamma: 4, Vibrancy: 1,
+		}
+	}},
+}
+
+// DefaultFlame returns the flame the config window starts with.
+func DefaultFlame() Flame {
+	spherical := NewFlameTransform(1, 0, Affine{-.68, .42, -.42, -.68, .3, .1})
+	spherical.Variations = []FlameVariation{{VariationSpherical, 1}}
+	swirl := NewFlameTransform(1, .5, Affine{.55, .1, -.1, .55, -.6, .3})
+	swirl.Variations = []FlameVariation{{VariationSwirl, .6}, {VariationLinear, .4}}
+	julia := NewFlameTransform(.4, 1, Affine{.4, 0, 0, .4, .6, -.5})
+	julia.Variations = []FlameVariation{{VariationJulia, 1}}
+
+	return Flame{
+		Transforms: []FlameTransform{spherical, swirl, julia},
+		Brightness: 4,
+		Gamma:      4,
+		Vibrancy:   1,
+	}
+}
+
+func init() {
+	NewProgram(Program{
+		Name:           FlameProgram,
+		VertexShader:   defaultVertexShader,
+		FragmentShader: densityFragment,
+		Density:        &Density{Channels: 4, Chaos: flameChaos},
+	})
+}
@@ -0,0 +1,353 @@
+package programs
+
+import (
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// flam3Colours is the number of colours in a flam3 palette.
+const flam3Colours = 256
+
+// flam3Flame is a <flame> element of a flam3 or Apophysis file.
+type flam3Flame struct {
+	XMLName    xml.Name      `xml:"flame"`
+	Name       string        `xml:"name,attr,omitempty"`
+	Size       string        `xml:"size,attr"`
+	Center     string        `xml:"center,attr"`
+	Scale      float64       `xml:"scale,attr"`
+	Zoom       float64       `xml:"zoom,attr,omitempty"`
+	Quality    float64       `xml:"quality,attr,omitempty"`
+	Background string        `xml:"background,attr,omitempty"`
+	Brightness string        `xml:"brightness,attr"`
+	Gamma      string        `xml:"gamma,attr"`
+	Vibrancy   string        `xml:"vibrancy,attr"`
+	XForms     []flam3XForm  `xml:"xform"`
+	Final      *flam3XForm   `xml:"finalxform"`
+	Colours    []flam3Colour `xml:"color"`
+	Palette    *flam3Palette `xml:"palette"`
+}
+
+// flam3XForm is a transform, whose variations are attributes named after them.
+type flam3XForm struct {
+	Attrs []xml.Attr `xml:",any,attr"`
+}
+
+type flam3Colour struct {
+	Index int    `xml:"index,attr"`
+	RGB   string `xml:"rgb,attr"`
+}
+
+// flam3Palette is the colours of a palette in hex, six digits each.
+type flam3Palette struct {
+	Count  int    `xml:"count,attr"`
+	Format string `xml:"format,attr"`
+	Hex    string `xml:",chardata"`
+}
+
+var ErrNoFlame = errors.New("no <flame> element in the file")
+
+// ReadFlame reads the first flame in a flam3 or Apophysis file into uniforms,
+// along with its view, quality, background and palette, returning the size of the image it was made for.
+//
+// Rotation and variations it doesn't know are left out, so such flames won't look the same.
+func ReadFlame(r io.Reader, uniforms *Uniforms) (width, height int, err error) {
+	var f flam3Flame
+	d := xml.NewDecoder(r)
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			return 0, 0, ErrNoFlame
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == "flame" {
+			if err := d.DecodeElement(&f, &start); err != nil {
+				return 0, 0, err
+			}
+			break
+		}
+	}
+
+	size, err := parseFloats(f.Size, 2)
+	if err != nil {
+		return 0, 0, fmt.Errorf("size: %w", err)
+	}
+	width, height = int(size[0]), int(size[1])
+	if width <= 0 || height <= 0 {
+		return 0, 0, fmt.Errorf("size %q isn't positive", f.Size)
+	}
+
+	center := []float64{0, 0}
+	if f.Center != "" {
+		if center, err = parseFloats(f.Center, 2); err != nil {
+			return 0, 0, fmt.Errorf("center: %w", err)
+		}
+	}
+
+	flame := Flame{Brightness: 4, Gamma: 4, Vibrancy: 1}
+	for _, a := range []struct {
+		s string
+		v *float64
+	}{{f.Brightness, &flame.Brightness}, {f.Gamma, &flame.Gamma}, {f.Vibrancy, &flame.Vibrancy}} {
+		if a.s == "" {
+			continue
+		}
+		if *a.v, err = strconv.ParseFloat(a.s, 64); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	for i, x := range f.XForms {
+		t, err := x.transform()
+		if err != nil {
+			return 0, 0, fmt.Errorf("xform %v: %w", i+1, err)
+		}
+		flame.Transforms = append(flame.Transforms, t)
+	}
+	if len(flame.Transforms) == 0 {
+		return 0, 0, errors.New("the flame has no xforms")
+	}
+	if f.Final != nil {
+		t, err := f.Final.transform()
+		if err != nil {
+			return 0, 0, fmt.Errorf("finalxform: %w", err)
+		}
+		flame.Final = &t
+	}
+
+	pallet, err := f.pallet()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var background []float64
+	if f.Background != "" {
+		if background, err = parseFloats(f.Background, 3); err != nil {
+			return 0, 0, fmt.Errorf("background: %w", err)
+		}
+	}
+
+	scale := f.Scale * math.Pow(2, f.Zoom)
+	if scale <= 0 {
+		return 0, 0, fmt.Errorf("scale %v isn't positive", f.Scale)
+	}
+
+	if pallet != nil {
+		uniforms.ColourPallet = pallet
+		uniforms.PalletScale = 1
+		uniforms.PalletOffset = 0
+	}
+	if background != nil {
+		uniforms.EmptyColour = mgl32.Vec3{float32(background[0]), float32(background[1]), float32(background[2])}
+	}
+	uniforms.Flame = flame
+	uniforms.Zoom = float64(max(width, height)) / 2 / scale
+	uniforms.Pos[0], uniforms.Pos[1] = -center[0], center[1]
+	if f.Quality > 0 {
+		uniforms.DensitySamples = f.Quality
+	}
+	return width, height, nil
+}
+
+func (x *flam3XForm) transform() (FlameTransform, error) {
+	t := FlameTransform{
+		Weight:      1,
+		ColourSpeed: .5,
+		Affine:      IdentityAffine,
+		Post:        IdentityAffine,
+	}
+
+	for _, a := range x.Attrs {
+		var err error
+		switch name := a.Name.Local; name {
+		case "weight":
+			t.Weight, err = strconv.ParseFloat(a.Value, 64)
+		case "color":
+			// older files give two colours; only the first is used
+			t.Colour, err = strconv.ParseFloat(strings.Fields(a.Value + " 0")[0], 64)
+		case "color_speed":
+			t.ColourSpeed, err = strconv.ParseFloat(a.Value, 64)
+		case "symmetry":
+			var symmetry float64
+			if symmetry, err = strconv.ParseFloat(a.Value, 64); err == nil && !x.has("color_speed") {
+				t.ColourSpeed = (1 - symmetry) / 2
+			}
+		case "coefs", "post":
+			var coefs []float64
+			if coefs, err = parseFloats(a.Value, 6); err == nil {
+				affine := &t.Affine
+				if name == "post" {
+					affine = &t.Post
+				}
+				copy(affine[:], coefs)
+			}
+		default:
+			for v, n := range VariationNames {
+				if n != name {
+					continue
+				}
+				var weight float64
+				if weight, err = strconv.ParseFloat(a.Value, 64); err == nil && weight != 0 {
+					t.Variations = append(t.Variations, FlameVariation{Variation(v), weight})
+				}
+			}
+		}
+		if err != nil {
+			return t, fmt.Errorf("%v: %w", a.Name.Local, err)
+		}
+	}
+	return t, nil
+}
+
+func (x *flam3XForm) has(name string) bool {
+	for _, a := range x.Attrs {
+		if a.Name.Local == name {
+			return true
+		}
+	}
+	return false
+}
+
+// pallet returns the flame's palette, or nil if it has none.
+func (f *flam3Flame) pallet() (ColourPallet, error) {
+	if len(f.Colours) > 0 {
+		pallet := make(ColourPallet, flam3Colours)
+		for _, c := range f.Colours {
+			rgb, err := parseFloats(c.RGB, 3)
+			if err != nil {
+				return nil, fmt.Errorf("color %v: %w", c.Index, err)
+			}
+			if c.Index < 0 || c.Index >= flam3Colours {
+				return nil, fmt.Errorf("color index %v is out of range", c.Index)
+			}
+			pallet[c.Index] = mgl32.Vec3{float32(rgb[0] / 255), float32(rgb[1] / 255), float32(rgb[2] / 255)}
+		}
+		return pallet, nil
+	}
+
+	if f.Palette == nil {
+		return nil, nil
+	}
+	if f.Palette.Format != "" && !strings.EqualFold(f.Palette.Format, "RGB") {
+		return nil, fmt.Errorf("%v palettes can't be read", f.Palette.Format)
+	}
+	b, err := hex.DecodeString(strings.Join(strings.Fields(f.Palette.Hex), ""))
+	if err != nil {
+		return nil, fmt.Errorf("palette: %w", err)
+	}
+	if len(b) < 3 {
+		return nil, errors.New("the palette has no colours")
+	}
+	pallet := make(ColourPallet, len(b)/3)
+	for i := range pallet {
+		pallet[i] = mgl32.Vec3{float32(b[i*3]) / 255, float32(b[i*3+1]) / 255, float32(b[i*3+2]) / 255}
+	}
+	return pallet, nil
+}
+
+// WriteFlame writes the flame of uniforms as a flam3 file, viewed as in an image of the given size.
+// The pallet is written as the 256 colours flames are coloured from.
+func WriteFlame(w io.Writer, name string, uniforms *Uniforms, width, height int) error {
+	flame := &uniforms.Flame
+	bg := uniforms.EmptyColour
+	f := flam3Flame{
+		Name:       name,
+		Size:       fmt.Sprintf("%v %v", width, height),
+		Center:     formatFloats(-uniforms.Pos[0], uniforms.Pos[1]),
+		Scale:      float64(max(width, height)) / 2 / uniforms.Zoom,
+		Quality:    uniforms.DensitySamples,
+		Background: fmt.Sprintf("%v %v %v", bg[0], bg[1], bg[2]),
+		Brightness: formatFloats(flame.Brightness),
+		Gamma:      formatFloats(flame.Gamma),
+		Vibrancy:   formatFloats(flame.Vibrancy),
+	}
+
+	for i := range flame.Transforms {
+		f.XForms = append(f.XForms, flam3Transform(&flame.Transforms[i], true))
+	}
+	if flame.Final != nil {
+		final := flam3Transform(flame.Final, false)
+		f.Final = &final
+	}
+
+	for i := range flam3Colours {
+		t := float32(i) / (flam3Colours - 1)
+		c := uniforms.ColourPallet.At(t*float32(len(uniforms.ColourPallet)-1)*uniforms.PalletScale+float32(uniforms.PalletOffset), uniforms.PalletLinear)
+		f.Colours = append(f.Colours, flam3Colour{
+			Index: i,
+			RGB:   fmt.Sprintf("%v %v %v", math.Round(float64(c[0])*255), math.Round(float64(c[1])*255), math.Round(float64(c[2])*255)),
+		})
+	}
+
+	b, err := xml.MarshalIndent(f, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+func flam3Transform(t *FlameTransform, weighted bool) flam3XForm {
+	var x flam3XForm
+	attr := func(name, value string) {
+		x.Attrs = append(x.Attrs, xml.Attr{Name: xml.Name{Local: name}, Value: value})
+	}
+
+	if weighted {
+		attr("weight", formatFloats(t.Weight))
+	}
+	attr("color", formatFloats(t.Colour))
+	attr("color_speed", formatFloats(t.ColourSpeed))
+	attr("coefs", formatFloats(t.Affine[:]...))
+	if t.Post != IdentityAffine {
+		attr("post", formatFloats(t.Post[:]...))
+	}
+
+	// flam3 only allows each variation once, so repeats are added together
+	weights := make(map[Variation]float64)
+	var order []Variation
+	for _, v := range t.Variations {
+		if _, ok := weights[v.Kind]; !ok {
+			order = append(order, v.Kind)
+		}
+		weights[v.Kind] += v.Weight
+	}
+	for _, v := range order {
+		attr(v.String(), formatFloats(weights[v]))
+	}
+	return x
+}
+
+// parseFloats parses n numbers separated by spaces.
+func parseFloats(s string, n int) ([]float64, error) {
+	fields := strings.Fields(s)
+	if len(fields) != n {
+		return nil, fmt.Errorf("%q isn't %v numbers", s, n)
+	}
+
+	floats := make([]float64, n)
+	for i, field := range fields {
+		var err error
+		if floats[i], err = strconv.ParseFloat(field, 64); err != nil {
+			return nil, err
+		}
+	}
+	return floats, nil
+}
+
+func formatFloats(floats ...float64) string {
+	s := make([]string, len(floats))
+	for i, f := range floats {
+		s[i] = strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return strings.Join(s, " ")
+}
@@ -0,0 +1,175 @@
+package programs
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+func TestFlameRoundTrip(t *testing.T) {
+	// 8 bit colours, so the 256 written are exactly the pallet
+	pallet := make(ColourPallet, flam3Colours)
+	for i := range pallet {
+		pallet[i] = mgl32.Vec3{float32(i) / 255, float32(255-i) / 255, float32(i*7%256) / 255}
+	}
+
+	custom := Flame{
+		Transforms: []FlameTransform{
+			{
+				Weight:      2.5,
+				Colour:      .25,
+				ColourSpeed: .75,
+				Affine:      Affine{.5, -.25, .25, .5, 1, -1},
+				Post:        Affine{1, .1, -.1, 1, .3, 0},
+				Variations:  []FlameVariation{{VariationSpherical, .5}, {VariationSwirl, -.25}},
+			},
+			NewFlameTransform(.5, 1, Affine{-.5, 0, 0, .5, 0, .5}),
+		},
+		Final: &FlameTransform{
+			Weight:      1,
+			Colour:      .5,
+			ColourSpeed: 0,
+			Affine:      IdentityAffine,
+			Post:        IdentityAffine,
+			Variations:  []FlameVariation{{VariationJulia, 1}},
+		},
+		Brightness: 3,
+		Gamma:      2.2,
+		Vibrancy:   .5,
+	}
+
+	tests := []struct {
+		name          string
+		flame         Flame
+		width, height int
+	}{
+		{"custom", custom, 1024, 768},
+	}
+	for _, preset := range FlamePresets {
+		tests = append(tests, struct {
+			name          string
+			flame         Flame
+			width, height int
+		}{preset.Name, preset.Flame(), 800, 800})
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var in Uniforms
+			in.DefaultValues()
+			in.Flame = test.flame
+			in.ColourPallet = pallet
+			in.PalletScale = 1
+			in.Zoom = .37
+			in.Pos[0], in.Pos[1] = .125, -2
+			in.EmptyColour = mgl32.Vec3{.1, .2, .3}
+			in.DensitySamples = 50
+
+			var b bytes.Buffer
+			if err := WriteFlame(&b, test.name, &in, test.width, test.height); err != nil {
+				t.Fatal(err)
+			}
+
+			var out Uniforms
+			out.DefaultValues()
+			width, height, err := ReadFlame(&b, &out)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if width != test.width || height != test.height {
+				t.Errorf("size is %vx%v, not %vx%v", width, height, test.width, test.height)
+			}
+			if !reflect.DeepEqual(out.Flame, in.Flame) {
+				t.Errorf("flame is\n%+v\nnot\n%+v", out.Flame, in.Flame)
+			}
+			if !reflect.DeepEqual(out.ColourPallet, in.ColourPallet) {
+				t.Errorf("pallet is %v, not %v", out.ColourPallet, in.ColourPallet)
+			}
+			if math.Abs(out.Zoom-in.Zoom) > 1e-12 {
+				t.Errorf("zoom is %v, not %v", out.Zoom, in.Zoom)
+			}
+			if out.Pos != in.Pos {
+				t.Errorf("position is %v, not %v", out.Pos, in.Pos)
+			}
+			if out.EmptyColour != in.EmptyColour {
+				t.Errorf("background is %v, not %v", out.EmptyColour, in.EmptyColour)
+			}
+			if out.DensitySamples != in.DensitySamples {
+				t.Errorf("quality is %v, not %v", out.DensitySamples, in.DensitySamples)
+			}
+		})
+	}
+}
+
+func TestReadFlame(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		want    Flame
+		zoom    float64
+		colours int
+		err     bool
+	}{
+		{
+			name: "apophysis",
+			file: `<flames><flame name="a" size="200 100" center="1 2" scale="50" zoom="1">
+				<xform weight="0.5" color="0.25 0" symmetry="0.5" coefs="1 0 0 1 0 0" linear="1" julia="0"/>
+				<finalxform color="1" color_speed="0" coefs="1 0 0 1 0 0" post="2 0 0 2 0 0" spherical="1"/>
+				<palette count="2" format="RGB">FF0000 0000FF</palette>
+			</flame></flames>`,
+			want: Flame{
+				Transforms: []FlameTransform{{
+					Weight: .5, Colour: .25, ColourSpeed: .25,
+					Affine: IdentityAffine, Post: IdentityAffine,
+					Variations: []FlameVariation{{VariationLinear, 1}},
+				}},
+				Final: &FlameTransform{
+					Weight: 1, Colour: 1,
+					Affine: IdentityAffine, Post: Affine{2, 0, 0, 2, 0, 0},
+					Variations: []FlameVariation{{VariationSpherical, 1}},
+				},
+				Brightness: 4, Gamma: 4, Vibrancy: 1,
+			},
+			zoom:    1,
+			colours: 2,
+		},
+		{name: "no flame", file: `<flames></flames>`, err: true},
+		{name: "no xforms", file: `<flame size="1 1" scale="1"></flame>`, err: true},
+		{name: "bad size", file: `<flame size="1" scale="1"><xform coefs="1 0 0 1 0 0"/></flame>`, err: true},
+		{name: "bad coefs", file: `<flame size="1 1" scale="1"><xform coefs="1 0 0"/></flame>`, err: true},
+		{name: "zero scale", file: `<flame size="1 1" scale="0"><xform coefs="1 0 0 1 0 0"/></flame>`, err: true},
+		{name: "colour out of range", file: `<flame size="1 1" scale="1"><xform coefs="1 0 0 1 0 0"/><color index="256" rgb="0 0 0"/></flame>`, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var uniforms Uniforms
+			uniforms.DefaultValues()
+			_, _, err := ReadFlame(strings.NewReader(test.file), &uniforms)
+			if test.err {
+				if err == nil {
+					t.Fatal("no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(uniforms.Flame, test.want) {
+				t.Errorf("flame is\n%+v\nnot\n%+v", uniforms.Flame, test.want)
+			}
+			if uniforms.Zoom != test.zoom {
+				t.Errorf("zoom is %v, not %v", uniforms.Zoom, test.zoom)
+			}
+			if len(uniforms.ColourPallet) != test.colours {
+				t.Errorf("pallet has %v colours, not %v", len(uniforms.ColourPallet), test.colours)
+			}
+		})
+	}
+}
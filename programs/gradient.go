@@ -0,0 +1,150 @@
+package programs
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Interpolation is the colour space a gradient's stops are mixed in.
+type Interpolation int
+
+const (
+	InterpolateRGB Interpolation = iota
+	InterpolateHSV
+	InterpolateOKLab
+)
+
+var InterpolationNames = []string{"RGB", "HSV", "OKLab"}
+
+func (i Interpolation) String() string { return InterpolationNames[i] }
+
+func (i Interpolation) MarshalText() ([]byte, error) {
+	return []byte(i.String()), nil
+}
+
+func (i *Interpolation) UnmarshalText(b []byte) error {
+	for j, name := range InterpolationNames {
+		if name == string(b) {
+			*i = Interpolation(j)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown interpolation %q", b)
+}
+
+// GradientStop is an sRGB colour at a position from 0 to 1 along a gradient.
+type GradientStop struct {
+	Pos    float32
+	Colour mgl32.Vec3
+}
+
+// Gradient makes a pallet by interpolating between colour stops.
+type Gradient struct {
+	Stops         []GradientStop
+	Interpolation Interpolation
+	Repeat        int // times the gradient is repeated over the pallet
+	Reverse       bool
+}
+
+// DefaultGradient returns a gradient from black to white.
+func DefaultGradient() Gradient {
+	return Gradient{
+		Stops: []GradientStop{
+			{Pos: 0, Colour: mgl32.Vec3{0, 0, 0}},
+			{Pos: 1, Colour: mgl32.Vec3{1, 1, 1}},
+		},
+		Repeat: 1,
+	}
+}
+
+// Sort orders the stops by position, as they are after being moved.
+func (g *Gradient) Sort() {
+	slices.SortStableFunc(g.Stops, func(a, b GradientStop) int {
+		switch {
+		case a.Pos < b.Pos:
+			return -1
+		case a.Pos > b.Pos:
+			return 1
+		default:
+			return 0
+		}
+	})
+}
+
+// At returns the colour at t from 0 to 1 along the gradient, ignoring Repeat and Reverse.
+// The stops must be sorted.
+func (g Gradient) At(t float32) mgl32.Vec3 {
+	if len(g.Stops) == 0 {
+		return mgl32.Vec3{}
+	}
+
+	next, _ := slices.BinarySearchFunc(g.Stops, t, func(s GradientStop, t float32) int {
+		switch {
+		case s.Pos < t:
+			return -1
+		case s.Pos > t:
+			return 1
+		default:
+			return 0
+		}
+	})
+	if next == 0 {
+		return g.Stops[0].Colour
+	}
+	if next == len(g.Stops) {
+		return g.Stops[len(g.Stops)-1].Colour
+	}
+
+	from, to := g.Stops[next-1], g.Stops[next]
+	if to.Pos == from.Pos {
+		return to.Colour
+	}
+	return g.Interpolation.mix(from.Colour, to.Colour, (t-from.Pos)/(to.Pos-from.Pos))
+}
+
+// mix interpolates between a and b, both sRGB, in the interpolation's colour space.
+func (i Interpolation) mix(a, b mgl32.Vec3, t float32) mgl32.Vec3 {
+	lerp := func(a, b mgl32.Vec3) mgl32.Vec3 {
+		return a.Add(b.Sub(a).Mul(t))
+	}
+
+	switch i {
+	case InterpolateHSV:
+		a, b = rgbToHSV(a), rgbToHSV(b)
+		// hue goes the short way round
+		if b[0]-a[0] > .5 {
+			a[0]++
+		} else if a[0]-b[0] > .5 {
+			b[0]++
+		}
+		return hsvToRGB(lerp(a, b))
+
+	case InterpolateOKLab:
+		return OKLabToSRGB(lerp(SRGBToOKLab(a), SRGBToOKLab(b)))
+
+	default:
+		return lerp(a, b)
+	}
+}
+
+// Pallet samples the gradient into a pallet of length colours, Repeat times over, reversed if Reverse is set.
+// Each repeat starts again from the first stop.
+func (g Gradient) Pallet(length int) ColourPallet {
+	// the stops are shared with the caller's gradient, so they're sorted in a copy
+	g.Stops = slices.Clone(g.Stops)
+	g.Sort()
+	repeat := max(g.Repeat, 1)
+
+	pallet := make(ColourPallet, max(length, 1))
+	for i := range pallet {
+		t := float32(i*repeat) / float32(len(pallet))
+		t -= float32(int(t))
+		if g.Reverse {
+			t = 1 - t
+		}
+		pallet[i] = g.At(t)
+	}
+	return pallet
+}
@@ -0,0 +1,225 @@
+package programs
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+//go:embed shaders/hybrid.frag
+var hybridFragment string
+
+var hybridTemplate = template.Must(template.New("hybrid").Parse(hybridFragment))
+
+// HybridFormula is a step a hybrid can take, written for both the GPU and the CPU.
+type HybridFormula struct {
+	Name   string
+	GLSL   string  // body of a function of z and c returning the next z
+	Degree float64 // dominant power of z, used to smooth the iteration count
+	Step   func(z, c complex128) complex128
+}
+
+// HybridFormulas are the formulas hybrids are built from, with the Mandelbrot variants after the Mandelbrot.
+var HybridFormulas = slices.Insert([]HybridFormula{
+	{
+		Name:   "Mandelbrot",
+		GLSL:   "return multiply(z, z) + c;",
+		Degree: 2,
+		Step: func(z, c complex128) complex128 {
+			return z*z + c
+		},
+	},
+	{
+		Name:   "Cubic",
+		GLSL:   "return multiply(z, multiply(z, z)) + c;",
+		Degree: 3,
+		Step: func(z, c complex128) complex128 {
+			return z*z*z + c
+		},
+	},
+	{
+		Name:   "Quartic",
+		GLSL:   "dvec2 z2 = multiply(z, z);\n    return multiply(z2, z2) + c;",
+		Degree: 4,
+		Step: func(z, c complex128) complex128 {
+			z2 := z * z
+			return z2*z2 + c
+		},
+	},
+}, 1, variantFormulas()...)
+
+// HybridFormulaByName returns the formula with the given name.
+func HybridFormulaByName(name string) (HybridFormula, bool) {
+	for _, f := range HybridFormulas {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return HybridFormula{}, false
+}
+
+// maxHybridSequence is the most iterations a hybrid's sequence can take before it repeats.
+const maxHybridSequence = 64
+
+// HybridStep is a formula repeated for some iterations of a hybrid's sequence.
+type HybridStep struct {
+	Formula string
+	Repeat  int
+}
+
+// Hybrid is a fractal that cycles through a sequence of formulas, one each iteration.
+//
+// Hybrids aren't registered with the other programs, as there are too many.
+// Instead their names describe their sequence, so ProgramByName can build them again.
+type Hybrid struct {
+	Steps []HybridStep
+	Julia bool
+}
+
+const (
+	hybridPrefix      = "Hybrid ("
+	hybridJuliaPrefix = "Hybrid Julia ("
+)
+
+// Name describes the hybrid, such as "Hybrid (2 Mandelbrot, Burning Ship)".
+func (h Hybrid) Name() string {
+	steps := make([]string, len(h.Steps))
+	for i, s := range h.Steps {
+		steps[i] = s.Formula
+		if s.Repeat != 1 {
+			steps[i] = strconv.Itoa(s.Repeat) + " " + s.Formula
+		}
+	}
+
+	prefix := hybridPrefix
+	if h.Julia {
+		prefix = hybridJuliaPrefix
+	}
+	return prefix + strings.Join(steps, ", ") + ")"
+}
+
+// ParseHybrid reads the sequence of a hybrid from its name.
+func ParseHybrid(name string) (Hybrid, error) {
+	var h Hybrid
+	steps, ok := strings.CutPrefix(name, hybridPrefix)
+	if !ok {
+		steps, h.Julia = strings.CutPrefix(name, hybridJuliaPrefix)
+		if !h.Julia {
+			return h, fmt.Errorf("%q is not a hybrid", name)
+		}
+	}
+	steps, ok = strings.CutSuffix(steps, ")")
+	if !ok {
+		return h, fmt.Errorf("%q is not a hybrid", name)
+	}
+
+	for _, step := range strings.Split(steps, ",") {
+		s := HybridStep{Formula: strings.TrimSpace(step), Repeat: 1}
+		if count, formula, ok := strings.Cut(s.Formula, " "); ok {
+			if n, err := strconv.Atoi(count); err == nil {
+				s.Formula, s.Repeat = formula, n
+			}
+		}
+		h.Steps = append(h.Steps, s)
+	}
+	return h, h.validate()
+}
+
+// sequence returns the index in formulas of the formula for each iteration of the sequence.
+func (h Hybrid) sequence() (formulas []HybridFormula, sequence []int) {
+	for _, s := range h.Steps {
+		f, _ := HybridFormulaByName(s.Formula)
+		i := slices.IndexFunc(formulas, func(g HybridFormula) bool { return g.Name == f.Name })
+		if i < 0 {
+			i = len(formulas)
+			formulas = append(formulas, f)
+		}
+		for range s.Repeat {
+			sequence = append(sequence, i)
+		}
+	}
+	return formulas, sequence
+}
+
+func (h Hybrid) validate() error {
+	if len(h.Steps) == 0 {
+		return errors.New("hybrid has no steps")
+	}
+
+	length := 0
+	for _, s := range h.Steps {
+		if _, ok := HybridFormulaByName(s.Formula); !ok {
+			return fmt.Errorf("no hybrid formula named %q", s.Formula)
+		}
+		if s.Repeat < 1 {
+			return fmt.Errorf("%v can't be repeated %v times", s.Formula, s.Repeat)
+		}
+		length += s.Repeat
+	}
+	if length > maxHybridSequence {
+		return fmt.Errorf("hybrid sequence is %v iterations long, the most is %v", length, maxHybridSequence)
+	}
+	return nil
+}
+
+// Program generates the shader and native implementation of the hybrid.
+// Parameter space and Julia space hybrids with the same steps are one family.
+func (h Hybrid) Program() (Program, error) {
+	if err := h.validate(); err != nil {
+		return Program{}, err
+	}
+
+	formulas, sequence := h.sequence()
+
+	var fragment strings.Builder
+	err := hybridTemplate.Execute(&fragment, struct {
+		Formulas []HybridFormula
+		Sequence []int
+	}{formulas, sequence})
+	if err != nil {
+		return Program{}, err
+	}
+
+	steps := make([]func(z, c complex128) complex128, len(sequence))
+	logDegree := 0.
+	for i, f := range sequence {
+		steps[i] = formulas[f].Step
+		logDegree += math.Log(formulas[f].Degree)
+	}
+	// the growth of each iteration, averaged over the sequence
+	degree := math.Exp(logDegree / float64(len(sequence)))
+
+	p := Program{
+		Name:           h.Name(),
+		Family:         Hybrid{Steps: h.Steps}.Name(),
+		Julia:          h.Julia,
+		VertexShader:   defaultVertexShader,
+		FragmentShader: fragment.String(),
+		GetData: func(uniforms Uniforms, pos mgl32.Vec2) PixelData {
+			z := uniforms.Point(pos)
+			c := z
+			if h.Julia {
+				c = complex(uniforms.JuliaC[0], uniforms.JuliaC[1])
+			}
+
+			i := 0
+			return escapeTime(uniforms, z, degree, func(z complex128) complex128 {
+				z = steps[i%len(steps)](z, c)
+				i++
+				return z
+			})
+		},
+	}
+	if h.Julia {
+		p.FragmentShader = juliaShader(p.FragmentShader)
+	}
+	p.GetPixel = colourData(p.GetData)
+	return p, nil
+}
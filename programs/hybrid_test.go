@@ -0,0 +1,85 @@
+package programs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHybridName(t *testing.T) {
+	tests := []struct {
+		name   string
+		hybrid Hybrid
+	}{
+		{"Hybrid (Mandelbrot)", Hybrid{Steps: []HybridStep{{"Mandelbrot", 1}}}},
+		{"Hybrid (2 Mandelbrot, Burning Ship)", Hybrid{Steps: []HybridStep{{"Mandelbrot", 2}, {"Burning Ship", 1}}}},
+		{"Hybrid Julia (Tricorn, 3 Quartic, Tricorn)", Hybrid{Steps: []HybridStep{{"Tricorn", 1}, {"Quartic", 3}, {"Tricorn", 1}}, Julia: true}},
+		{"Hybrid (64 Perpendicular)", Hybrid{Steps: []HybridStep{{"Perpendicular", 64}}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if name := test.hybrid.Name(); name != test.name {
+				t.Errorf("name is %q", name)
+			}
+
+			h, err := ParseHybrid(test.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(h, test.hybrid) {
+				t.Errorf("parsed %+v, not %+v", h, test.hybrid)
+			}
+
+			p, err := h.Program()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Name != test.name || p.Julia != test.hybrid.Julia {
+				t.Errorf("program is %q, Julia %v", p.Name, p.Julia)
+			}
+		})
+	}
+
+	// every formula can be named on its own
+	for _, f := range HybridFormulas {
+		h := Hybrid{Steps: []HybridStep{{f.Name, 1}}}
+		if parsed, err := ParseHybrid(h.Name()); err != nil || !reflect.DeepEqual(parsed, h) {
+			t.Errorf("%v parsed as %+v, %v", h.Name(), parsed, err)
+		}
+	}
+}
+
+func TestParseHybridErrors(t *testing.T) {
+	for _, name := range []string{
+		"Mandelbrot",
+		"Hybrid (Mandelbrot",
+		"Hybrid ()",
+		"Hybrid (Mandelbrot, Nothing)",
+		"Hybrid (0 Mandelbrot)",
+		"Hybrid (-1 Mandelbrot)",
+		"Hybrid (65 Mandelbrot)",
+		"Hybrid (40 Mandelbrot, 25 Cubic)",
+	} {
+		if _, err := ParseHybrid(name); err == nil {
+			t.Errorf("no error for %q", name)
+		}
+	}
+}
+
+// TestHybridFormulaVariants checks the variants' formulas are the same as their programs.
+func TestHybridFormulaVariants(t *testing.T) {
+	for _, v := range variants {
+		f, ok := HybridFormulaByName(v.formula)
+		if !ok {
+			t.Errorf("no hybrid formula for %v", v.name)
+			continue
+		}
+		if f.GLSL != v.glsl {
+			t.Errorf("%v's GLSL is %q, not %q", v.name, f.GLSL, v.glsl)
+		}
+		z, c := complex(.3, -.7), complex(-.1, .2)
+		if got, want := f.Step(z, c), v.step(z, c); got != want {
+			t.Errorf("%v steps to %v, not %v", v.name, got, want)
+		}
+	}
+}
@@ -2,7 +2,6 @@ package programs
 
 import (
 	_ "embed"
-	"math"
 
 	"github.com/go-gl/mathgl/mgl32"
 )
@@ -15,24 +14,12 @@ func init() {
 		Name:           "Julia (6th power)",
 		VertexShader:   defaultVertexShader,
 		FragmentShader: julia6Fragment,
-		GetPixel: func(uniforms Uniforms, pos mgl32.Vec2) mgl32.Vec3 {
-			iterations := 0
+		GetData: func(uniforms Uniforms, pos mgl32.Vec2) PixelData {
+			c := complex(uniforms.Sliders[0]-0.7265625, uniforms.Sliders[1])
 
-			z := complex(
-				float64(pos[0])*uniforms.Zoom-uniforms.Pos[0],
-				float64(pos[1])*uniforms.Zoom-uniforms.Pos[1],
-			)
-
-			for math.Abs(real(z))+math.Abs(imag(z)) <= 4 && iterations < int(uniforms.Iterations) {
-				z = z*z*z*z*z*z + complex(uniforms.Sliders[0]-0.7265625, uniforms.Sliders[1])
-				iterations++
-			}
-
-			if iterations == int(uniforms.Iterations) {
-				return uniforms.EmptyColour
-			} else {
-				return uniforms.ColourPallet[iterations%colours]
-			}
+			return escapeTime(uniforms, uniforms.Point(pos), 6, func(z complex128) complex128 {
+				return z*z*z*z*z*z + c
+			})
 		},
 	})
 }
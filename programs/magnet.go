@@ -0,0 +1,83 @@
+package programs
+
+import (
+	_ "embed"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+//go:embed shaders/magnet.frag
+var magnetFragment string
+
+// magnetBailout is far enough out that points escaping aren't confused with points still settling towards 1.
+var magnetBailout = Bailout{BailoutModulus, 100}
+
+// magnetType is a magnet formula, from the renormalisation of a model of magnetism.
+// Points either escape or converge to the fixed point at 1.
+type magnetType struct {
+	name   string
+	julia  string
+	define string // selects the formula in the shader
+	f      func(z, c complex128) complex128
+}
+
+var magnetTypes = []magnetType{
+	{
+		name:  "Magnet I",
+		julia: "Magnet I Julia",
+		f: func(z, c complex128) complex128 {
+			q := (z*z + c - 1) / (2*z + c - 2)
+			return q * q
+		},
+	},
+	{
+		name:   "Magnet II",
+		julia:  "Magnet II Julia",
+		define: "MAGNET_II",
+		f: func(z, c complex128) complex128 {
+			c12 := (c - 1) * (c - 2)
+			q := (z*z*z + 3*(c-1)*z + c12) / (3*z*z + 3*(c-2)*z + c12 + 1)
+			return q * q
+		},
+	},
+}
+
+func init() {
+	for _, m := range magnetTypes {
+		fragment := magnetFragment
+		if m.define != "" {
+			fragment = defineShader(fragment, m.define)
+		}
+
+		NewProgram(Program{
+			Name:           m.name,
+			Family:         m.name,
+			VertexShader:   defaultVertexShader,
+			FragmentShader: fragment,
+			Bailout:        magnetBailout,
+			GetData: func(uniforms Uniforms, pos mgl32.Vec2) PixelData {
+				c := uniforms.Point(pos)
+
+				return escapeOrConverge(uniforms, 0, 1, func(z complex128) complex128 {
+					return m.f(z, c)
+				})
+			},
+		})
+
+		NewProgram(Program{
+			Name:           m.julia,
+			Family:         m.name,
+			Julia:          true,
+			VertexShader:   defaultVertexShader,
+			FragmentShader: juliaShader(fragment),
+			Bailout:        magnetBailout,
+			GetData: func(uniforms Uniforms, pos mgl32.Vec2) PixelData {
+				c := complex(uniforms.JuliaC[0], uniforms.JuliaC[1])
+
+				return escapeOrConverge(uniforms, uniforms.Point(pos), 1, func(z complex128) complex128 {
+					return m.f(z, c)
+				})
+			},
+		})
+	}
+}
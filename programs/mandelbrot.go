@@ -2,7 +2,6 @@ package programs
 
 import (
 	_ "embed"
-	"math"
 
 	"github.com/go-gl/mathgl/mgl32"
 )
@@ -15,25 +14,12 @@ func init() {
 		Name:           "Mandelbrot",
 		VertexShader:   defaultVertexShader,
 		FragmentShader: mandelbrotFragment,
-		GetPixel: func(uniforms Uniforms, pos mgl32.Vec2) mgl32.Vec3 {
-			iterations := 0
+		GetData: func(uniforms Uniforms, pos mgl32.Vec2) PixelData {
+			c := uniforms.Point(pos)
 
-			z := complex(
-				float64(pos[0])*uniforms.Zoom-uniforms.Pos[0],
-				float64(pos[1])*uniforms.Zoom-uniforms.Pos[1],
-			)
-
-			z_const := z
-			for math.Abs(real(z))+math.Abs(imag(z)) <= 4 && iterations < int(uniforms.Iterations) {
-				z = z*z + z_const
-				iterations++
-			}
-
-			if iterations == int(uniforms.Iterations) {
-				return uniforms.EmptyColour
-			} else {
-				return uniforms.ColourPallet[iterations%colours]
-			}
+			return escapeTime(uniforms, c, 2, func(z complex128) complex128 {
+				return z*z + c
+			})
 		},
 	})
 }
@@ -0,0 +1,59 @@
+package programs
+
+import (
+	_ "embed"
+	"math/cmplx"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+//go:embed shaders/multibrot.frag
+var multibrotFragment string
+
+// multibrotSliders set the exponent, which can be any real or complex number.
+var multibrotSliders = []Slider{
+	{Name: "Exponent", Min: -8, Max: 16, Default: 2},
+	{Name: "Imaginary Exponent", Min: -4, Max: 4},
+}
+
+// multibrotStep raises z to the exponent set by the sliders through its polar form, then adds c.
+func multibrotStep(uniforms Uniforms, c complex128) func(complex128) complex128 {
+	exponent := complex(uniforms.Sliders[0], uniforms.Sliders[1])
+	return func(z complex128) complex128 {
+		if z == 0 {
+			return c
+		}
+		return cmplx.Exp(exponent*cmplx.Log(z)) + c
+	}
+}
+
+func init() {
+	fragment := doubleShader(multibrotFragment)
+
+	NewProgram(Program{
+		Name:           "Multibrot",
+		Family:         "Multibrot",
+		VertexShader:   defaultVertexShader,
+		FragmentShader: fragment,
+		Sliders:        multibrotSliders,
+		GetData: func(uniforms Uniforms, pos mgl32.Vec2) PixelData {
+			c := uniforms.Point(pos)
+
+			return escapeTime(uniforms, c, uniforms.Sliders[0], multibrotStep(uniforms, c))
+		},
+	})
+
+	NewProgram(Program{
+		Name:           "Multi-Julia",
+		Family:         "Multibrot",
+		Julia:          true,
+		VertexShader:   defaultVertexShader,
+		FragmentShader: juliaShader(fragment),
+		Sliders:        multibrotSliders,
+		GetData: func(uniforms Uniforms, pos mgl32.Vec2) PixelData {
+			c := complex(uniforms.JuliaC[0], uniforms.JuliaC[1])
+
+			return escapeTime(uniforms, uniforms.Point(pos), uniforms.Sliders[0], multibrotStep(uniforms, c))
+		},
+	})
+}
@@ -0,0 +1,138 @@
+package programs
+
+import (
+	_ "embed"
+	"math"
+	"math/cmplx"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+//go:embed shaders/newton.frag
+var newtonFragment string
+
+//go:embed shaders/nova.frag
+var novaFragment string
+
+const (
+	convergeEpsilon = 1e-6 // distance moved in a step that counts as converged
+	rootEpsilon     = 1e-3 // distance from a root that counts as converging to it
+	rootShade       = 0.95 // brightness kept for each iteration taken to converge to a root
+	minRootShade    = 0.2
+)
+
+// converge iterates step from z until it stops moving or reaches the iteration limit.
+//
+// Converging is the counterpart of escaping for these programs,
+// so converged points are marked Escaped and coloured the same way.
+func converge(uniforms Uniforms, z complex128, step func(complex128) complex128) PixelData {
+	var data PixelData
+	distance := math.Inf(1)
+	for !data.Escaped && data.Iterations < uniforms.Iterations {
+		next := step(z)
+		distance = cmplx.Abs(next - z)
+		data.Escaped = distance < convergeEpsilon
+		z = next
+		data.Iterations++
+	}
+
+	data.Z = z
+	data.Smooth = float64(data.Iterations)
+	if data.Escaped && distance > 0 {
+		// convergence is quadratic, so the last step is somewhere between epsilon and epsilon squared
+		data.Smooth -= math.Log2(math.Log(distance) / math.Log(convergeEpsilon))
+	}
+
+	return data
+}
+
+// roots returns the roots of the polynomial set in uniforms.
+func (u *Uniforms) roots() []complex128 {
+	roots := make([]complex128, min(max(u.RootCount, 1), MaxRoots))
+	for i := range roots {
+		roots[i] = complex(u.Roots[i][0], u.Roots[i][1])
+	}
+	return roots
+}
+
+// newtonStep is a step of Newton's method for the polynomial with the given roots,
+// where p(z)/p'(z) is the reciprocal of the sum of 1/(z - root).
+func newtonStep(z complex128, roots []complex128) complex128 {
+	var sum complex128
+	for _, root := range roots {
+		if z == root {
+			return z
+		}
+		sum += 1 / (z - root)
+	}
+	return z - 1/sum
+}
+
+// rootColour colours points by the root they converged to, spreading the roots evenly over the pallet,
+// and darkens the points that took longer.
+func rootColour(uniforms Uniforms, data PixelData) mgl32.Vec3 {
+	if !data.Escaped {
+		return uniforms.EmptyColour
+	}
+
+	roots := uniforms.roots()
+	for i, root := range roots {
+		if cmplx.Abs(data.Z-root) < rootEpsilon {
+			n := float32(len(uniforms.ColourPallet))
+			c := uniforms.ColourPallet.At(float32(i)*n/float32(len(roots))+float32(uniforms.PalletOffset), uniforms.PalletLinear)
+			return c.Mul(float32(max(math.Pow(rootShade, float64(data.Iterations)), minRootShade)))
+		}
+	}
+	return uniforms.Colour(data)
+}
+
+func init() {
+	newtonData := func(uniforms Uniforms, pos mgl32.Vec2) PixelData {
+		roots := uniforms.roots()
+
+		return converge(uniforms, uniforms.Point(pos), func(z complex128) complex128 {
+			return newtonStep(z, roots)
+		})
+	}
+	NewProgram(Program{
+		Name:           "Newton",
+		VertexShader:   defaultVertexShader,
+		FragmentShader: newtonFragment,
+		GetData:        newtonData,
+		GetPixel: func(uniforms Uniforms, pos mgl32.Vec2) mgl32.Vec3 {
+			return rootColour(uniforms, newtonData(uniforms, pos))
+		},
+	})
+
+	// the Mandelbrot form starts from the first root, which is a critical point of Newton's method
+	NewProgram(Program{
+		Name:           "Nova",
+		Family:         "Nova",
+		VertexShader:   defaultVertexShader,
+		FragmentShader: novaFragment,
+		GetData: func(uniforms Uniforms, pos mgl32.Vec2) PixelData {
+			roots := uniforms.roots()
+			c := uniforms.Point(pos)
+
+			return converge(uniforms, roots[0], func(z complex128) complex128 {
+				return newtonStep(z, roots) + c
+			})
+		},
+	})
+
+	NewProgram(Program{
+		Name:           "Nova Julia",
+		Family:         "Nova",
+		Julia:          true,
+		VertexShader:   defaultVertexShader,
+		FragmentShader: juliaShader(novaFragment),
+		GetData: func(uniforms Uniforms, pos mgl32.Vec2) PixelData {
+			roots := uniforms.roots()
+			c := complex(uniforms.JuliaC[0], uniforms.JuliaC[1])
+
+			return converge(uniforms, uniforms.Point(pos), func(z complex128) complex128 {
+				return newtonStep(z, roots) + c
+			})
+		},
+	})
+}
@@ -0,0 +1,563 @@
+package programs
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// PalletFormat is a pallet file format used by other fractal and graphics software.
+type PalletFormat int
+
+const (
+	PalletMap PalletFormat = iota
+	PalletUGR
+	PalletGGR
+	PalletGPL
+	PalletCSV
+	PalletJSON
+)
+
+var PalletFormatNames = []string{"Fractint Map", "Ultra Fractal Gradient", "GIMP Gradient", "GIMP Palette", "CSV", "JSON"}
+
+func (f PalletFormat) String() string { return PalletFormatNames[f] }
+
+// Extension returns the file extension for the format, including the dot.
+func (f PalletFormat) Extension() string {
+	return [...]string{".map", ".ugr", ".ggr", ".gpl", ".csv", ".json"}[f]
+}
+
+// PalletFormatOf returns the format of a pallet file from its extension.
+func PalletFormatOf(name string) (PalletFormat, error) {
+	ext := filepath.Ext(name)
+	for i := range PalletFormatNames {
+		if strings.EqualFold(ext, PalletFormat(i).Extension()) {
+			return PalletFormat(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown pallet file extension %q", ext)
+}
+
+// fractintMapColours is the number of colours in a Fractint map.
+const fractintMapColours = 256
+
+// ultraFractalIndices is the number of positions in an Ultra Fractal gradient.
+const ultraFractalIndices = 400
+
+// ReadPallet reads a pallet file as a gradient, so it can be edited and resampled to the pallet length.
+//
+// Lists of colours become evenly spaced stops that wrap around to the first colour,
+// so a list is read back unchanged into a pallet of the same length.
+func ReadPallet(r io.Reader, format PalletFormat) (Gradient, error) {
+	var list []mgl32.Vec3
+	var err error
+
+	switch format {
+	case PalletUGR:
+		return readUGR(r)
+	case PalletGGR:
+		return readGGR(r)
+	case PalletMap:
+		list, err = readMap(r)
+	case PalletGPL:
+		list, err = readGPL(r)
+	case PalletCSV:
+		list, err = readCSV(r)
+	case PalletJSON:
+		list, err = readJSON(r)
+	default:
+		return Gradient{}, fmt.Errorf("%v pallets can't be read", format)
+	}
+	if err != nil {
+		return Gradient{}, err
+	}
+	if len(list) == 0 {
+		return Gradient{}, fmt.Errorf("%v has no colours", format)
+	}
+
+	return listGradient(list), nil
+}
+
+// listGradient spaces colours evenly, wrapping back to the first.
+func listGradient(list []mgl32.Vec3) Gradient {
+	g := Gradient{Repeat: 1}
+	for i, c := range list {
+		g.Stops = append(g.Stops, GradientStop{
+			Pos:    float32(i) / float32(len(list)),
+			Colour: c,
+		})
+	}
+	g.Stops = append(g.Stops, GradientStop{Pos: 1, Colour: list[0]})
+	return g
+}
+
+// WritePallet writes pallet in format.
+// Fractint maps always have 256 colours, so the pallet is resampled to fit,
+// and Ultra Fractal gradients have at most 400.
+func WritePallet(w io.Writer, format PalletFormat, name string, pallet ColourPallet) error {
+	b := bufio.NewWriter(w)
+
+	switch format {
+	case PalletMap:
+		g := listGradient(pallet)
+		for i := 0; i < fractintMapColours; i++ {
+			r, gr, bl := rgb8(g.At(float32(i) / fractintMapColours))
+			fmt.Fprintf(b, "%3d %3d %3d\n", r, gr, bl)
+		}
+
+	case PalletUGR:
+		fmt.Fprintf(b, "%v {\ngradient:\n  title=%q smooth=yes\n", ugrName(name), name)
+		// longer pallets keep every few colours, as there are only 400 indices
+		n := min(len(pallet), ultraFractalIndices)
+		for i := 0; i < n; i++ {
+			r, g, bl := rgb8(pallet[i*len(pallet)/n])
+			index := int(math.Round(float64(i) * ultraFractalIndices / float64(n)))
+			fmt.Fprintf(b, "  index=%v color=%v\n", index, int(r)|int(g)<<8|int(bl)<<16)
+		}
+		fmt.Fprintf(b, "opacity:\n  smooth=no index=0 opacity=255\n}\n")
+
+	case PalletGGR:
+		fmt.Fprintf(b, "GIMP Gradient\nName: %v\n%v\n", name, len(pallet))
+		for i, c := range pallet {
+			next := pallet[(i+1)%len(pallet)]
+			left, right := float64(i)/float64(len(pallet)), float64(i+1)/float64(len(pallet))
+			fmt.Fprintf(b, "%.6f %.6f %.6f %.6f %.6f %.6f 1 %.6f %.6f %.6f 1 0 0\n",
+				left, (left+right)/2, right,
+				c[0], c[1], c[2],
+				next[0], next[1], next[2],
+			)
+		}
+
+	case PalletGPL:
+		fmt.Fprintf(b, "GIMP Palette\nName: %v\nColumns: 10\n#\n", name)
+		for i, c := range pallet {
+			r, g, bl := rgb8(c)
+			fmt.Fprintf(b, "%3d %3d %3d\tColour %v\n", r, g, bl, i)
+		}
+
+	case PalletCSV:
+		fmt.Fprintln(b, "red,green,blue")
+		for _, c := range pallet {
+			r, g, bl := rgb8(c)
+			fmt.Fprintf(b, "%v,%v,%v\n", r, g, bl)
+		}
+
+	case PalletJSON:
+		enc := json.NewEncoder(b)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(pallet); err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("%v pallets can't be written", format)
+	}
+
+	return b.Flush()
+}
+
+// rgb8 returns c as 8 bit channels.
+func rgb8(c mgl32.Vec3) (uint8, uint8, uint8) {
+	return uint8(limit(c[0])*255 + .5), uint8(limit(c[1])*255 + .5), uint8(limit(c[2])*255 + .5)
+}
+
+// ugrName makes name usable as an Ultra Fractal entry name, which can't contain spaces or braces.
+func ugrName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '{' || r == '}' {
+			return '-'
+		}
+		return r
+	}, name)
+	if name == "" {
+		return "glfractal"
+	}
+	return name
+}
+
+// parseChannels parses three numbers from fields,
+// either all from 0 to 1 or, if scale is 255, from 0 to 255.
+func parseChannels(fields []string, scale float64) (mgl32.Vec3, error) {
+	if len(fields) < 3 {
+		return mgl32.Vec3{}, fmt.Errorf("colour %q does not have 3 values", strings.Join(fields, " "))
+	}
+
+	var c mgl32.Vec3
+	for i := range c {
+		v, err := strconv.ParseFloat(strings.TrimSpace(fields[i]), 64)
+		if err != nil {
+			return c, err
+		}
+		c[i] = limit(float32(v / scale))
+	}
+	return c, nil
+}
+
+// readMap reads a Fractint map, three numbers from 0 to 255 on each line,
+// optionally followed by a comment.
+func readMap(r io.Reader) ([]mgl32.Vec3, error) {
+	var list []mgl32.Vec3
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], ";") {
+			continue
+		}
+
+		c, err := parseChannels(fields, 255)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %w", line, err)
+		}
+		list = append(list, c)
+	}
+	return list, scanner.Err()
+}
+
+// readGPL reads a GIMP palette, skipping its header and colour names.
+func readGPL(r io.Reader) ([]mgl32.Vec3, error) {
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() || strings.TrimSpace(scanner.Text()) != "GIMP Palette" {
+		return nil, fmt.Errorf("not a GIMP palette")
+	}
+
+	var list []mgl32.Vec3
+	for line := 2; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		// colours can be named anything, so only the known headers are skipped
+		if text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, "Name:") || strings.HasPrefix(text, "Columns:") {
+			continue
+		}
+
+		c, err := parseChannels(strings.Fields(text), 255)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %w", line, err)
+		}
+		list = append(list, c)
+	}
+	return list, scanner.Err()
+}
+
+// readCSV reads red, green and blue columns, either from 0 to 1 or from 0 to 255.
+// A header line is skipped.
+func readCSV(r io.Reader) ([]mgl32.Vec3, error) {
+	var rows [][]string
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		fields := strings.Split(text, ",")
+		if _, err := strconv.ParseFloat(strings.TrimSpace(fields[0]), 64); err != nil && len(rows) == 0 {
+			continue
+		}
+		rows = append(rows, fields)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// values over 1 mean the file uses 8 bit channels
+	scale := 1.
+	for _, row := range rows {
+		for _, field := range row[:min(len(row), 3)] {
+			if v, _ := strconv.ParseFloat(strings.TrimSpace(field), 64); v > 1 {
+				scale = 255
+			}
+		}
+	}
+
+	list := make([]mgl32.Vec3, 0, len(rows))
+	for i, row := range rows {
+		c, err := parseChannels(row, scale)
+		if err != nil {
+			return nil, fmt.Errorf("row %v: %w", i+1, err)
+		}
+		list = append(list, c)
+	}
+	return list, nil
+}
+
+// readJSON reads an array of colours, each either [r, g, b] from 0 to 1 or a "#rrggbb" string.
+func readJSON(r io.Reader) ([]mgl32.Vec3, error) {
+	var values []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&values); err != nil {
+		return nil, err
+	}
+
+	list := make([]mgl32.Vec3, 0, len(values))
+	for i, v := range values {
+		var c mgl32.Vec3
+		var hex string
+		if err := json.Unmarshal(v, &hex); err == nil {
+			var r, g, b uint8
+			if _, err := fmt.Sscanf(strings.TrimPrefix(hex, "#"), "%02x%02x%02x", &r, &g, &b); err != nil {
+				return nil, fmt.Errorf("colour %v: %q is not #rrggbb", i, hex)
+			}
+			c = mgl32.Vec3{float32(r) / 255, float32(g) / 255, float32(b) / 255}
+		} else if err := json.Unmarshal(v, &c); err != nil {
+			return nil, fmt.Errorf("colour %v: %w", i, err)
+		}
+		list = append(list, c)
+	}
+	return list, nil
+}
+
+// readUGR reads the first gradient in an Ultra Fractal gradient file.
+// Colours are stored as 0xBBGGRR at indices from 0 to 399, and wrap around.
+func readUGR(r io.Reader) (Gradient, error) {
+	g := Gradient{Repeat: 1}
+	section := ""
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if strings.HasSuffix(text, ":") {
+			section = strings.TrimSuffix(text, ":")
+			continue
+		}
+		if text == "}" && len(g.Stops) > 0 {
+			break
+		}
+		if section != "gradient" {
+			continue
+		}
+
+		index, colour := -1, -1
+		for _, field := range strings.Fields(text) {
+			key, value, _ := strings.Cut(field, "=")
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				continue
+			}
+			switch key {
+			case "index":
+				index = n
+			case "color":
+				colour = n
+			}
+		}
+		if index < 0 || colour < 0 {
+			continue
+		}
+
+		g.Stops = append(g.Stops, GradientStop{
+			Pos: float32(index) / ultraFractalIndices,
+			Colour: mgl32.Vec3{
+				float32(colour&0xff) / 255,
+				float32(colour>>8&0xff) / 255,
+				float32(colour>>16&0xff) / 255,
+			},
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return g, err
+	}
+	if len(g.Stops) == 0 {
+		return g, fmt.Errorf("no gradient found")
+	}
+
+	g.Sort()
+	g.Stops = append(g.Stops, GradientStop{Pos: 1, Colour: g.Stops[0].Colour})
+	return g, nil
+}
+
+// readGGR reads a GIMP gradient.
+// Each segment's ends and midpoint become stops, which is exact for linear RGB segments.
+// Other segments are sampled into more stops.
+func readGGR(r io.Reader) (Gradient, error) {
+	g := Gradient{Repeat: 1}
+
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() || strings.TrimSpace(scanner.Text()) != "GIMP Gradient" {
+		return g, fmt.Errorf("not a GIMP gradient")
+	}
+
+	segments, read := -1, 0
+	for line := 2; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "Name:") {
+			continue
+		}
+		if segments < 0 {
+			n, err := strconv.Atoi(text)
+			if err != nil {
+				return g, fmt.Errorf("line %v: %w", line, err)
+			}
+			if n < 1 {
+				return g, fmt.Errorf("line %v: gradient has %v segments", line, n)
+			}
+			segments = n
+			continue
+		}
+		if read == segments {
+			return g, fmt.Errorf("line %v: gradient has more than the %v segments it says", line, segments)
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) < 11 {
+			return g, fmt.Errorf("line %v: segment has %v values, not 11 or more", line, len(fields))
+		}
+		v := make([]float32, 11)
+		for i := range v {
+			f, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return g, fmt.Errorf("line %v: %w", line, err)
+			}
+			v[i] = float32(f)
+		}
+
+		seg := ggrSegment{
+			left:   v[0],
+			middle: v[1],
+			right:  v[2],
+			from:   mgl32.Vec3{v[3], v[4], v[5]},
+			to:     mgl32.Vec3{v[7], v[8], v[9]},
+		}
+		// older files leave out the blend and colour types, which are then linear RGB
+		for i, t := range []*int{&seg.blend, &seg.colour} {
+			if len(fields) <= 11+i {
+				break
+			}
+			var err error
+			if *t, err = strconv.Atoi(fields[11+i]); err != nil {
+				return g, fmt.Errorf("line %v: %w", line, err)
+			}
+		}
+		if seg.blend < 0 || seg.blend > ggrStep {
+			return g, fmt.Errorf("line %v: unknown blend type %v", line, seg.blend)
+		}
+		if seg.colour < 0 || seg.colour > ggrHSVClockwise {
+			return g, fmt.Errorf("line %v: unknown colour type %v", line, seg.colour)
+		}
+
+		g.Stops = append(g.Stops, seg.stops()...)
+		read++
+	}
+	if err := scanner.Err(); err != nil {
+		return g, err
+	}
+	if read == 0 {
+		return g, fmt.Errorf("gradient has no segments")
+	}
+	if read != segments {
+		return g, fmt.Errorf("gradient has %v segments, not the %v it says", read, segments)
+	}
+
+	g.Sort()
+	return g, nil
+}
+
+// Blend and colour types of GIMP gradient segments.
+const (
+	ggrLinear = iota
+	ggrCurved
+	ggrSine
+	ggrSphereIncreasing
+	ggrSphereDecreasing
+	ggrStep
+)
+
+const (
+	ggrRGB = iota
+	ggrHSVAnticlockwise
+	ggrHSVClockwise
+)
+
+// ggrSamples is the number of stops segments that aren't linear RGB are sampled into.
+const ggrSamples = 16
+
+// ggrSegment is a segment of a GIMP gradient, blending from one colour to another.
+type ggrSegment struct {
+	left, middle, right float32
+	from, to            mgl32.Vec3
+	blend, colour       int
+}
+
+// stops returns the stops that make the segment.
+func (s ggrSegment) stops() []GradientStop {
+	switch {
+	case s.blend == ggrStep:
+		return []GradientStop{
+			{Pos: s.left, Colour: s.from},
+			{Pos: s.middle, Colour: s.from},
+			{Pos: s.middle, Colour: s.to},
+			{Pos: s.right, Colour: s.to},
+		}
+	case s.blend == ggrLinear && s.colour == ggrRGB:
+		return []GradientStop{
+			{Pos: s.left, Colour: s.from},
+			{Pos: s.middle, Colour: s.from.Add(s.to).Mul(.5)},
+			{Pos: s.right, Colour: s.to},
+		}
+	}
+
+	stops := make([]GradientStop, ggrSamples+1)
+	for i := range stops {
+		t := float32(i) / ggrSamples
+		stops[i] = GradientStop{Pos: s.left + (s.right-s.left)*t, Colour: s.at(t)}
+	}
+	return stops
+}
+
+// at returns the colour t of the way along the segment, as GIMP blends it.
+func (s ggrSegment) at(t float32) mgl32.Vec3 {
+	width := s.right - s.left
+	middle := float32(.5)
+	if width > 0 {
+		middle = (s.middle - s.left) / width
+	}
+
+	// how far along the segment the midpoint puts t, before it's eased
+	linear := func() float64 {
+		const epsilon = 1e-10
+		if t <= middle {
+			if middle < epsilon {
+				return 0
+			}
+			return float64(.5 * t / middle)
+		}
+		if 1-middle < epsilon {
+			return 1
+		}
+		return float64(.5 + .5*(t-middle)/(1-middle))
+	}
+
+	var f float64
+	switch s.blend {
+	case ggrCurved:
+		f = math.Pow(float64(t), math.Log(.5)/math.Log(max(float64(middle), 1e-10)))
+	case ggrSine:
+		f = (math.Sin(-math.Pi/2+math.Pi*linear()) + 1) / 2
+	case ggrSphereIncreasing:
+		f = linear() - 1
+		f = math.Sqrt(1 - f*f)
+	case ggrSphereDecreasing:
+		f = linear()
+		f = 1 - math.Sqrt(1-f*f)
+	default:
+		f = linear()
+	}
+
+	if s.colour == ggrRGB {
+		return s.from.Add(s.to.Sub(s.from).Mul(float32(f)))
+	}
+
+	from, to := rgbToHSV(s.from), rgbToHSV(s.to)
+	c := from.Add(to.Sub(from).Mul(float32(f)))
+	// hue goes round the way the segment says, rather than the short way
+	switch {
+	case s.colour == ggrHSVAnticlockwise && to[0] <= from[0]:
+		c[0] = from[0] + (1-(from[0]-to[0]))*float32(f)
+	case s.colour == ggrHSVClockwise && to[0] >= from[0]:
+		c[0] = from[0] - (1-(to[0]-from[0]))*float32(f)
+	}
+	return hsvToRGB(c)
+}
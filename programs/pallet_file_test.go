@@ -0,0 +1,200 @@
+package programs
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// testPallet returns a pallet of n 8 bit colours, which every format can hold.
+func testPallet(n int) ColourPallet {
+	pallet := make(ColourPallet, n)
+	for i := range pallet {
+		pallet[i] = mgl32.Vec3{float32(i*37%256) / 255, float32(255-i*11%256) / 255, float32(i*101%256) / 255}
+	}
+	return pallet
+}
+
+// nearColour reports whether a and b are the same colour, give or take the precision files are written with.
+func nearColour(a, b mgl32.Vec3) bool {
+	for i := range a {
+		if math.Abs(float64(a[i]-b[i])) > 1e-5 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPalletRoundTrip(t *testing.T) {
+	tests := []struct {
+		format PalletFormat
+		length int
+	}{
+		{PalletMap, fractintMapColours},
+		{PalletUGR, 16},
+		{PalletGGR, 16},
+		{PalletGPL, 16},
+		{PalletCSV, 16},
+		{PalletJSON, 16},
+	}
+
+	for _, test := range tests {
+		t.Run(test.format.String(), func(t *testing.T) {
+			want := testPallet(test.length)
+
+			var b bytes.Buffer
+			if err := WritePallet(&b, test.format, "Test Pallet", want); err != nil {
+				t.Fatal(err)
+			}
+			g, err := ReadPallet(&b, test.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := g.Pallet(test.length)
+			for i := range want {
+				if !nearColour(got[i], want[i]) {
+					t.Fatalf("colour %v is %v, not %v", i, got[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestReadPallet(t *testing.T) {
+	red, blue := mgl32.Vec3{1, 0, 0}, mgl32.Vec3{0, 0, 1}
+
+	tests := []struct {
+		name   string
+		format PalletFormat
+		file   string
+		at     map[float32]mgl32.Vec3 // colours expected along the gradient
+		err    bool
+	}{
+		{
+			name:   "map with comments",
+			format: PalletMap,
+			file:   "255 0 0 ; red\n\n; blue next\n0 0 255\n",
+			at:     map[float32]mgl32.Vec3{0: red, .5: blue},
+		},
+		{name: "map with two channels", format: PalletMap, file: "255 0\n", err: true},
+		{name: "map with words", format: PalletMap, file: "red green blue\n", err: true},
+		{name: "empty map", format: PalletMap, file: "; nothing\n", err: true},
+
+		{
+			name:   "palette with names",
+			format: PalletGPL,
+			file:   "GIMP Palette\nName: Test\nColumns: 4\n#\n255 0 0\tRed: warm\n0 0 255\tBlue\n",
+			at:     map[float32]mgl32.Vec3{0: red, .5: blue},
+		},
+		{name: "palette without a header", format: PalletGPL, file: "255 0 0\n", err: true},
+		{name: "palette with a bad colour", format: PalletGPL, file: "GIMP Palette\n255 x 0\n", err: true},
+		{name: "palette without colours", format: PalletGPL, file: "GIMP Palette\nName: Test\n", err: true},
+
+		{
+			name:   "linear gradient",
+			format: PalletGGR,
+			file:   "GIMP Gradient\nName: Test\n1\n0 0.5 1 1 0 0 1 0 0 1 1 0 0\n",
+			at:     map[float32]mgl32.Vec3{0: red, .5: {.5, 0, .5}, 1: blue},
+		},
+		{
+			name:   "gradient without blend types",
+			format: PalletGGR,
+			file:   "GIMP Gradient\n1\n0 0.5 1 1 0 0 1 0 0 1 1\n",
+			at:     map[float32]mgl32.Vec3{.5: {.5, 0, .5}},
+		},
+		{
+			name:   "anticlockwise HSV gradient",
+			format: PalletGGR,
+			file:   "GIMP Gradient\n1\n0 0.5 1 1 0 0 1 0 0 1 1 0 1\n",
+			at:     map[float32]mgl32.Vec3{.5: {0, 1, 0}},
+		},
+		{
+			name:   "clockwise HSV gradient",
+			format: PalletGGR,
+			file:   "GIMP Gradient\n1\n0 0.5 1 1 0 0 1 0 0 1 1 0 2\n",
+			at:     map[float32]mgl32.Vec3{.5: {1, 0, 1}},
+		},
+		{
+			name:   "step gradient",
+			format: PalletGGR,
+			file:   "GIMP Gradient\n1\n0 0.25 1 1 0 0 1 0 0 1 1 5 0\n",
+			at:     map[float32]mgl32.Vec3{.2: red, .3: blue},
+		},
+		{name: "gradient without a header", format: PalletGGR, file: "1\n0 0.5 1 1 0 0 1 0 0 1 1\n", err: true},
+		{name: "gradient with too few segments", format: PalletGGR, file: "GIMP Gradient\n2\n0 0.5 1 1 0 0 1 0 0 1 1\n", err: true},
+		{name: "gradient with too many segments", format: PalletGGR, file: "GIMP Gradient\n1\n0 0.5 1 1 0 0 1 0 0 1 1\n0 0.5 1 1 0 0 1 0 0 1 1\n", err: true},
+		{name: "gradient without segments", format: PalletGGR, file: "GIMP Gradient\n0\n", err: true},
+		{name: "gradient with a short segment", format: PalletGGR, file: "GIMP Gradient\n1\n0 0.5 1 1 0 0\n", err: true},
+		{name: "gradient with an unknown blend", format: PalletGGR, file: "GIMP Gradient\n1\n0 0.5 1 1 0 0 1 0 0 1 1 9 0\n", err: true},
+		{name: "gradient with an unknown colour type", format: PalletGGR, file: "GIMP Gradient\n1\n0 0.5 1 1 0 0 1 0 0 1 1 0 9\n", err: true},
+
+		{
+			name:   "ultra fractal",
+			format: PalletUGR,
+			file:   "test {\ngradient:\n  title=\"test\" smooth=yes\n  index=0 color=255\n  index=200 color=16711680\nopacity:\n  smooth=no index=0 opacity=255\n}\n",
+			at:     map[float32]mgl32.Vec3{0: red, .5: blue},
+		},
+		{name: "ultra fractal without colours", format: PalletUGR, file: "test {\ngradient:\n}\n", err: true},
+
+		{
+			name:   "csv of 8 bit channels",
+			format: PalletCSV,
+			file:   "red,green,blue\n255,0,0\n0,0,255\n",
+			at:     map[float32]mgl32.Vec3{0: red, .5: blue},
+		},
+		{
+			name:   "csv of fractions",
+			format: PalletCSV,
+			file:   "1,0,0\n0,0,1\n",
+			at:     map[float32]mgl32.Vec3{0: red, .5: blue},
+		},
+		{name: "csv with two columns", format: PalletCSV, file: "1,0\n", err: true},
+
+		{
+			name:   "json",
+			format: PalletJSON,
+			file:   `["#ff0000", [0, 0, 1]]`,
+			at:     map[float32]mgl32.Vec3{0: red, .5: blue},
+		},
+		{name: "json with a bad colour", format: PalletJSON, file: `["red"]`, err: true},
+		{name: "json that isn't a list", format: PalletJSON, file: `{}`, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g, err := ReadPallet(strings.NewReader(test.file), test.format)
+			if test.err {
+				if err == nil {
+					t.Fatal("no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for pos, want := range test.at {
+				if got := g.At(pos); !nearColour(got, want) {
+					t.Errorf("colour at %v is %v, not %v", pos, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPalletFormatOf(t *testing.T) {
+	for i := range PalletFormatNames {
+		format := PalletFormat(i)
+		got, err := PalletFormatOf("pallet" + strings.ToUpper(format.Extension()))
+		if err != nil || got != format {
+			t.Errorf("format of %v is %v, %v", format.Extension(), got, err)
+		}
+	}
+	if _, err := PalletFormatOf("pallet.png"); err == nil {
+		t.Error("no error for .png")
+	}
+}
@@ -0,0 +1,56 @@
+package programs
+
+import (
+	_ "embed"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+//go:embed shaders/phoenix.frag
+var phoenixFragment string
+
+// phoenixSliders set p, the weight of the z before the last in each step.
+var phoenixSliders = []Slider{
+	{Name: "P", Min: -2, Max: 2, Default: -.5},
+	{Name: "Imaginary P", Min: -2, Max: 2},
+}
+
+// phoenixStep returns z² + c + p·z₋₁, keeping the z before the last between steps.
+func phoenixStep(uniforms Uniforms, c complex128) func(complex128) complex128 {
+	p := complex(uniforms.Sliders[0], uniforms.Sliders[1])
+	var previous complex128
+	return func(z complex128) complex128 {
+		next := z*z + c + p*previous
+		previous = z
+		return next
+	}
+}
+
+func init() {
+	NewProgram(Program{
+		Name:           "Phoenix",
+		Family:         "Phoenix",
+		VertexShader:   defaultVertexShader,
+		FragmentShader: phoenixFragment,
+		Sliders:        phoenixSliders,
+		GetData: func(uniforms Uniforms, pos mgl32.Vec2) PixelData {
+			c := uniforms.Point(pos)
+
+			return escapeTime(uniforms, c, 2, phoenixStep(uniforms, c))
+		},
+	})
+
+	NewProgram(Program{
+		Name:           "Phoenix Julia",
+		Family:         "Phoenix",
+		Julia:          true,
+		VertexShader:   defaultVertexShader,
+		FragmentShader: juliaShader(phoenixFragment),
+		Sliders:        phoenixSliders,
+		GetData: func(uniforms Uniforms, pos mgl32.Vec2) PixelData {
+			c := complex(uniforms.JuliaC[0], uniforms.JuliaC[1])
+
+			return escapeTime(uniforms, uniforms.Point(pos), 2, phoenixStep(uniforms, c))
+		},
+	})
+}
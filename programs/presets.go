@@ -0,0 +1,154 @@
+package programs
+
+import (
+	"strconv"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// PalletPreset is a built-in gradient.
+type PalletPreset struct {
+	Name     string
+	Gradient Gradient
+}
+
+// PalletPresets are the built-in gradients;
+// perceptually uniform maps first, then the classic defaults of other fractal software,
+// then ones that stay distinguishable with colour blindness.
+var PalletPresets = []PalletPreset{
+	{"Viridis", stopGradient(
+		"#440154", "#482878", "#3e4989", "#31688e", "#26828e", "#1f9e89", "#35b779", "#6ece58", "#fde725",
+	)},
+	{"Magma", stopGradient(
+		"#000004", "#1c1044", "#4f127b", "#812581", "#b5367a", "#e55064", "#fb8761", "#fec287", "#fcfdbf",
+	)},
+	{"Inferno", stopGradient(
+		"#000004", "#1f0c48", "#550f6d", "#88226a", "#ba3655", "#e35933", "#f98c0a", "#f9c932", "#fcffa4",
+	)},
+	{"Plasma", stopGradient(
+		"#0d0887", "#46039f", "#7201a8", "#9c179e", "#bd3786", "#d8576b", "#ed7953", "#fb9f3a", "#fdca26", "#f0f921",
+	)},
+	{"Turbo", stopGradient(
+		"#30123b", "#4145ab", "#4675ed", "#39a2fc", "#1bcfd4", "#24eca6", "#61fc6c", "#a4fc3b",
+		"#d1e834", "#f3c63a", "#fe9b2d", "#f36315", "#d93806", "#b11901", "#7a0402",
+	)},
+	{"Greyscale", stopGradient("#000000", "#ffffff")},
+
+	{"Fractint Default", listGradient(fractintDefault())},
+	{"Ultra Fractal Default", Gradient{
+		Stops: []GradientStop{
+			{Pos: 0, Colour: hexColour("#000764")},
+			{Pos: .16, Colour: hexColour("#206bcb")},
+			{Pos: .42, Colour: hexColour("#edffff")},
+			{Pos: .6425, Colour: hexColour("#ffaa00")},
+			{Pos: .8575, Colour: hexColour("#000200")},
+			{Pos: 1, Colour: hexColour("#000764")},
+		},
+		Repeat: 1,
+	}},
+
+	{"Cividis", stopGradient(
+		"#00224e", "#123570", "#3b496c", "#575d6d", "#707173", "#8a8678", "#a59c74", "#c3b369", "#e1cc55", "#fee838",
+	)},
+	{"Okabe-Ito", listGradient([]mgl32.Vec3{
+		hexColour("#000000"), hexColour("#e69f00"), hexColour("#56b4e9"), hexColour("#009e73"),
+		hexColour("#f0e442"), hexColour("#0072b2"), hexColour("#d55e00"), hexColour("#cc79a7"),
+	})},
+	{"Tol Sunset", stopGradient(
+		"#364b9a", "#4a7bb7", "#6ea6cd", "#98cae1", "#c2e4ef", "#eaeccc", "#feda8b", "#fdb366", "#f67e4b", "#dd3d2d", "#a50026",
+	)},
+}
+
+// PalletPresetByName returns the built-in gradient with the given name.
+func PalletPresetByName(name string) (Gradient, bool) {
+	for _, p := range PalletPresets {
+		if p.Name == name {
+			return p.Clone(), true
+		}
+	}
+	return Gradient{}, false
+}
+
+// Clone returns the preset's gradient with its own stops, so editing it leaves the preset alone.
+func (p PalletPreset) Clone() Gradient {
+	g := p.Gradient
+	g.Stops = append([]GradientStop(nil), p.Gradient.Stops...)
+	return g
+}
+
+// hexColour parses a "#rrggbb" colour, panicking if it is malformed as presets are fixed.
+func hexColour(s string) mgl32.Vec3 {
+	if len(s) != 7 || s[0] != '#' {
+		panic("bad preset colour " + s)
+	}
+	n, err := strconv.ParseUint(s[1:], 16, 24)
+	if err != nil {
+		panic("bad preset colour " + s)
+	}
+	return mgl32.Vec3{float32(n>>16) / 255, float32(n>>8&0xff) / 255, float32(n&0xff) / 255}
+}
+
+// stopGradient spaces colours evenly from the start to the end of a gradient.
+func stopGradient(colours ...string) Gradient {
+	g := Gradient{Repeat: 1}
+	for i, c := range colours {
+		g.Stops = append(g.Stops, GradientStop{
+			Pos:    float32(i) / float32(max(len(colours)-1, 1)),
+			Colour: hexColour(c),
+		})
+	}
+	return g
+}
+
+// fractintDefault returns Fractint's default pallet, which is the VGA default;
+// the 16 EGA colours, 16 greys, then nine rings of 24 hues at three brightnesses and saturations.
+func fractintDefault() []mgl32.Vec3 {
+	var vga [][3]int
+	vga = append(vga,
+		[3]int{0, 0, 0}, [3]int{0, 0, 42}, [3]int{0, 42, 0}, [3]int{0, 42, 42},
+		[3]int{42, 0, 0}, [3]int{42, 0, 42}, [3]int{42, 21, 0}, [3]int{42, 42, 42},
+		[3]int{21, 21, 21}, [3]int{21, 21, 63}, [3]int{21, 63, 21}, [3]int{21, 63, 63},
+		[3]int{63, 21, 21}, [3]int{63, 21, 63}, [3]int{63, 63, 21}, [3]int{63, 63, 63},
+	)
+	for _, grey := range []int{0, 5, 8, 11, 14, 17, 20, 24, 28, 32, 36, 40, 45, 50, 56, 63} {
+		vga = append(vga, [3]int{grey, grey, grey})
+	}
+
+	// each ring goes blue, magenta, red, yellow, green, cyan,
+	// moving one channel at a time through five levels
+	rings := [][5]int{
+		{0, 16, 31, 47, 63}, {31, 39, 47, 55, 63}, {45, 49, 54, 58, 63},
+		{0, 7, 14, 21, 28}, {14, 17, 21, 24, 28}, {20, 22, 24, 26, 28},
+		{0, 4, 8, 12, 16}, {8, 10, 12, 14, 16}, {11, 12, 13, 15, 16},
+	}
+	for _, l := range rings {
+		lo, hi := l[0], l[4]
+		for i := 0; i < 4; i++ {
+			vga = append(vga, [3]int{l[i], lo, hi})
+		}
+		for i := 0; i < 4; i++ {
+			vga = append(vga, [3]int{hi, lo, l[4-i]})
+		}
+		for i := 0; i < 4; i++ {
+			vga = append(vga, [3]int{hi, l[i], lo})
+		}
+		for i := 0; i < 4; i++ {
+			vga = append(vga, [3]int{l[4-i], hi, lo})
+		}
+		for i := 0; i < 4; i++ {
+			vga = append(vga, [3]int{lo, hi, l[i]})
+		}
+		for i := 0; i < 4; i++ {
+			vga = append(vga, [3]int{lo, l[4-i], hi})
+		}
+	}
+	for len(vga) < fractintMapColours {
+		vga = append(vga, [3]int{})
+	}
+
+	colours := make([]mgl32.Vec3, len(vga))
+	for i, c := range vga {
+		colours[i] = mgl32.Vec3{float32(c[0]) / 63, float32(c[1]) / 63, float32(c[2]) / 63}
+	}
+	return colours
+}
@@ -3,6 +3,7 @@ package programs
 import (
 	_ "embed"
 	"errors"
+	"fmt"
 	"image"
 
 	"github.com/go-gl/mathgl/mgl32"
@@ -21,12 +22,32 @@ func GetProgram(i int) Program {
 	return programs[i]
 }
 
+// ProgramByName returns the registered program with the given name,
+// or builds the hybrid it names.
+func ProgramByName(name string) (Program, bool) {
+	for _, p := range programs {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	if h, err := ParseHybrid(name); err == nil {
+		if p, err := h.Program(); err == nil {
+			return p, true
+		}
+	}
+	return Program{}, false
+}
+
 func SetProgram(i int, p Program) error {
 	programs[i] = p
 	return nil
 }
 
 func NewProgram(p Program) error {
+	if p.GetPixel == nil && p.GetData != nil {
+		p.GetPixel = colourData(p.GetData)
+	}
+
 	programs = append(programs, p)
 	return nil
 }
@@ -35,14 +56,86 @@ var programs []Program
 
 type PixelFunc func(uniforms Uniforms, pos mgl32.Vec2) mgl32.Vec3
 
+// Program is a fractal that can be rendered by OpenGL,
+// and optionally on the CPU.
+//
+// GetData exposes the raw iteration results for programs that have them.
+// If GetPixel is nil, NewProgram colours GetData's results.
+//
+// Programs in the same Family are one formula in parameter space and in Julia space,
+// where Julia is set and c comes from the JuliaC uniform.
+//
+// Bailout is the escape test the program is designed for, if it isn't the default,
+// and Sliders describes the sliders the program uses, in order.
+// 3D programs set the Camera3D they start with, and ignore Zoom and Pos.
+// Density programs count orbits into a Histogram instead of colouring pixels,
+// and their shader shows a histogram accumulated on the CPU.
 type Program struct {
 	Name           string
 	VertexShader   string
 	FragmentShader string
 	GetPixel       PixelFunc
+	GetData        DataFunc
+	Family         string
+	Julia          bool
+	Bailout        Bailout
+	Sliders        []Slider
+	Camera3D       Camera3D
+	Density        *Density
+}
+
+// Slider describes what one of the sliders means to a program.
+type Slider struct {
+	Name     string
+	Min, Max float64
+	Default  float64
+}
+
+// Slider returns the description of slider i,
+// or a generic offset for sliders the program doesn't describe.
+func (p *Program) Slider(i int) Slider {
+	if i < len(p.Sliders) {
+		return p.Sliders[i]
+	}
+	return Slider{
+		Name: fmt.Sprintf("Slider %v", i),
+		Min:  -2,
+		Max:  2,
+	}
+}
+
+// DefaultSliders returns the default value of each slider.
+func (p *Program) DefaultSliders() [sliders]float64 {
+	var values [sliders]float64
+	for i := range values {
+		values[i] = p.Slider(i).Default
+	}
+	return values
+}
+
+// Counterpart returns the program in the same family in the other space;
+// the Julia form of a parameter space program, or the parameter space form of a Julia program.
+func (p *Program) Counterpart() (Program, bool) {
+	if p.Family == "" {
+		return Program{}, false
+	}
+	for _, other := range programs {
+		if other.Family == p.Family && other.Julia != p.Julia {
+			return other, true
+		}
+	}
+	if h, err := ParseHybrid(p.Name); err == nil {
+		h.Julia = !h.Julia
+		other, err := h.Program()
+		return other, err == nil
+	}
+	return Program{}, false
 }
 
 func (p *Program) GetImage(uniforms Uniforms, width, height int) (Image, error) {
+	if p.Density != nil {
+		return nil, ErrDensityImage
+	}
 	if p.GetPixel == nil {
 		return nil, ErrNoCPUImplementation
 	}
@@ -59,24 +152,49 @@ func (p *Program) GetImage(uniforms Uniforms, width, height int) (Image, error)
 			height,
 		),
 		pixelFunc: p.GetPixel,
+		dataFunc:  p.GetData,
 	}, nil
 }
 
+// GetDataImage is like GetImage, but for the raw iteration results.
+func (p *Program) GetDataImage(uniforms Uniforms, width, height int) (DataImage, error) {
+	if p.GetData == nil {
+		return nil, ErrNoCPUImplementation
+	}
+
+	img, err := p.GetImage(uniforms, width, height)
+	if err != nil {
+		return nil, err
+	}
+
+	return img.(*programImage), nil
+}
+
 type Image interface {
 	GetPixel(mgl32.Vec2) mgl32.Vec3
 	Bounds() image.Rectangle
 }
 
+type DataImage interface {
+	GetData(mgl32.Vec2) PixelData
+	Bounds() image.Rectangle
+}
+
 type programImage struct {
 	uniforms  Uniforms
 	bounds    image.Rectangle
 	pixelFunc PixelFunc
+	dataFunc  DataFunc
 }
 
 func (i *programImage) GetPixel(pos mgl32.Vec2) mgl32.Vec3 {
 	return i.pixelFunc(i.uniforms, pos)
 }
 
+func (i *programImage) GetData(pos mgl32.Vec2) PixelData {
+	return i.dataFunc(i.uniforms, pos)
+}
+
 func (i *programImage) Bounds() image.Rectangle {
 	return i.bounds
 }
@@ -0,0 +1,319 @@
+package programs
+
+import (
+	_ "embed"
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+//go:embed shaders/raymarch.frag
+var raymarchFragment string
+
+// Raymarching walks each pixel's ray forward by the distance estimate of the fractal,
+// which is never more than the distance to its surface, until it's close enough to count as a hit.
+const (
+	cameraDistance = 2.5  // starting distance of the camera from the origin, in bounding radii
+	maxMarchSteps  = 256  // steps along a ray before giving up on it
+	hitDetail      = 1e-3 // distance estimate that counts as a hit, relative to the ray length
+	normalEpsilon  = 1e-4
+
+	// Fractal details go below the hit distance long before the iteration limit most escape time fractals need,
+	// so distance estimates take no more than this many.
+	maxEstimateIterations = 32
+
+	shadowSteps    = 64
+	shadowSoftness = 8 // sharpness of the penumbra
+	occlusionSteps = 5
+	occlusionStep  = .02 // spacing of the samples taken along the normal for ambient occlusion
+	ambientLight   = .2
+	diffuseLight   = .8
+	specularLight  = .4
+	shininess      = 32
+	fogDensity     = .2 // per bounding radius
+)
+
+// distanceEstimator is a 3D fractal that can be raymarched.
+type distanceEstimator struct {
+	name    string
+	define  string // selects the estimate in the shader
+	julia   bool
+	radius  float64 // of a sphere around the fractal with its default sliders, to frame the camera, bound rays and fog by
+	sliders []Slider
+	// estimate returns a lower bound of the distance from p to the fractal,
+	// and the iterations it took to decide it.
+	estimate func(uniforms *Uniforms, p mgl64.Vec3) (float64, uint32)
+}
+
+var distanceEstimators = []distanceEstimator{
+	{
+		name:   "Mandelbulb",
+		define: "MANDELBULB",
+		radius: 1.2,
+		sliders: []Slider{
+			{Name: "Power", Min: 2, Max: 16, Default: 8},
+		},
+		estimate: mandelbulbEstimate,
+	},
+	{
+		name:   "Mandelbox",
+		define: "MANDELBOX",
+		radius: 3.5,
+		sliders: []Slider{
+			{Name: "Scale", Min: -3, Max: 3, Default: -1.5},
+			{Name: "Minimum Radius", Min: 0, Max: 1, Default: .5},
+		},
+		estimate: mandelboxEstimate,
+	},
+	{
+		name:   "Quaternion Julia",
+		define: "QUATERNION_JULIA",
+		julia:  true,
+		radius: 2,
+		sliders: []Slider{
+			{Name: "c (j)", Min: -2, Max: 2},
+			{Name: "c (k)", Min: -2, Max: 2},
+			{Name: "Slice", Min: -2, Max: 2},
+		},
+		estimate: quaternionJuliaEstimate,
+	},
+}
+
+func estimateIterations(uniforms *Uniforms) uint32 {
+	return min(uniforms.Iterations, maxEstimateIterations)
+}
+
+// mandelbulbEstimate raises p to the power on slider 0 in spherical coordinates.
+func mandelbulbEstimate(uniforms *Uniforms, p mgl64.Vec3) (float64, uint32) {
+	power := uniforms.Sliders[0]
+	iterations := estimateIterations(uniforms)
+
+	z := p
+	dr, r := 1., 0.
+	i := uint32(0)
+	for ; i < iterations; i++ {
+		r = z.Len()
+		if r > 2 {
+			break
+		}
+
+		theta := math.Acos(z[2]/r) * power
+		phi := math.Atan2(z[1], z[0]) * power
+		dr = math.Pow(r, power-1)*power*dr + 1
+
+		zr := math.Pow(r, power)
+		z = mgl64.Vec3{
+			math.Sin(theta) * math.Cos(phi),
+			math.Sin(theta) * math.Sin(phi),
+			math.Cos(theta),
+		}.Mul(zr).Add(p)
+	}
+	return .5 * math.Log(r) * r / dr, i
+}
+
+// mandelboxEstimate folds p into a box and sphere, then scales it by slider 0.
+// Slider 1 is the radius inside which the sphere fold is linear.
+func mandelboxEstimate(uniforms *Uniforms, p mgl64.Vec3) (float64, uint32) {
+	scale := uniforms.Sliders[0]
+	minRadius2 := uniforms.Sliders[1] * uniforms.Sliders[1]
+	iterations := estimateIterations(uniforms)
+
+	z := p
+	dr := 1.
+	i := uint32(0)
+	for ; i < iterations; i++ {
+		for j := range z {
+			z[j] = mgl64.Clamp(z[j], -1, 1)*2 - z[j]
+		}
+
+		r2 := z.Dot(z)
+		if r2 < minRadius2 {
+			z = z.Mul(1 / minRadius2)
+			dr /= minRadius2
+		} else if r2 < 1 {
+			z = z.Mul(1 / r2)
+			dr /= r2
+		}
+
+		z = z.Mul(scale).Add(p)
+		dr = dr*math.Abs(scale) + 1
+		if z.Dot(z) > 1e4 {
+			break
+		}
+	}
+	return z.Len() / math.Abs(dr), i
+}
+
+// quaternionJuliaEstimate iterates q² + c in the quaternions,
+// with c made of the Julia c and sliders 0 and 1, in the 3D slice through slider 2.
+func quaternionJuliaEstimate(uniforms *Uniforms, p mgl64.Vec3) (float64, uint32) {
+	c := mgl64.Quat{W: uniforms.JuliaC[0], V: mgl64.Vec3{uniforms.JuliaC[1], uniforms.Sliders[0], uniforms.Sliders[1]}}
+	iterations := estimateIterations(uniforms)
+
+	q := mgl64.Quat{W: p[0], V: mgl64.Vec3{p[1], p[2], uniforms.Sliders[2]}}
+	dq := mgl64.QuatIdent()
+	i := uint32(0)
+	for ; i < iterations; i++ {
+		dq = q.Mul(dq).Scale(2)
+		q = q.Mul(q).Add(c)
+		if q.Dot(q) > 256 {
+			break
+		}
+	}
+	if i == iterations {
+		// near the surface the estimate is too small to march past, so points that didn't escape are inside
+		return 0, i
+	}
+	r := q.Len()
+	return .5 * r * math.Log(r) / dq.Len(), i
+}
+
+// raymarch is the CPU implementation of the raymarching shader.
+type raymarch struct {
+	estimator distanceEstimator
+}
+
+func (r raymarch) distance(uniforms *Uniforms, p mgl64.Vec3) float64 {
+	d, _ := r.estimator.estimate(uniforms, p)
+	return d
+}
+
+// maxLength is the length of a ray from eye that has gone past the bounding sphere.
+func (r raymarch) maxLength(eye mgl64.Vec3) float64 {
+	return eye.Len() + 2*r.estimator.radius
+}
+
+// march follows the ray from eye along dir, returning the length it went and whether it hit the fractal.
+func (r raymarch) march(uniforms *Uniforms, eye, dir mgl64.Vec3) (float64, bool) {
+	maxLength := r.maxLength(eye)
+	t := 0.
+	for range maxMarchSteps {
+		d := r.distance(uniforms, eye.Add(dir.Mul(t)))
+		if d < hitDetail*t {
+			return t, true
+		}
+		t += d
+		if t > maxLength {
+			break
+		}
+	}
+	return t, false
+}
+
+// normal is the gradient of the distance estimate, sampled at the corners of a tetrahedron.
+func (r raymarch) normal(uniforms *Uniforms, p mgl64.Vec3) mgl64.Vec3 {
+	var n mgl64.Vec3
+	for _, k := range []mgl64.Vec3{{1, -1, -1}, {-1, -1, 1}, {-1, 1, -1}, {1, 1, 1}} {
+		n = n.Add(k.Mul(r.distance(uniforms, p.Add(k.Mul(normalEpsilon)))))
+	}
+	return n.Normalize()
+}
+
+// shadow is the light reaching p from the direction l, darkened by the fractal passing close to the ray.
+func (r raymarch) shadow(uniforms *Uniforms, p, l mgl64.Vec3) float64 {
+	s := 1.
+	t := 10 * normalEpsilon
+	for range shadowSteps {
+		d := r.distance(uniforms, p.Add(l.Mul(t)))
+		if d < normalEpsilon {
+			return 0
+		}
+		s = min(s, shadowSoftness*d/t)
+		t += d
+		if t > 2*r.estimator.radius {
+			break
+		}
+	}
+	return mgl64.Clamp(s, 0, 1)
+}
+
+// occlusion is the ambient light reaching p, less where the fractal is closer than the distance along n.
+func (r raymarch) occlusion(uniforms *Uniforms, p, n mgl64.Vec3) float64 {
+	occluded := 0.
+	weight := 1.
+	for i := 1; i <= occlusionSteps; i++ {
+		h := occlusionStep * float64(i)
+		occluded += (h - r.distance(uniforms, p.Add(n.Mul(h)))) * weight
+		weight *= .7
+	}
+	return mgl64.Clamp(1-3*occluded, 0, 1)
+}
+
+// ray returns the camera position and direction of the ray through pos on the screen.
+func (r raymarch) ray(uniforms *Uniforms, pos mgl32.Vec2) (eye, dir mgl64.Vec3) {
+	camera := uniforms.Camera3D()
+	forward, right, up := camera.Axes()
+
+	// the screen's longer side spans -1 to 1, so this puts its edges at the field of view
+	focalLength := 1 / math.Tan(mgl64.DegToRad(camera.FieldOfView)/2)
+	dir = forward.Mul(focalLength).
+		Add(right.Mul(float64(pos[0]))).
+		Add(up.Mul(float64(pos[1]))).
+		Normalize()
+	return camera.Position, dir
+}
+
+func (r raymarch) GetData(uniforms Uniforms, pos mgl32.Vec2) PixelData {
+	eye, dir := r.ray(&uniforms, pos)
+	t, hit := r.march(&uniforms, eye, dir)
+	if !hit {
+		return PixelData{}
+	}
+
+	_, iterations := r.estimator.estimate(&uniforms, eye.Add(dir.Mul(t)))
+	return PixelData{
+		Iterations: iterations,
+		Smooth:     float64(iterations),
+		Escaped:    true,
+	}
+}
+
+// GetPixel lights the surface from above the camera, fading it into the empty colour with distance.
+func (r raymarch) GetPixel(uniforms Uniforms, pos mgl32.Vec2) mgl32.Vec3 {
+	eye, dir := r.ray(&uniforms, pos)
+	t, hit := r.march(&uniforms, eye, dir)
+	if !hit {
+		return uniforms.EmptyColour
+	}
+
+	p := eye.Add(dir.Mul(t))
+	_, iterations := r.estimator.estimate(&uniforms, p)
+	n := r.normal(&uniforms, p)
+
+	forward, right, up := uniforms.Camera3D().Axes()
+	light := right.Mul(-.4).Add(up.Mul(.8)).Sub(forward.Mul(.5)).Normalize()
+
+	shadow := r.shadow(&uniforms, p.Add(n.Mul(2*normalEpsilon)), light)
+	diffuse := max(n.Dot(light), 0) * shadow
+	half := light.Sub(dir).Normalize()
+	specular := math.Pow(max(n.Dot(half), 0), shininess) * shadow
+	ambient := r.occlusion(&uniforms, p, n)
+
+	base := uniforms.Colour(PixelData{Iterations: iterations, Escaped: true})
+	colour := base.Mul(float32(ambientLight*ambient + diffuseLight*diffuse)).
+		Add(mgl32.Vec3{1, 1, 1}.Mul(float32(specularLight * specular)))
+
+	fog := float32(math.Exp(-fogDensity * t / r.estimator.radius))
+	return uniforms.EmptyColour.Mul(1 - fog).Add(colour.Mul(fog))
+}
+
+func init() {
+	for _, e := range distanceEstimators {
+		r := raymarch{estimator: e}
+
+		NewProgram(Program{
+			Name:           e.name,
+			Julia:          e.julia,
+			VertexShader:   defaultVertexShader,
+			FragmentShader: defineShader(raymarchFragment, e.define),
+			Sliders:        e.sliders,
+			GetPixel:       r.GetPixel,
+			GetData:        r.GetData,
+			Camera3D: Camera3D{
+				Position:    mgl64.Vec3{0, 0, cameraDistance * e.radius},
+				FieldOfView: defaultCamera3D.FieldOfView,
+			},
+		})
+	}
+}
@@ -0,0 +1,14 @@
+#version 460
+
+in vec2 frag;
+out vec3 outputColor;
+
+// the histogram of a density program, accumulated and tone mapped on the CPU,
+// with the top row first and the longer side spanning -1 to 1 like frag
+uniform sampler2D density;
+
+void main() {
+    vec2 size = vec2(textureSize(density, 0));
+    vec2 texel = frag * vec2(1, -1) * max(size.x, size.y) / 2 + size / 2;
+    outputColor = texture(density, texel / size).rgb;
+}
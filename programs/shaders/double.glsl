@@ -0,0 +1,56 @@
+// GLSL only has single precision exp and sin, so these are reduced to a small range
+// then summed as Taylor series, with the constants split so the reduction stays exact.
+const double LN2 = 0.6931471805599453LF;
+const double LN2_HI = 6.93147180369123816490e-01LF;
+const double LN2_LO = 1.90821492927058770002e-10LF;
+const double PI_2 = 1.5707963267948966LF;
+const double PI_2_HI = 1.57079632673412561417e+00LF;
+const double PI_2_LO = 6.07710050650619224932e-11LF;
+
+double exp_d(double x) {
+    // past these exp over and underflows anyway
+    x = clamp(x, -708.0LF, 709.0LF);
+
+    double k = round(x / LN2);
+    double r = (x - k * LN2_HI) - k * LN2_LO;
+
+    // |r| <= ln(2)/2, so terms past r^13 are below double precision
+    double sum = 1;
+    double term = 1;
+    for (int i = 1; i <= 13; i++) {
+        term *= r / i;
+        sum += term;
+    }
+    return ldexp(sum, int(k));
+}
+
+// sin_cos_d returns the sine and cosine of x
+dvec2 sin_cos_d(double x) {
+    double k = round(x / PI_2);
+    double r = (x - k * PI_2_HI) - k * PI_2_LO;
+    double r2 = r * r;
+
+    // |r| <= π/4, so terms past r^18 are below double precision
+    double s = r;
+    double c = 1;
+    double s_term = r;
+    double c_term = 1;
+    for (int i = 1; i <= 9; i++) {
+        s_term *= -r2 / double(2 * i * (2 * i + 1));
+        c_term *= -r2 / double((2 * i - 1) * 2 * i);
+        s += s_term;
+        c += c_term;
+    }
+
+    // x is r plus k quarter turns
+    switch (int(mod(k, 4.0LF))) {
+    case 1:
+        return dvec2(c, -s);
+    case 2:
+        return dvec2(-s, -c);
+    case 3:
+        return dvec2(-c, s);
+    default:
+        return dvec2(s, c);
+    }
+}
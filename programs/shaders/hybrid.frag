@@ -0,0 +1,79 @@
+#version 460
+
+in vec2 frag;
+out vec3 outputColor;
+
+uniform uint max_iterations;
+uniform dvec2 pos;
+uniform double zoom;
+uniform dvec2 julia_c;
+uniform vec3 empty_colour;
+uniform sampler1D colour_pallet;
+uniform float pallet_scale;
+uniform uint pallet_offset;
+uniform double bailout;
+uniform uint bailout_test;
+
+dvec2 multiply(in dvec2 i, in dvec2 j) {
+    return dvec2(i.x * j.x - i.y * j.y, i.x * j.y + i.y * j.x);
+}
+{{range $i, $f := .Formulas}}
+// {{$f.Name}}
+dvec2 formula_{{$i}}(dvec2 z, dvec2 c) {
+    {{$f.GLSL}}
+}
+{{end}}
+// hybrid_step applies the formula for the given iteration, cycling through the sequence
+dvec2 hybrid_step(uint iteration, dvec2 z, dvec2 c) {
+    switch (iteration % {{len .Sequence}}u) {
+{{- range $i, $f := .Sequence}}
+    case {{$i}}u:
+        return formula_{{$f}}(z, c);
+{{- end}}
+    }
+    return z;
+}
+
+// escaped tests z against the bailout, with the test numbered as BailoutTest
+bool escaped(dvec2 z) {
+    switch (bailout_test) {
+    case 1u:
+        return dot(z, z) > bailout * bailout;
+    case 2u:
+        return z.x > bailout;
+    case 3u:
+        return abs(z.x) > bailout;
+    case 4u:
+        return abs(z.y) > bailout;
+    default:
+        return abs(z.x) + abs(z.y) > bailout;
+    }
+}
+
+vec3 pallet_colour(uint iterations) {
+    float size = float(textureSize(colour_pallet, 0));
+    float i = mod(float(iterations) * pallet_scale + float(pallet_offset), size);
+    return texture(colour_pallet, (i + 0.5) / size).rgb;
+}
+
+// JULIA is defined for the Julia set form, which takes c from julia_c instead of the position
+void main() {
+    dvec2 z = frag * zoom - pos;
+#ifdef JULIA
+    dvec2 c = julia_c;
+#else
+    dvec2 c = z;
+#endif
+
+    uint iterations = 0;
+    while (!escaped(z) && iterations < max_iterations) {
+        z = hybrid_step(iterations, z, c);
+        iterations++;
+    }
+
+    if (iterations == max_iterations) {
+        outputColor = empty_colour;
+    } else {
+        outputColor = pallet_colour(iterations);
+    }
+}
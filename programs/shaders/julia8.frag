@@ -1,6 +1,5 @@
 #version 460
 
-const uint COLOURS = 170;
 const uint SLIDERS = 5;
 
 in vec2 frag;
@@ -10,19 +9,45 @@ uniform uint max_iterations;
 uniform dvec2 pos;
 uniform double zoom;
 uniform vec3 empty_colour;
-uniform vec3[COLOURS] colour_pallet;
+uniform sampler1D colour_pallet;
+uniform float pallet_scale;
+uniform uint pallet_offset;
+uniform double bailout;
+uniform uint bailout_test;
 uniform double[SLIDERS] sliders;
 
 dvec2 multiply(in dvec2 i, in dvec2 j) {
     return dvec2(i.x * j.x - i.y * j.y, i.x * j.y + i.y * j.x);
 }
 
+// escaped tests z against the bailout, with the test numbered as BailoutTest
+bool escaped(dvec2 z) {
+    switch (bailout_test) {
+    case 1u:
+        return dot(z, z) > bailout * bailout;
+    case 2u:
+        return z.x > bailout;
+    case 3u:
+        return abs(z.x) > bailout;
+    case 4u:
+        return abs(z.y) > bailout;
+    default:
+        return abs(z.x) + abs(z.y) > bailout;
+    }
+}
+
+vec3 pallet_colour(uint iterations) {
+    float size = float(textureSize(colour_pallet, 0));
+    float i = mod(float(iterations) * pallet_scale + float(pallet_offset), size);
+    return texture(colour_pallet, (i + 0.5) / size).rgb;
+}
+
 void main() {
     dvec2 z = frag * zoom - pos;
     dvec2 c = dvec2(sliders[0]-1.08458626270294189453125,sliders[1]);
 
     uint iterations = 0;
-    while (abs(z.x) + abs(z.y) <= 4 && iterations < max_iterations) {
+    while (!escaped(z) && iterations < max_iterations) {
         z = multiply(multiply(multiply(z, z), multiply(z, z)), multiply(multiply(z, z), multiply(z, z))) + c;
         iterations++;
     }
@@ -30,6 +55,6 @@ void main() {
     if (iterations == max_iterations) {
         outputColor = empty_colour;
     } else {
-        outputColor = colour_pallet[iterations%COLOURS];
+        outputColor = pallet_colour(iterations);
     }
 }
@@ -0,0 +1,91 @@
+#version 460
+
+const double EPSILON = 1e-6;
+
+in vec2 frag;
+out vec3 outputColor;
+
+uniform uint max_iterations;
+uniform dvec2 pos;
+uniform double zoom;
+uniform dvec2 julia_c;
+uniform vec3 empty_colour;
+uniform sampler1D colour_pallet;
+uniform float pallet_scale;
+uniform uint pallet_offset;
+uniform double bailout;
+uniform uint bailout_test;
+
+dvec2 multiply(in dvec2 i, in dvec2 j) {
+    return dvec2(i.x * j.x - i.y * j.y, i.x * j.y + i.y * j.x);
+}
+
+dvec2 divide(in dvec2 i, in dvec2 j) {
+    return dvec2(i.x * j.x + i.y * j.y, i.y * j.x - i.x * j.y) / dot(j, j);
+}
+
+// MAGNET_II is defined for the type II formula, from the cubic rather than quadratic renormalisation
+dvec2 magnet(dvec2 z, dvec2 c) {
+    dvec2 one = dvec2(1, 0);
+#ifdef MAGNET_II
+    dvec2 c1 = c - one;
+    dvec2 c2 = c - 2 * one;
+    dvec2 c12 = multiply(c1, c2);
+    dvec2 numerator = multiply(z, multiply(z, z)) + 3 * multiply(c1, z) + c12;
+    dvec2 denominator = 3 * multiply(z, z) + 3 * multiply(c2, z) + c12 + one;
+#else
+    dvec2 numerator = multiply(z, z) + c - one;
+    dvec2 denominator = 2 * z + c - 2 * one;
+#endif
+    dvec2 q = divide(numerator, denominator);
+    return multiply(q, q);
+}
+
+// escaped tests z against the bailout, with the test numbered as BailoutTest
+bool escaped(dvec2 z) {
+    switch (bailout_test) {
+    case 1u:
+        return dot(z, z) > bailout * bailout;
+    case 2u:
+        return z.x > bailout;
+    case 3u:
+        return abs(z.x) > bailout;
+    case 4u:
+        return abs(z.y) > bailout;
+    default:
+        return abs(z.x) + abs(z.y) > bailout;
+    }
+}
+
+vec3 pallet_colour(uint iterations) {
+    float size = float(textureSize(colour_pallet, 0));
+    float i = mod(float(iterations) * pallet_scale + float(pallet_offset), size);
+    return texture(colour_pallet, (i + 0.5) / size).rgb;
+}
+
+// JULIA is defined for the Julia set form, which takes c from julia_c instead of the position
+void main() {
+    dvec2 point = frag * zoom - pos;
+#ifdef JULIA
+    dvec2 z = point;
+    dvec2 c = julia_c;
+#else
+    dvec2 z = dvec2(0);
+    dvec2 c = point;
+#endif
+
+    // points either escape or converge to the fixed point at 1, and both are coloured by how long they took
+    uint iterations = 0;
+    bool converged = false;
+    while (!escaped(z) && !converged && iterations < max_iterations) {
+        z = magnet(z, c);
+        converged = distance(z, dvec2(1, 0)) < EPSILON;
+        iterations++;
+    }
+
+    if (iterations == max_iterations) {
+        outputColor = empty_colour;
+    } else {
+        outputColor = pallet_colour(iterations);
+    }
+}
@@ -0,0 +1,69 @@
+#version 460
+
+const uint MAX_ROOTS = 8;
+const double EPSILON = 1e-6;
+
+in vec2 frag;
+out vec3 outputColor;
+
+uniform uint max_iterations;
+uniform dvec2 pos;
+uniform double zoom;
+uniform dvec2 julia_c;
+uniform vec3 empty_colour;
+uniform sampler1D colour_pallet;
+uniform float pallet_scale;
+uniform uint pallet_offset;
+uniform dvec2[MAX_ROOTS] roots;
+uniform uint root_count;
+
+dvec2 divide(in dvec2 i, in dvec2 j) {
+    return dvec2(i.x * j.x + i.y * j.y, i.y * j.x - i.x * j.y) / dot(j, j);
+}
+
+// newton_step is a step of Newton's method for the polynomial with the given roots,
+// where p(z)/p'(z) is the reciprocal of the sum of 1/(z - root)
+dvec2 newton_step(dvec2 z) {
+    dvec2 sum = dvec2(0);
+    for (uint i = 0; i < clamp(root_count, 1u, MAX_ROOTS); i++) {
+        dvec2 d = z - roots[i];
+        if (d == dvec2(0)) {
+            return z;
+        }
+        sum += divide(dvec2(1, 0), d);
+    }
+    return z - divide(dvec2(1, 0), sum);
+}
+
+vec3 pallet_colour(uint iterations) {
+    float size = float(textureSize(colour_pallet, 0));
+    float i = mod(float(iterations) * pallet_scale + float(pallet_offset), size);
+    return texture(colour_pallet, (i + 0.5) / size).rgb;
+}
+
+// JULIA is defined for the Julia set form, which takes c from julia_c and starts from the position.
+// The Mandelbrot form starts from the first root, which is a critical point of Newton's method.
+void main() {
+#ifdef JULIA
+    dvec2 z = frag * zoom - pos;
+    dvec2 c = julia_c;
+#else
+    dvec2 z = roots[0];
+    dvec2 c = frag * zoom - pos;
+#endif
+
+    uint iterations = 0;
+    bool converged = false;
+    while (!converged && iterations < max_iterations) {
+        dvec2 next = newton_step(z) + c;
+        converged = length(next - z) < EPSILON;
+        z = next;
+        iterations++;
+    }
+
+    if (!converged) {
+        outputColor = empty_colour;
+    } else {
+        outputColor = pallet_colour(iterations);
+    }
+}
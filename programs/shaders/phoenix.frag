@@ -0,0 +1,71 @@
+#version 460
+
+const uint SLIDERS = 5;
+
+in vec2 frag;
+out vec3 outputColor;
+
+uniform uint max_iterations;
+uniform dvec2 pos;
+uniform double zoom;
+uniform dvec2 julia_c;
+uniform vec3 empty_colour;
+uniform sampler1D colour_pallet;
+uniform float pallet_scale;
+uniform uint pallet_offset;
+uniform double bailout;
+uniform uint bailout_test;
+uniform double[SLIDERS] sliders;
+
+dvec2 multiply(in dvec2 i, in dvec2 j) {
+    return dvec2(i.x * j.x - i.y * j.y, i.x * j.y + i.y * j.x);
+}
+
+// escaped tests z against the bailout, with the test numbered as BailoutTest
+bool escaped(dvec2 z) {
+    switch (bailout_test) {
+    case 1u:
+        return dot(z, z) > bailout * bailout;
+    case 2u:
+        return z.x > bailout;
+    case 3u:
+        return abs(z.x) > bailout;
+    case 4u:
+        return abs(z.y) > bailout;
+    default:
+        return abs(z.x) + abs(z.y) > bailout;
+    }
+}
+
+vec3 pallet_colour(uint iterations) {
+    float size = float(textureSize(colour_pallet, 0));
+    float i = mod(float(iterations) * pallet_scale + float(pallet_offset), size);
+    return texture(colour_pallet, (i + 0.5) / size).rgb;
+}
+
+// JULIA is defined for the Julia set form, which takes c from julia_c instead of the position
+void main() {
+    dvec2 z = frag * zoom - pos;
+#ifdef JULIA
+    dvec2 c = julia_c;
+#else
+    dvec2 c = z;
+#endif
+    dvec2 p = dvec2(sliders[0], sliders[1]);
+
+    // each step adds p times the z before
+    dvec2 previous = dvec2(0);
+    uint iterations = 0;
+    while (!escaped(z) && iterations < max_iterations) {
+        dvec2 next = multiply(z, z) + c + multiply(p, previous);
+        previous = z;
+        z = next;
+        iterations++;
+    }
+
+    if (iterations == max_iterations) {
+        outputColor = empty_colour;
+    } else {
+        outputColor = pallet_colour(iterations);
+    }
+}
@@ -0,0 +1,238 @@
+#version 460
+
+const uint SLIDERS = 5;
+
+// raymarching walks each ray forward by the distance estimate of the fractal,
+// which is never more than the distance to its surface, until it's close enough to count as a hit
+const int MAX_MARCH_STEPS = 256;
+const float HIT_DETAIL = 1e-3;
+const float NORMAL_EPSILON = 1e-4;
+const uint MAX_ESTIMATE_ITERATIONS = 32;
+
+const int SHADOW_STEPS = 64;
+const float SHADOW_SOFTNESS = 8;
+const int OCCLUSION_STEPS = 5;
+const float OCCLUSION_STEP = 0.02;
+const float AMBIENT_LIGHT = 0.2;
+const float DIFFUSE_LIGHT = 0.8;
+const float SPECULAR_LIGHT = 0.4;
+const float SHININESS = 32;
+const float FOG_DENSITY = 0.2; // per bounding radius
+
+in vec2 frag;
+out vec3 outputColor;
+
+uniform uint max_iterations;
+uniform dvec3 camera_position;
+uniform double camera_yaw;
+uniform double camera_pitch;
+uniform double field_of_view;
+uniform dvec2 julia_c;
+uniform vec3 empty_colour;
+uniform sampler1D colour_pallet;
+uniform float pallet_scale;
+uniform uint pallet_offset;
+uniform double[SLIDERS] sliders;
+
+struct Estimate {
+    float dist;
+    uint iterations;
+};
+
+// MANDELBULB, MANDELBOX or QUATERNION_JULIA is defined to select the fractal,
+// along with the radius of a sphere around it to bound rays and fog by
+#if defined(MANDELBULB)
+const float BOUNDING_RADIUS = 1.2;
+
+// raises p to the power on slider 0 in spherical coordinates
+Estimate estimate(vec3 p) {
+    float power = float(sliders[0]);
+    uint iterations = min(max_iterations, MAX_ESTIMATE_ITERATIONS);
+
+    vec3 z = p;
+    float dr = 1;
+    float r = 0;
+    uint i = 0;
+    for (; i < iterations; i++) {
+        r = length(z);
+        if (r > 2) {
+            break;
+        }
+
+        float theta = acos(z.z / r) * power;
+        float phi = atan(z.y, z.x) * power;
+        dr = pow(r, power - 1) * power * dr + 1;
+
+        z = pow(r, power) * vec3(sin(theta) * cos(phi), sin(theta) * sin(phi), cos(theta)) + p;
+    }
+    return Estimate(0.5 * log(r) * r / dr, i);
+}
+#elif defined(MANDELBOX)
+const float BOUNDING_RADIUS = 3.5;
+
+// folds p into a box and sphere, then scales it by slider 0;
+// slider 1 is the radius inside which the sphere fold is linear
+Estimate estimate(vec3 p) {
+    float scale = float(sliders[0]);
+    float min_radius2 = float(sliders[1] * sliders[1]);
+    uint iterations = min(max_iterations, MAX_ESTIMATE_ITERATIONS);
+
+    vec3 z = p;
+    float dr = 1;
+    uint i = 0;
+    for (; i < iterations; i++) {
+        z = clamp(z, -1, 1) * 2 - z;
+
+        float r2 = dot(z, z);
+        if (r2 < min_radius2) {
+            z /= min_radius2;
+            dr /= min_radius2;
+        } else if (r2 < 1) {
+            z /= r2;
+            dr /= r2;
+        }
+
+        z = z * scale + p;
+        dr = dr * abs(scale) + 1;
+        if (dot(z, z) > 1e4) {
+            break;
+        }
+    }
+    return Estimate(length(z) / abs(dr), i);
+}
+#elif defined(QUATERNION_JULIA)
+const float BOUNDING_RADIUS = 2;
+
+// quaternions are stored with the real part in x
+vec4 quaternion_multiply(vec4 a, vec4 b) {
+    return vec4(a.x * b.x - dot(a.yzw, b.yzw), a.x * b.yzw + b.x * a.yzw + cross(a.yzw, b.yzw));
+}
+
+// iterates q² + c in the quaternions, with c made of julia_c and sliders 0 and 1,
+// in the 3D slice through slider 2
+Estimate estimate(vec3 p) {
+    vec4 c = vec4(julia_c, sliders[0], sliders[1]);
+    uint iterations = min(max_iterations, MAX_ESTIMATE_ITERATIONS);
+
+    vec4 q = vec4(p, sliders[2]);
+    vec4 dq = vec4(1, 0, 0, 0);
+    uint i = 0;
+    for (; i < iterations; i++) {
+        dq = 2 * quaternion_multiply(q, dq);
+        q = quaternion_multiply(q, q) + c;
+        if (dot(q, q) > 256) {
+            break;
+        }
+    }
+    if (i == iterations) {
+        // near the surface the estimate is too small to march past, so points that didn't escape are inside
+        return Estimate(0, i);
+    }
+    float r = length(q);
+    return Estimate(0.5 * r * log(r) / length(dq), i);
+}
+#endif
+
+float distance_estimate(vec3 p) {
+    return estimate(p).dist;
+}
+
+// march follows the ray from eye along dir, returning the length it went, or -1 if it missed
+float march(vec3 eye, vec3 dir) {
+    // past this the ray has gone through the bounding sphere
+    float max_length = length(eye) + 2 * BOUNDING_RADIUS;
+    float t = 0;
+    for (int i = 0; i < MAX_MARCH_STEPS; i++) {
+        float d = distance_estimate(eye + dir * t);
+        if (d < HIT_DETAIL * t) {
+            return t;
+        }
+        t += d;
+        if (t > max_length) {
+            break;
+        }
+    }
+    return -1;
+}
+
+// normal is the gradient of the distance estimate, sampled at the corners of a tetrahedron
+vec3 normal(vec3 p) {
+    const vec2 k = vec2(1, -1);
+    return normalize(
+        k.xyy * distance_estimate(p + k.xyy * NORMAL_EPSILON) +
+        k.yyx * distance_estimate(p + k.yyx * NORMAL_EPSILON) +
+        k.yxy * distance_estimate(p + k.yxy * NORMAL_EPSILON) +
+        k.xxx * distance_estimate(p + k.xxx * NORMAL_EPSILON)
+    );
+}
+
+// shadow is the light reaching p from the direction l, darkened by the fractal passing close to the ray
+float shadow(vec3 p, vec3 l) {
+    float s = 1;
+    float t = 10 * NORMAL_EPSILON;
+    for (int i = 0; i < SHADOW_STEPS; i++) {
+        float d = distance_estimate(p + l * t);
+        if (d < NORMAL_EPSILON) {
+            return 0;
+        }
+        s = min(s, SHADOW_SOFTNESS * d / t);
+        t += d;
+        if (t > 2 * BOUNDING_RADIUS) {
+            break;
+        }
+    }
+    return clamp(s, 0, 1);
+}
+
+// occlusion is the ambient light reaching p, less where the fractal is closer than the distance along n
+float occlusion(vec3 p, vec3 n) {
+    float occluded = 0;
+    float weight = 1;
+    for (int i = 1; i <= OCCLUSION_STEPS; i++) {
+        float h = OCCLUSION_STEP * i;
+        occluded += (h - distance_estimate(p + n * h)) * weight;
+        weight *= 0.7;
+    }
+    return clamp(1 - 3 * occluded, 0, 1);
+}
+
+vec3 pallet_colour(uint iterations) {
+    float size = float(textureSize(colour_pallet, 0));
+    float i = mod(float(iterations) * pallet_scale + float(pallet_offset), size);
+    return texture(colour_pallet, (i + 0.5) / size).rgb;
+}
+
+void main() {
+    // with no turn the camera looks along -z, with y up
+    float yaw = radians(float(camera_yaw));
+    float pitch = radians(float(camera_pitch));
+    vec3 eye = vec3(camera_position);
+    vec3 forward = vec3(sin(yaw) * cos(pitch), sin(pitch), -cos(yaw) * cos(pitch));
+    vec3 right = vec3(cos(yaw), 0, sin(yaw));
+    vec3 up = cross(right, forward);
+
+    // the screen's longer side spans -1 to 1, so this puts its edges at the field of view
+    float focal_length = 1 / tan(radians(float(field_of_view)) / 2);
+    vec3 dir = normalize(forward * focal_length + right * frag.x + up * frag.y);
+    float t = march(eye, dir);
+    if (t < 0) {
+        outputColor = empty_colour;
+        return;
+    }
+
+    // lit from above the camera, and faded into the empty colour with distance
+    vec3 p = eye + dir * t;
+    vec3 n = normal(p);
+    vec3 light = normalize(right * -0.4 + up * 0.8 - forward * 0.5);
+
+    float s = shadow(p + n * 2 * NORMAL_EPSILON, light);
+    float diffuse = max(dot(n, light), 0) * s;
+    vec3 half_vector = normalize(light - dir);
+    float specular = pow(max(dot(n, half_vector), 0), SHININESS) * s;
+    float ambient = occlusion(p, n);
+
+    vec3 colour = pallet_colour(estimate(p).iterations) * (AMBIENT_LIGHT * ambient + DIFFUSE_LIGHT * diffuse) + SPECULAR_LIGHT * specular;
+
+    float fog = exp(-FOG_DENSITY * t / BOUNDING_RADIUS);
+    outputColor = mix(empty_colour, colour, fog);
+}
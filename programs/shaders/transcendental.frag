@@ -0,0 +1,136 @@
+#version 460
+
+in vec2 frag;
+out vec3 outputColor;
+
+uniform uint max_iterations;
+uniform dvec2 pos;
+uniform double zoom;
+uniform dvec2 julia_c;
+uniform vec3 empty_colour;
+uniform sampler1D colour_pallet;
+uniform float pallet_scale;
+uniform uint pallet_offset;
+uniform double bailout;
+uniform uint bailout_test;
+
+dvec2 multiply(in dvec2 i, in dvec2 j) {
+    return dvec2(i.x * j.x - i.y * j.y, i.x * j.y + i.y * j.x);
+}
+
+// exp_d and sin_cos_d are joined from double.glsl, after the #version line
+
+// sinh_cosh_d returns the hyperbolic sine and cosine of x
+dvec2 sinh_cosh_d(double x) {
+    double e = exp_d(x);
+    return dvec2(e - 1 / e, e + 1 / e) / 2;
+}
+
+dvec2 complex_exp(dvec2 z) {
+    dvec2 y = sin_cos_d(z.y);
+    return exp_d(z.x) * dvec2(y.y, y.x);
+}
+
+dvec2 complex_sin(dvec2 z) {
+    dvec2 x = sin_cos_d(z.x);
+    dvec2 y = sinh_cosh_d(z.y);
+    return dvec2(x.x * y.y, x.y * y.x);
+}
+
+dvec2 complex_cos(dvec2 z) {
+    dvec2 x = sin_cos_d(z.x);
+    dvec2 y = sinh_cosh_d(z.y);
+    return dvec2(x.y * y.y, -x.x * y.x);
+}
+
+dvec2 complex_sinh(dvec2 z) {
+    dvec2 x = sinh_cosh_d(z.x);
+    dvec2 y = sin_cos_d(z.y);
+    return dvec2(x.x * y.y, x.y * y.x);
+}
+
+dvec2 complex_cosh(dvec2 z) {
+    dvec2 x = sinh_cosh_d(z.x);
+    dvec2 y = sin_cos_d(z.y);
+    return dvec2(x.y * y.y, x.x * y.x);
+}
+
+// One of these is defined to choose the map, which is multiplied by c each step.
+// Parameter space starts each point at a critical or asymptotic value of the map.
+#if defined(EXPONENTIAL)
+const dvec2 START = dvec2(0);
+dvec2 map(dvec2 z) {
+    return complex_exp(z);
+}
+#elif defined(SINE)
+const dvec2 START = dvec2(PI_2, 0);
+dvec2 map(dvec2 z) {
+    return complex_sin(z);
+}
+#elif defined(COSINE)
+const dvec2 START = dvec2(0);
+dvec2 map(dvec2 z) {
+    return complex_cos(z);
+}
+#elif defined(HYPERBOLIC_SINE)
+const dvec2 START = dvec2(0, PI_2);
+dvec2 map(dvec2 z) {
+    return complex_sinh(z);
+}
+#elif defined(HYPERBOLIC_COSINE)
+const dvec2 START = dvec2(0);
+dvec2 map(dvec2 z) {
+    return complex_cosh(z);
+}
+#elif defined(LAMBDA)
+const dvec2 START = dvec2(0.5, 0);
+dvec2 map(dvec2 z) {
+    return multiply(z, dvec2(1, 0) - z);
+}
+#endif
+
+// escaped tests z against the bailout, with the test numbered as BailoutTest
+bool escaped(dvec2 z) {
+    switch (bailout_test) {
+    case 1u:
+        return dot(z, z) > bailout * bailout;
+    case 2u:
+        return z.x > bailout;
+    case 3u:
+        return abs(z.x) > bailout;
+    case 4u:
+        return abs(z.y) > bailout;
+    default:
+        return abs(z.x) + abs(z.y) > bailout;
+    }
+}
+
+vec3 pallet_colour(uint iterations) {
+    float size = float(textureSize(colour_pallet, 0));
+    float i = mod(float(iterations) * pallet_scale + float(pallet_offset), size);
+    return texture(colour_pallet, (i + 0.5) / size).rgb;
+}
+
+// JULIA is defined for the Julia set form, which takes c from julia_c instead of the position
+void main() {
+    dvec2 point = frag * zoom - pos;
+#ifdef JULIA
+    dvec2 z = point;
+    dvec2 c = julia_c;
+#else
+    dvec2 z = START;
+    dvec2 c = point;
+#endif
+
+    uint iterations = 0;
+    while (!escaped(z) && iterations < max_iterations) {
+        z = multiply(c, map(z));
+        iterations++;
+    }
+
+    if (iterations == max_iterations) {
+        outputColor = empty_colour;
+    } else {
+        outputColor = pallet_colour(iterations);
+    }
+}
@@ -0,0 +1,115 @@
+package programs
+
+import (
+	_ "embed"
+	"math"
+	"math/cmplx"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+//go:embed shaders/transcendental.frag
+var transcendentalFragment string
+
+// transcendentalMap is a map multiplied by c each step, registered in both parameter space and Julia space.
+// Parameter space starts from start, a critical or asymptotic value of f, which decides the Julia set's connectedness.
+type transcendentalMap struct {
+	name    string
+	julia   string
+	define  string // selects f in the shader
+	start   complex128
+	f       func(complex128) complex128
+	degree  float64 // for smoothing, or 0 if f isn't a polynomial
+	bailout Bailout
+}
+
+var transcendentalMaps = []transcendentalMap{
+	{
+		name:    "Exponential",
+		julia:   "Exponential Julia",
+		define:  "EXPONENTIAL",
+		start:   0,
+		f:       cmplx.Exp,
+		bailout: Bailout{BailoutReal, 50},
+	},
+	{
+		name:    "Sine",
+		julia:   "Sine Julia",
+		define:  "SINE",
+		start:   math.Pi / 2,
+		f:       cmplx.Sin,
+		bailout: Bailout{BailoutAbsoluteImaginary, 50},
+	},
+	{
+		name:    "Cosine",
+		julia:   "Cosine Julia",
+		define:  "COSINE",
+		start:   0,
+		f:       cmplx.Cos,
+		bailout: Bailout{BailoutAbsoluteImaginary, 50},
+	},
+	{
+		name:    "Hyperbolic Sine",
+		julia:   "Hyperbolic Sine Julia",
+		define:  "HYPERBOLIC_SINE",
+		start:   complex(0, math.Pi/2),
+		f:       cmplx.Sinh,
+		bailout: Bailout{BailoutAbsoluteReal, 50},
+	},
+	{
+		name:    "Hyperbolic Cosine",
+		julia:   "Hyperbolic Cosine Julia",
+		define:  "HYPERBOLIC_COSINE",
+		start:   0,
+		f:       cmplx.Cosh,
+		bailout: Bailout{BailoutAbsoluteReal, 50},
+	},
+	{
+		name:   "Lambda",
+		julia:  "Lambda Julia",
+		define: "LAMBDA",
+		start:  .5,
+		f: func(z complex128) complex128 {
+			return z * (1 - z)
+		},
+		degree:  2,
+		bailout: Bailout{BailoutModulus, 100},
+	},
+}
+
+func init() {
+	for _, m := range transcendentalMaps {
+		fragment := defineShader(doubleShader(transcendentalFragment), m.define)
+
+		NewProgram(Program{
+			Name:           m.name,
+			Family:         m.name,
+			VertexShader:   defaultVertexShader,
+			FragmentShader: fragment,
+			Bailout:        m.bailout,
+			GetData: func(uniforms Uniforms, pos mgl32.Vec2) PixelData {
+				c := uniforms.Point(pos)
+
+				return escapeTime(uniforms, m.start, m.degree, func(z complex128) complex128 {
+					return c * m.f(z)
+				})
+			},
+		})
+
+		NewProgram(Program{
+			Name:           m.julia,
+			Family:         m.name,
+			Julia:          true,
+			VertexShader:   defaultVertexShader,
+			FragmentShader: juliaShader(fragment),
+			Bailout:        m.bailout,
+			GetData: func(uniforms Uniforms, pos mgl32.Vec2) PixelData {
+				c := complex(uniforms.JuliaC[0], uniforms.JuliaC[1])
+
+				return escapeTime(uniforms, uniforms.Point(pos), m.degree, func(z complex128) complex128 {
+					return c * m.f(z)
+				})
+			},
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package programs
 
 import (
+	"math"
 	"math/rand"
 	"time"
 
@@ -9,19 +10,27 @@ import (
 )
 
 const sliders = 5
-const colours = 170
 
-type ColourPallet [colours]mgl32.Vec3
+// MaxRoots is the most polynomial roots Newton's method programs can have.
+const MaxRoots = 8
+
+// DefaultPalletLength is the number of colours in a pallet unless another length is chosen.
+const DefaultPalletLength = 170
+
+// ColourPallet is the colours iterations are coloured by, wrapping around at the end.
+// The GPU reads it as a 1D texture, so it can be any length.
+type ColourPallet []mgl32.Vec3
 
 func RandomColourPallet(
 	start mgl32.Vec3,
 	randomWalkRate float32,
 	random *rand.Rand,
+	length int,
 ) ColourPallet {
-	var pallet ColourPallet
+	pallet := make(ColourPallet, max(length, 1))
 	pallet[0] = start
 
-	for i := 1; i < colours; i += 1 {
+	for i := 1; i < len(pallet); i += 1 {
 		pallet[i] = mgl32.Vec3{
 			limit(pallet[i-1].X() + (random.Float32()-.5)*randomWalkRate),
 			limit(pallet[i-1].Y() + (random.Float32()-.5)*randomWalkRate),
@@ -31,6 +40,26 @@ func RandomColourPallet(
 	return pallet
 }
 
+// At returns the colour at position i along the pallet, wrapping around at the end.
+// It is the nearest colour, or if linear, mixed from the colours either side,
+// the same as the GPU samples the pallet texture.
+func (p ColourPallet) At(i float32, linear bool) mgl32.Vec3 {
+	if len(p) == 0 {
+		return mgl32.Vec3{}
+	}
+
+	n := float32(len(p))
+	i -= n * float32(math.Floor(float64(i/n)))
+
+	if !linear {
+		return p[int(i+.5)%len(p)]
+	}
+
+	j := int(i)
+	f := i - float32(j)
+	return p[j%len(p)].Mul(1 - f).Add(p[(j+1)%len(p)].Mul(f))
+}
+
 func limit(n float32) float32 {
 	if n < 0 {
 		return 0
@@ -44,13 +73,31 @@ func limit(n float32) float32 {
 }
 
 type Uniforms struct {
-	Zoom         float64          `uniform:"zoom"`
-	Pos          mgl64.Vec2       `uniform:"pos"`
-	Iterations   uint32           `uniform:"max_iterations"`
-	Sliders      [sliders]float64 `uniform:"sliders"`
-	Camera       mgl32.Mat4       `uniform:"camera"`
-	EmptyColour  mgl32.Vec3       `uniform:"empty_colour"`
-	ColourPallet ColourPallet     `uniform:"colour_pallet"`
+	Zoom         float64              `uniform:"zoom"`
+	Pos          mgl64.Vec2           `uniform:"pos"`
+	Iterations   uint32               `uniform:"max_iterations"`
+	Sliders      [sliders]float64     `uniform:"sliders"`
+	JuliaC       mgl64.Vec2           `uniform:"julia_c"`    // c of Julia set programs
+	Roots        [MaxRoots]mgl64.Vec2 `uniform:"roots"`      // roots of the polynomial Newton's method programs solve
+	RootCount    uint32               `uniform:"root_count"` // number of Roots used
+	Bailout      float64              `uniform:"bailout"`    // radius past which points have escaped, by BailoutTest
+	BailoutTest  BailoutTest          `uniform:"bailout_test"`
+	CameraPos    mgl64.Vec3           `uniform:"camera_position"` // where 3D programs are seen from, set with SetCamera3D
+	CameraYaw    float64              `uniform:"camera_yaw"`
+	CameraPitch  float64              `uniform:"camera_pitch"`
+	FieldOfView  float64              `uniform:"field_of_view"`
+	Camera       mgl32.Mat4           `uniform:"camera"`
+	EmptyColour  mgl32.Vec3           `uniform:"empty_colour"`
+	ColourPallet ColourPallet         `uniform:"colour_pallet"`
+	PalletScale  float32              `uniform:"pallet_scale"`  // colours moved along the pallet each iteration
+	PalletOffset uint32               `uniform:"pallet_offset"` // added to the iterations before picking a colour
+	PalletLinear bool                 `uniform:"-"`             // mix between colours instead of taking the nearest, set on the pallet texture
+	PalletSource string               `uniform:"-"`             // file the pallet was imported or extracted from, if any
+
+	DensitySampling DensitySampling `uniform:"-"` // how density programs choose the points whose orbits they count
+	DensitySamples  float64         `uniform:"-"` // orbits density programs count for each pixel
+	ToneMap         ToneMap         `uniform:"-"` // how density programs turn counts into brightness
+	Flame           Flame           `uniform:"-"` // transforms of fractal flame programs; Clone it before editing
 }
 
 func (u *Uniforms) DefaultValues() {
@@ -58,8 +105,18 @@ func (u *Uniforms) DefaultValues() {
 	u.Pos = mgl64.Vec2{0, 0}
 	u.Iterations = 500
 	u.Sliders = [sliders]float64{}
+	u.JuliaC = mgl64.Vec2{-1, 0}
+	u.Roots = [MaxRoots]mgl64.Vec2{{1, 0}, {-.5, math.Sqrt(3) / 2}, {-.5, -math.Sqrt(3) / 2}}
+	u.RootCount = 3
+	u.SetBailout(defaultBailout)
+	u.SetCamera3D(defaultCamera3D)
 	u.Camera = mgl32.Ident4()
 	u.EmptyColour = mgl32.Vec3{0.1, 0.1, 0.1}
+	u.PalletScale = 1
+	u.DensitySampling = SampleUniform
+	u.DensitySamples = DefaultDensitySamples
+	u.ToneMap = ToneSquareRoot
+	u.Flame = DefaultFlame()
 	u.ColourPallet = RandomColourPallet(
 		mgl32.Vec3{
 			rand.Float32(),
@@ -68,5 +125,42 @@ func (u *Uniforms) DefaultValues() {
 		},
 		0.3,
 		rand.New(rand.NewSource(time.Now().Unix())),
+		DefaultPalletLength,
 	)
 }
+
+// SetBailout sets the escape test and radius.
+func (u *Uniforms) SetBailout(b Bailout) {
+	u.BailoutTest, u.Bailout = b.Test, b.Radius
+}
+
+// SetCamera3D sets the camera of 3D programs.
+func (u *Uniforms) SetCamera3D(c Camera3D) {
+	u.CameraPos, u.CameraYaw, u.CameraPitch, u.FieldOfView = c.Position, c.Yaw, c.Pitch, c.FieldOfView
+}
+
+// Camera3D returns the camera of 3D programs.
+func (u *Uniforms) Camera3D() Camera3D {
+	return Camera3D{
+		Position:    u.CameraPos,
+		Yaw:         u.CameraYaw,
+		Pitch:       u.CameraPitch,
+		FieldOfView: u.FieldOfView,
+	}
+}
+
+// Point returns the point in the complex plane at pos on the screen.
+func (u *Uniforms) Point(pos mgl32.Vec2) complex128 {
+	return complex(
+		float64(pos[0])*u.Zoom-u.Pos[0],
+		float64(pos[1])*u.Zoom-u.Pos[1],
+	)
+}
+
+// Colour returns the colour of a pixel from its iteration results.
+func (u *Uniforms) Colour(data PixelData) mgl32.Vec3 {
+	if !data.Escaped {
+		return u.EmptyColour
+	}
+	return u.ColourPallet.At(float32(data.Iterations)*u.PalletScale+float32(u.PalletOffset), u.PalletLinear)
+}
@@ -0,0 +1,137 @@
+package programs
+
+import (
+	_ "embed"
+	"math"
+	"strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+//go:embed shaders/double.glsl
+var doubleFunctions string
+
+//go:embed shaders/variant.frag
+var variantFragment string
+
+// variant is a quadratic Mandelbrot variant, with absolute values or conjugates in its step,
+// registered in both parameter space and Julia space, and as a formula for hybrids.
+type variant struct {
+	name    string
+	julia   string
+	formula string // its name among the HybridFormulas
+	glsl    string // body of its step, on one line so it can be defined in the shader
+	step    func(z, c complex128) complex128
+}
+
+var variants = []variant{
+	{
+		name:    "Burning Ship",
+		julia:   "Burning Ship Julia",
+		formula: "Burning Ship",
+		glsl:    "z = abs(z); return dvec2(z.x * z.x - z.y * z.y, 2 * z.x * z.y) + c;",
+		step: func(z, c complex128) complex128 {
+			x, y := math.Abs(real(z)), math.Abs(imag(z))
+			return complex(x*x-y*y, 2*x*y) + c
+		},
+	},
+	{
+		name:    "Tricorn",
+		julia:   "Tricorn Julia",
+		formula: "Tricorn",
+		glsl:    "return dvec2(z.x * z.x - z.y * z.y, -2 * z.x * z.y) + c;",
+		step: func(z, c complex128) complex128 {
+			x, y := real(z), imag(z)
+			return complex(x*x-y*y, -2*x*y) + c
+		},
+	},
+	{
+		name:    "Celtic",
+		julia:   "Celtic Julia",
+		formula: "Celtic",
+		glsl:    "return dvec2(abs(z.x * z.x - z.y * z.y), 2 * z.x * z.y) + c;",
+		step: func(z, c complex128) complex128 {
+			x, y := real(z), imag(z)
+			return complex(math.Abs(x*x-y*y), 2*x*y) + c
+		},
+	},
+	{
+		name:    "Buffalo",
+		julia:   "Buffalo Julia",
+		formula: "Buffalo",
+		glsl:    "return dvec2(abs(z.x * z.x - z.y * z.y), -2 * abs(z.x * z.y)) + c;",
+		step: func(z, c complex128) complex128 {
+			x, y := real(z), imag(z)
+			return complex(math.Abs(x*x-y*y), -2*math.Abs(x*y)) + c
+		},
+	},
+	{
+		name:    "Perpendicular Mandelbrot",
+		julia:   "Perpendicular Julia",
+		formula: "Perpendicular",
+		glsl:    "return dvec2(z.x * z.x - z.y * z.y, -2 * abs(z.x) * z.y) + c;",
+		step: func(z, c complex128) complex128 {
+			x, y := real(z), imag(z)
+			return complex(x*x-y*y, -2*math.Abs(x)*y) + c
+		},
+	},
+}
+
+// variantFormulas returns the variants as steps hybrids can take.
+func variantFormulas() []HybridFormula {
+	formulas := make([]HybridFormula, len(variants))
+	for i, v := range variants {
+		formulas[i] = HybridFormula{Name: v.formula, GLSL: v.glsl, Degree: 2, Step: v.step}
+	}
+	return formulas
+}
+
+// defineShader defines name in fragment, after its #version line.
+func defineShader(fragment, name string) string {
+	return strings.Replace(fragment, "\n", "\n#define "+name+"\n", 1)
+}
+
+// doubleShader joins the double precision functions of double.glsl to fragment, after its #version line.
+func doubleShader(fragment string) string {
+	return strings.Replace(fragment, "\n", "\n"+doubleFunctions, 1)
+}
+
+// juliaShader defines JULIA in fragment, switching it to its Julia set form.
+func juliaShader(fragment string) string {
+	return defineShader(fragment, "JULIA")
+}
+
+func init() {
+	for _, v := range variants {
+		fragment := defineShader(variantFragment, "STEP "+v.glsl)
+
+		NewProgram(Program{
+			Name:           v.name,
+			Family:         v.name,
+			VertexShader:   defaultVertexShader,
+			FragmentShader: fragment,
+			GetData: func(uniforms Uniforms, pos mgl32.Vec2) PixelData {
+				c := uniforms.Point(pos)
+
+				return escapeTime(uniforms, c, 2, func(z complex128) complex128 {
+					return v.step(z, c)
+				})
+			},
+		})
+
+		NewProgram(Program{
+			Name:           v.julia,
+			Family:         v.name,
+			Julia:          true,
+			VertexShader:   defaultVertexShader,
+			FragmentShader: juliaShader(fragment),
+			GetData: func(uniforms Uniforms, pos mgl32.Vec2) PixelData {
+				c := complex(uniforms.JuliaC[0], uniforms.JuliaC[1])
+
+				return escapeTime(uniforms, uniforms.Point(pos), 2, func(z complex128) complex128 {
+					return v.step(z, c)
+				})
+			},
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/stewi1014/glfractal/programs"
+)
+
+// renderRawTo renders program to w as floating point colour or raw iteration data.
+//
+// Rows are streamed to w as they are rendered, so memory use doesn't depend on the image size.
+func renderRawTo(
+	ctx context.Context,
+	w io.Writer,
+	opts SaveOptions,
+	program programs.Program,
+	uniforms programs.Uniforms,
+	progress progressReporter,
+) (RenderStats, error) {
+	stats := RenderStats{
+		Pixels:  opts.Width * opts.Height,
+		Threads: renderThreads(),
+	}
+	start := time.Now()
+
+	comments := parametersText(renderParameters(program, uniforms))
+
+	var header []byte
+	var rows int
+	var row func(i int) []byte
+
+	if opts.Format.IsData() {
+		img, err := program.GetDataImage(uniforms, opts.Width, opts.Height)
+		if err != nil {
+			return stats, err
+		}
+		if opts.ExpMap {
+			img = ExpMapData(img)
+		}
+		bounds := img.Bounds()
+		scaleFactor := pixelScale(bounds)
+		rows = bounds.Dy()
+
+		data := func(y int) (iterations, smooth, re, im []float64) {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				d := img.GetData(pixelPos(scaleFactor, x, y))
+				iterations = append(iterations, float64(d.Iterations))
+				smooth = append(smooth, d.Smooth)
+				re = append(re, real(d.Z))
+				im = append(im, imag(d.Z))
+			}
+			return
+		}
+
+		if opts.Format == FormatEXRData {
+			channels := []string{"iterations", "smooth", "z.re", "z.im"}
+			header = exrHeader(bounds.Dx(), bounds.Dy(), channels, comments)
+			row = func(i int) []byte {
+				iterations, smooth, re, im := data(bounds.Min.Y + i)
+				return exrScanline(i, channels, [][]float64{iterations, smooth, re, im})
+			}
+		} else {
+			header = npyHeader("<f8", bounds.Dy(), bounds.Dx(), 4)
+			row = func(i int) []byte {
+				iterations, smooth, re, im := data(bounds.Min.Y + i)
+				b := make([]byte, 0, len(iterations)*4*8)
+				for x := range iterations {
+					for _, v := range []float64{iterations[x], smooth[x], re[x], im[x]} {
+						b = binary.LittleEndian.AppendUint64(b, math.Float64bits(v))
+					}
+				}
+				return b
+			}
+		}
+	} else {
+		img, err := program.GetImage(uniforms, opts.Width, opts.Height)
+		if err != nil {
+			return stats, err
+		}
+		if opts.ExpMap {
+			img = ExpMap(img)
+		}
+		img = Supersample(img, opts.Supersample)
+		bounds := img.Bounds()
+		scaleFactor := pixelScale(bounds)
+		rows = bounds.Dy()
+
+		colour := func(y int) (r, g, b []float64) {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				c := programs.SRGBToLinear(img.GetPixel(pixelPos(scaleFactor, x, y)))
+				r = append(r, float64(c[0]))
+				g = append(g, float64(c[1]))
+				b = append(b, float64(c[2]))
+			}
+			return
+		}
+
+		if opts.Format == FormatEXR {
+			channels := []string{"R", "G", "B"}
+			header = exrHeader(bounds.Dx(), bounds.Dy(), channels, comments)
+			row = func(i int) []byte {
+				r, g, b := colour(bounds.Min.Y + i)
+				return exrScanline(i, channels, [][]float64{r, g, b})
+			}
+		} else {
+			header = []byte(fmt.Sprintf("PF\n%v %v\n-1.0\n", bounds.Dx(), bounds.Dy()))
+			row = func(i int) []byte {
+				// PFM stores rows from the bottom up
+				r, g, b := colour(bounds.Max.Y - 1 - i)
+				out := make([]byte, 0, len(r)*3*4)
+				for x := range r {
+					out = binary.LittleEndian.AppendUint32(out, math.Float32bits(float32(r[x])))
+					out = binary.LittleEndian.AppendUint32(out, math.Float32bits(float32(g[x])))
+					out = binary.LittleEndian.AppendUint32(out, math.Float32bits(float32(b[x])))
+				}
+				return out
+			}
+		}
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return stats, err
+	}
+
+	err := renderRows(ctx, w, rows, opts.Width, row, progress, "Rendering "+opts.Format.String())
+	stats.Duration = time.Since(start)
+	return stats, err
+}
+
+// renderRows writes the result of row for each row in order,
+// rendering a few batches of rows concurrently ahead of the writer.
+func renderRows(
+	ctx context.Context,
+	w io.Writer,
+	rows, width int,
+	row func(i int) []byte,
+	progress progressReporter,
+	description string,
+) error {
+	ctx, quit := context.WithCancelCause(ctx)
+	defer quit(nil)
+
+	threads := renderThreads()
+	batch := make([][]byte, threads*4)
+
+	var done atomic.Uint64
+	start := time.Now()
+	progress.AddProgressSupplier(ctx, func() Progress {
+		n := done.Load()
+		return Progress{
+			Fraction: float64(n) / float64(rows),
+			Samples:  n * uint64(width),
+			Elapsed:  time.Since(start),
+		}
+	}, description)
+
+	for first := 0; first < rows; first += len(batch) {
+		n := min(len(batch), rows-first)
+
+		var next atomic.Int64
+		var wg sync.WaitGroup
+		for t := 0; t < threads; t++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer CatchPanicToContext(quit)
+
+				for ctx.Err() == nil {
+					i := int(next.Add(1)) - 1
+					if i >= n {
+						return
+					}
+					batch[i] = row(first + i)
+					done.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+
+		for _, b := range batch[:n] {
+			if _, err := w.Write(b); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// npyHeader returns the header of a NumPy array with the given element type and shape,
+// to be followed by the elements in C order.
+func npyHeader(descr string, shape ...int) []byte {
+	dims := ""
+	for _, d := range shape {
+		dims += fmt.Sprintf("%v, ", d)
+	}
+	dict := fmt.Sprintf("{'descr': '%v', 'fortran_order': False, 'shape': (%v), }", descr, dims[:len(dims)-2])
+
+	// the header is padded with spaces so the data starts 64 byte aligned
+	const prefix = 10
+	padding := 64 - (prefix+len(dict)+1)%64
+	dict += string(bytes.Repeat([]byte{' '}, padding%64)) + "\n"
+
+	var b bytes.Buffer
+	b.WriteString("\x93NUMPY\x01\x00")
+	binary.Write(&b, binary.LittleEndian, uint16(len(dict)))
+	b.WriteString(dict)
+	return b.Bytes()
+}
+
+// exrHeader returns the header and line offset table of an uncompressed
+// scanline OpenEXR image with 32 bit float channels, and comments as its comments attribute.
+func exrHeader(width, height int, channels []string, comments string) []byte {
+	var b bytes.Buffer
+	le := func(v any) { binary.Write(&b, binary.LittleEndian, v) }
+	attribute := func(name, typ string, value []byte) {
+		b.WriteString(name + "\x00" + typ + "\x00")
+		le(int32(len(value)))
+		b.Write(value)
+	}
+	bytesOf := func(v ...any) []byte {
+		var b bytes.Buffer
+		for _, v := range v {
+			binary.Write(&b, binary.LittleEndian, v)
+		}
+		return b.Bytes()
+	}
+
+	b.Write([]byte{0x76, 0x2f, 0x31, 0x01})
+	le(int32(2))
+
+	sorted := append([]string(nil), channels...)
+	sort.Strings(sorted)
+	var chlist bytes.Buffer
+	for _, name := range sorted {
+		chlist.WriteString(name + "\x00")
+		chlist.Write(bytesOf(int32(2), uint8(0), [3]uint8{}, int32(1), int32(1)))
+	}
+	chlist.WriteByte(0)
+
+	window := bytesOf(int32(0), int32(0), int32(width-1), int32(height-1))
+	attribute("channels", "chlist", chlist.Bytes())
+	attribute("comments", "string", []byte(comments))
+	attribute("compression", "compression", []byte{0})
+	attribute("dataWindow", "box2i", window)
+	attribute("displayWindow", "box2i", window)
+	attribute("lineOrder", "lineOrder", []byte{0})
+	attribute("pixelAspectRatio", "float", bytesOf(float32(1)))
+	attribute("screenWindowCenter", "v2f", bytesOf(float32(0), float32(0)))
+	attribute("screenWindowWidth", "float", bytesOf(float32(1)))
+	b.WriteByte(0)
+
+	lineSize := 8 + width*len(channels)*4
+	offset := b.Len() + height*8
+	for y := 0; y < height; y++ {
+		le(uint64(offset + y*lineSize))
+	}
+
+	return b.Bytes()
+}
+
+// exrScanline encodes line y of an image written with exrHeader.
+// values holds a row of values for each channel, in the same order as channels.
+func exrScanline(y int, channels []string, values [][]float64) []byte {
+	order := make([]int, len(channels))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return channels[order[i]] < channels[order[j]] })
+
+	width := len(values[0])
+	b := make([]byte, 0, 8+width*len(channels)*4)
+	b = binary.LittleEndian.AppendUint32(b, uint32(y))
+	b = binary.LittleEndian.AppendUint32(b, uint32(width*len(channels)*4))
+	for _, c := range order {
+		for _, v := range values[c] {
+			b = binary.LittleEndian.AppendUint32(b, math.Float32bits(float32(v)))
+		}
+	}
+	return b
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/stewi1014/glfractal/programs"
+)
+
+type SamplePattern int
+
+const (
+	SampleNone SamplePattern = iota
+	SampleGrid
+	SampleRotatedGrid
+	SampleJittered
+)
+
+var samplePatternNames = []string{"None", "Grid", "Rotated Grid", "Jittered"}
+
+func (p SamplePattern) String() string { return samplePatternNames[p] }
+
+type SampleFilter int
+
+const (
+	FilterBox SampleFilter = iota
+	FilterTent
+	FilterGaussian
+	FilterLanczos
+)
+
+var sampleFilterNames = []string{"Box", "Tent", "Gaussian", "Lanczos"}
+
+func (f SampleFilter) String() string { return sampleFilterNames[f] }
+
+// radius returns the filter's support in pixels.
+func (f SampleFilter) radius() float32 {
+	switch f {
+	case FilterTent:
+		return 1
+	case FilterGaussian:
+		return 1.5
+	case FilterLanczos:
+		return 2
+	default:
+		return .5
+	}
+}
+
+func (f SampleFilter) weight(x float32) float32 {
+	x = float32(math.Abs(float64(x)))
+	if x > f.radius() {
+		return 0
+	}
+
+	switch f {
+	case FilterTent:
+		return 1 - x
+	case FilterGaussian:
+		const sigma = .5
+		return float32(math.Exp(-float64(x*x) / (2 * sigma * sigma)))
+	case FilterLanczos:
+		if x == 0 {
+			return 1
+		}
+		px := math.Pi * float64(x)
+		a := float64(f.radius())
+		return float32(a * math.Sin(px) * math.Sin(px/a) / (px * px))
+	default:
+		return 1
+	}
+}
+
+// parseEnum finds s in names, ignoring case and spaces.
+func parseEnum(names []string, s string) (int, error) {
+	s = strings.ReplaceAll(s, " ", "")
+	for i, name := range names {
+		if strings.EqualFold(strings.ReplaceAll(name, " ", ""), s) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%q is not one of %v", s, strings.Join(names, ", "))
+}
+
+// SupersampleOptions configures how each pixel is sampled.
+//
+// Samples is the number of samples along each axis,
+// so each pixel takes Samples*Samples samples.
+// Seed only affects the jittered pattern, which gives identical results for the same seed.
+//
+// If Adaptive is set, only pixels that differ from a neighbour by more than
+// Threshold in any channel are supersampled.
+type SupersampleOptions struct {
+	Pattern   SamplePattern
+	Samples   int
+	Filter    SampleFilter
+	Seed      int64
+	Adaptive  bool
+	Threshold float32
+}
+
+// Supersample takes several samples over the filter's footprint for each pixel,
+// returning their weighted average taken in linear light.
+func Supersample(img programs.Image, opts SupersampleOptions) programs.Image {
+	if opts.Pattern == SampleNone || opts.Samples < 1 {
+		return img
+	}
+
+	scaleFactor := float32(img.Bounds().Dx())
+	if img.Bounds().Dy() > img.Bounds().Dx() {
+		scaleFactor = float32(img.Bounds().Dy())
+	}
+
+	i := &supersampleImage{
+		Image: img,
+		opts:  opts,
+		pixel: 2 / scaleFactor,
+	}
+
+	if opts.Pattern != SampleJittered {
+		i.offsets = make([]mgl32.Vec2, 0, opts.Samples*opts.Samples)
+		angle := float64(0)
+		scale := float32(1)
+		if opts.Pattern == SampleRotatedGrid {
+			// the classic RGSS angle, scaled back inside the pixel's footprint
+			angle = math.Atan(.5)
+			scale = float32(1 / (math.Cos(angle) + math.Sin(angle)))
+		}
+		rotation := mgl32.Rotate2D(float32(angle)).Mul(scale)
+
+		for y := 0; y < opts.Samples; y++ {
+			for x := 0; x < opts.Samples; x++ {
+				i.offsets = append(i.offsets, rotation.Mul2x1(i.stratum(x, y, .5, .5)))
+			}
+		}
+	}
+
+	if opts.Adaptive {
+		return AdaptiveAntiAlias(img, i, opts.Threshold)
+	}
+
+	return i
+}
+
+type supersampleImage struct {
+	programs.Image
+	opts    SupersampleOptions
+	pixel   float32
+	offsets []mgl32.Vec2
+}
+
+// stratum returns the position in pixels of the point (u, v) inside stratum x, y,
+// where u and v range from 0 to 1.
+func (i *supersampleImage) stratum(x, y int, u, v float32) mgl32.Vec2 {
+	r := i.opts.Filter.radius()
+	n := float32(i.opts.Samples)
+	return mgl32.Vec2{
+		((float32(x)+u)/n*2 - 1) * r,
+		((float32(y)+v)/n*2 - 1) * r,
+	}
+}
+
+func (i *supersampleImage) GetPixel(pos mgl32.Vec2) mgl32.Vec3 {
+	var sum mgl32.Vec3
+	var total float32
+
+	sample := func(offset mgl32.Vec2) {
+		w := i.opts.Filter.weight(offset[0]) * i.opts.Filter.weight(offset[1])
+		if w == 0 {
+			return
+		}
+		c := programs.SRGBToLinear(i.Image.GetPixel(pos.Add(offset.Mul(i.pixel))))
+		sum = sum.Add(c.Mul(w))
+		total += w
+	}
+
+	if i.opts.Pattern == SampleJittered {
+		random := newSampleRandom(i.opts.Seed, pos)
+		for y := 0; y < i.opts.Samples; y++ {
+			for x := 0; x < i.opts.Samples; x++ {
+				sample(i.stratum(x, y, random.Float32(), random.Float32()))
+			}
+		}
+	} else {
+		for _, offset := range i.offsets {
+			sample(offset)
+		}
+	}
+
+	if total == 0 {
+		return i.Image.GetPixel(pos)
+	}
+
+	c := sum.Mul(1 / total)
+	return programs.LinearToSRGB(mgl32.Vec3{limit(c[0]), limit(c[1]), limit(c[2])})
+}
+
+func limit(n float32) float32 {
+	return mgl32.Clamp(n, 0, 1)
+}
+
+// sampleRandom is a splitmix64 generator seeded from the pixel position,
+// so jittered samples don't depend on the order pixels are rendered in.
+type sampleRandom uint64
+
+func newSampleRandom(seed int64, pos mgl32.Vec2) *sampleRandom {
+	r := sampleRandom(uint64(seed) ^
+		uint64(math.Float32bits(pos[0]))<<32 ^
+		uint64(math.Float32bits(pos[1])))
+	return &r
+}
+
+func (r *sampleRandom) Uint64() uint64 {
+	*r += 0x9e3779b97f4a7c15
+	z := uint64(*r)
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+func (r *sampleRandom) Float32() float32 {
+	return float32(r.Uint64()>>40) / (1 << 24)
+}
+
+// AdaptiveAntiAlias takes one sample per pixel from img,
+// only returning refined's pixel where a neighbouring sample differs by more than threshold.
+//
+// Single samples are cached a few rows at a time,
+// so pixels should be requested roughly in row order.
+func AdaptiveAntiAlias(img programs.Image, refined programs.Image, threshold float32) programs.Image {
+	scaleFactor := float32(img.Bounds().Dx())
+	if img.Bounds().Dy() > img.Bounds().Dx() {
+		scaleFactor = float32(img.Bounds().Dy())
+	}
+
+	return &adaptiveImage{
+		Image:     img,
+		refined:   refined,
+		threshold: threshold,
+		pixel:     2 / scaleFactor,
+		rows:      make(map[int]*sampleRow),
+		maxRows:   4*renderThreads() + 8,
+	}
+}
+
+type adaptiveImage struct {
+	programs.Image
+	refined   programs.Image
+	threshold float32
+	pixel     float32
+
+	rowsMutex sync.Mutex
+	rows      map[int]*sampleRow
+	maxRows   int
+}
+
+type sampleRow struct {
+	once   sync.Once
+	pixels []mgl32.Vec3
+}
+
+// row returns the single samples for row y, from one pixel left of the bounds to one pixel right.
+func (i *adaptiveImage) row(y int) []mgl32.Vec3 {
+	i.rowsMutex.Lock()
+	row, ok := i.rows[y]
+	if !ok {
+		row = &sampleRow{}
+		i.rows[y] = row
+
+		if len(i.rows) > i.maxRows {
+			for cached := range i.rows {
+				if cached < y-i.maxRows/2 || cached > y+i.maxRows/2 {
+					delete(i.rows, cached)
+				}
+			}
+		}
+	}
+	i.rowsMutex.Unlock()
+
+	row.once.Do(func() {
+		min, max := i.Bounds().Min.X-1, i.Bounds().Max.X
+		row.pixels = make([]mgl32.Vec3, 0, max-min+1)
+		for x := min; x <= max; x++ {
+			row.pixels = append(row.pixels, i.Image.GetPixel(mgl32.Vec2{
+				float32(x) * i.pixel,
+				float32(y) * i.pixel,
+			}))
+		}
+	})
+
+	return row.pixels
+}
+
+func (i *adaptiveImage) GetPixel(pos mgl32.Vec2) mgl32.Vec3 {
+	fx := math.Round(float64(pos[0] / i.pixel))
+	fy := math.Round(float64(pos[1] / i.pixel))
+	x, y := int(fx), int(fy)
+
+	onGrid := math.Abs(fx-float64(pos[0]/i.pixel)) < 0.01 && math.Abs(fy-float64(pos[1]/i.pixel)) < 0.01
+	if !onGrid || x < i.Bounds().Min.X || x >= i.Bounds().Max.X {
+		return i.refined.GetPixel(pos)
+	}
+
+	x -= i.Bounds().Min.X - 1
+	row := i.row(y)
+	centre := row[x]
+
+	neighbours := [...]mgl32.Vec3{row[x-1], row[x+1], i.row(y - 1)[x], i.row(y + 1)[x]}
+	for _, neighbour := range neighbours {
+		d := neighbour.Sub(centre)
+		if math.Abs(float64(d[0])) > float64(i.threshold) ||
+			math.Abs(float64(d[1])) > float64(i.threshold) ||
+			math.Abs(float64(d[2])) > float64(i.threshold) {
+			return i.refined.GetPixel(pos)
+		}
+	}
+
+	return centre
+}
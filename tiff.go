@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io"
+)
+
+// tiffTag is an IFD entry with either SHORT, LONG or ASCII values.
+type tiffTag struct {
+	tag    uint16
+	typ    uint16
+	shorts []uint16
+	longs  []uint64
+	ascii  string
+}
+
+const (
+	tiffASCII = 2
+	tiffShort = 3
+	tiffLong  = 4
+	tiffLong8 = 16
+)
+
+// maxClassicTIFF is the largest file that can be addressed by a classic TIFF's 32 bit offsets,
+// with some room left over for the header.
+const maxClassicTIFF = 1<<32 - 1<<20
+
+// encodeTIFF writes img as an uncompressed RGB TIFF, one row per strip.
+//
+// 16 bit images are stored with 16 bits per sample.
+// Images too large for 32 bit offsets are written as BigTIFF.
+func encodeTIFF(w io.Writer, img image.Image, description string) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	bitDepth := 8
+	if img.ColorModel() == color.NRGBA64Model {
+		bitDepth = 16
+	}
+	rowSize := width * 3 * bitDepth / 8
+	big := uint64(rowSize)*uint64(height) > maxClassicTIFF
+
+	// BigTIFF has 64 bit offsets and counts, and room for 8 bytes of inline values
+	offsetType := uint16(tiffLong)
+	headerSize, ifdEntrySize, inline := 8, 12, 4
+	if big {
+		offsetType = tiffLong8
+		headerSize, ifdEntrySize, inline = 16, 20, 8
+	}
+
+	tags := []tiffTag{
+		{tag: 256, typ: tiffLong, longs: []uint64{uint64(width)}},
+		{tag: 257, typ: tiffLong, longs: []uint64{uint64(height)}},
+		{tag: 258, typ: tiffShort, shorts: []uint16{uint16(bitDepth), uint16(bitDepth), uint16(bitDepth)}},
+		{tag: 259, typ: tiffShort, shorts: []uint16{1}}, // no compression
+		{tag: 262, typ: tiffShort, shorts: []uint16{2}}, // RGB
+		{tag: 270, typ: tiffASCII, ascii: description},
+		{tag: 273, typ: offsetType, longs: make([]uint64, height)},
+		{tag: 277, typ: tiffShort, shorts: []uint16{3}},
+		{tag: 278, typ: tiffLong, longs: []uint64{1}},
+		{tag: 279, typ: offsetType, longs: make([]uint64, height)},
+		{tag: 284, typ: tiffShort, shorts: []uint16{1}}, // chunky
+		{tag: 305, typ: tiffASCII, ascii: "glfractal"},
+	}
+
+	// values that don't fit inline go after the IFD, followed by the pixels
+	ifdSize := 2 + len(tags)*ifdEntrySize + 4
+	if big {
+		ifdSize = 8 + len(tags)*ifdEntrySize + 8
+	}
+	external := headerSize + ifdSize
+	for _, t := range tags {
+		if size := t.size(); size > inline {
+			external += size + size%2
+		}
+	}
+	for y := 0; y < height; y++ {
+		tags[6].longs[y] = uint64(external + y*rowSize)
+		tags[9].longs[y] = uint64(rowSize)
+	}
+
+	var b bytes.Buffer
+	le := func(v any) { binary.Write(&b, binary.LittleEndian, v) }
+	if big {
+		b.WriteString("II")
+		le(uint16(43))
+		le(uint16(8))
+		le(uint16(0))
+		le(uint64(headerSize))
+		le(uint64(len(tags)))
+	} else {
+		b.WriteString("II")
+		le(uint16(42))
+		le(uint32(headerSize))
+		le(uint16(len(tags)))
+	}
+
+	var values bytes.Buffer
+	valuesStart := headerSize + ifdSize
+	for _, t := range tags {
+		le(t.tag)
+		le(t.typ)
+		data := t.bytes()
+		if big {
+			le(uint64(t.count()))
+		} else {
+			le(uint32(t.count()))
+		}
+
+		if len(data) <= inline {
+			b.Write(data)
+			b.Write(make([]byte, inline-len(data)))
+		} else {
+			offset := uint64(valuesStart + values.Len())
+			if big {
+				le(offset)
+			} else {
+				le(uint32(offset))
+			}
+			values.Write(data)
+			if len(data)%2 == 1 {
+				values.WriteByte(0)
+			}
+		}
+	}
+	if big {
+		le(uint64(0))
+	} else {
+		le(uint32(0))
+	}
+	b.Write(values.Bytes())
+
+	if _, err := w.Write(b.Bytes()); err != nil {
+		return err
+	}
+
+	row := make([]byte, rowSize)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		i := 0
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if bitDepth == 16 {
+				c := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+				binary.LittleEndian.PutUint16(row[i:], c.R)
+				binary.LittleEndian.PutUint16(row[i+2:], c.G)
+				binary.LittleEndian.PutUint16(row[i+4:], c.B)
+				i += 6
+			} else {
+				c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+				row[i], row[i+1], row[i+2] = c.R, c.G, c.B
+				i += 3
+			}
+		}
+		if _, err := w.Write(row); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t tiffTag) count() int {
+	switch t.typ {
+	case tiffASCII:
+		return len(t.ascii) + 1
+	case tiffShort:
+		return len(t.shorts)
+	default:
+		return len(t.longs)
+	}
+}
+
+func (t tiffTag) size() int {
+	return len(t.bytes())
+}
+
+func (t tiffTag) bytes() []byte {
+	var b []byte
+	switch t.typ {
+	case tiffASCII:
+		b = append([]byte(t.ascii), 0)
+	case tiffShort:
+		for _, v := range t.shorts {
+			b = binary.LittleEndian.AppendUint16(b, v)
+		}
+	case tiffLong:
+		for _, v := range t.longs {
+			b = binary.LittleEndian.AppendUint32(b, uint32(v))
+		}
+	case tiffLong8:
+		for _, v := range t.longs {
+			b = binary.LittleEndian.AppendUint64(b, v)
+		}
+	}
+	return b
+}
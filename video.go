@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"os"
+
+	"github.com/stewi1014/glfractal/programs"
+)
+
+// VideoFormat is how an animation is saved.
+type VideoFormat int
+
+const (
+	VideoPNGFrames VideoFormat = iota
+	VideoY4M
+	VideoAVI
+	VideoGIF
+	VideoAPNG
+)
+
+var videoFormatNames = []string{"PNG Frames", "Y4M", "MJPEG AVI", "GIF", "APNG"}
+
+func (f VideoFormat) String() string { return videoFormatNames[f] }
+
+// Extension returns the file extension for the format, including the dot.
+// PNG frames are saved to a directory, so have no extension.
+func (f VideoFormat) Extension() string {
+	switch f {
+	case VideoY4M:
+		return ".y4m"
+	case VideoAVI:
+		return ".avi"
+	case VideoGIF:
+		return ".gif"
+	case VideoAPNG:
+		return ".png"
+	default:
+		return ""
+	}
+}
+
+// videoWriter writes an animation to a container one frame at a time.
+type videoWriter interface {
+	// WriteFrame writes img as the next frame, streaming its rows as they are rendered.
+	WriteFrame(ctx context.Context, img image.Image, uniforms programs.Uniforms) error
+
+	// Close finishes the container, without closing the underlying writer.
+	Close() error
+}
+
+// newVideoWriter starts a container of the given format.
+// Only AVI needs w to be seekable, to fill in its sizes when it's closed.
+func newVideoWriter(
+	format VideoFormat,
+	w io.WriteSeeker,
+	width, height int,
+	fps float64,
+	frames int,
+	opts SaveOptions,
+) (videoWriter, error) {
+	switch format {
+	case VideoY4M:
+		return newY4MWriter(w, width, height, fps)
+	case VideoAVI:
+		return newAVIWriter(w, width, height, fps, frames, opts.JPEGQuality)
+	case VideoGIF:
+		return newGIFWriter(w, width, height, fps)
+	case VideoAPNG:
+		return newAPNGWriter(w, width, height, fps, frames, opts.PNGCompression)
+	default:
+		return nil, fmt.Errorf("%v is not a video container", format)
+	}
+}
+
+// frameImage returns a frame of an animation as an 8 bit image.
+type frameImage func(ctx context.Context, program programs.Program, uniforms programs.Uniforms) (image.Image, error)
+
+// cpuFrameImage renders frames with the native implementation, as configured by opts.
+// The image is only rendered as it is read, except for density programs which count their orbits first.
+func cpuFrameImage(opts SaveOptions) frameImage {
+	return func(ctx context.Context, program programs.Program, uniforms programs.Uniforms) (image.Image, error) {
+		if program.Density != nil {
+			opts := opts
+			opts.BitDepth, opts.Multithread = 8, true
+			img, _, err := renderDensity(ctx, opts, program, uniforms, discardProgress{}, nil)
+			return img, err
+		}
+
+		img, err := program.GetImage(uniforms, opts.Width, opts.Height)
+		if err != nil {
+			return nil, err
+		}
+		if opts.ExpMap {
+			img = ExpMap(img)
+		}
+		return ToImage(Supersample(img, opts.Supersample), 8, opts.Dither), nil
+	}
+}
+
+// frameSource returns frame i of a sequence as an 8 bit image, with the uniforms that coloured it.
+type frameSource func(ctx context.Context, i int) (image.Image, programs.Uniforms, error)
+
+// animationFrames returns the frames of a, rendered by source.
+func animationFrames(a *Animation, source frameImage) frameSource {
+	return func(ctx context.Context, i int) (image.Image, programs.Uniforms, error) {
+		k := a.At(float64(i) / a.FPS)
+		program, ok := programs.ProgramByName(k.Program)
+		if !ok {
+			return nil, k.Uniforms, fmt.Errorf("no program named %q", k.Program)
+		}
+
+		img, err := source(ctx, program, k.Uniforms)
+		return img, k.Uniforms, err
+	}
+}
+
+// renderVideo renders frames from source into a container written to w.
+func renderVideo(
+	ctx context.Context,
+	w io.WriteSeeker,
+	format VideoFormat,
+	frames int,
+	fps float64,
+	source frameSource,
+	opts SaveOptions,
+	progress progressReporter,
+) error {
+	if frames <= 0 {
+		return fmt.Errorf("there are no frames to render")
+	}
+
+	done := addFrameProgress(ctx, progress, frames)
+
+	// the container is sized to the first frame, as odd sizes may be rounded down
+	var video videoWriter
+	var size image.Point
+
+	for i := 0; i < frames; i++ {
+		img, uniforms, err := source(ctx, i)
+		if err != nil {
+			return err
+		}
+
+		if video == nil {
+			size = img.Bounds().Size()
+			video, err = newVideoWriter(format, w, size.X, size.Y, fps, frames, opts)
+			if err != nil {
+				return err
+			}
+		} else if img.Bounds().Size() != size {
+			return fmt.Errorf("frame %v is %v, not %v", i, img.Bounds().Size(), size)
+		}
+
+		if err := video.WriteFrame(ctx, img, uniforms); err != nil {
+			return err
+		}
+		done()
+	}
+
+	return video.Close()
+}
+
+// renderVideoFile renders frames to a new file, removing it if rendering fails.
+func renderVideoFile(
+	ctx context.Context,
+	name string,
+	format VideoFormat,
+	frames int,
+	fps float64,
+	source frameSource,
+	opts SaveOptions,
+	progress progressReporter,
+) error {
+	return createFile(name, func(file *os.File) error {
+		return renderVideo(ctx, file, format, frames, fps, source, opts, progress)
+	})
+}
+
+// saveFrames saves frames from source as numbered PNGs in dir.
+func saveFrames(
+	ctx context.Context,
+	dir string,
+	frames int,
+	source frameSource,
+	opts SaveOptions,
+	progress progressReporter,
+) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	done := addFrameProgress(ctx, progress, frames)
+
+	for i := 0; i < frames; i++ {
+		img, _, err := source(ctx, i)
+		if err != nil {
+			return err
+		}
+
+		// rows are rendered concurrently before the single threaded encoder sees them
+		buff := image.NewNRGBA(img.Bounds())
+		y := buff.Rect.Min.Y
+		err = streamRows(ctx, img, func(pix []byte) error {
+			copy(buff.Pix[buff.PixOffset(buff.Rect.Min.X, y):], pix)
+			y++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		err = createFile(frameName(dir, i), func(file *os.File) error {
+			return encodePNG(file, buff, opts.PNGCompression, nil, nil)
+		})
+		if err != nil {
+			return err
+		}
+		done()
+	}
+
+	return nil
+}
+
+// streamRows calls row with the NRGBA pixels of each row of img in order,
+// rendering rows concurrently with renderRows.
+func streamRows(ctx context.Context, img image.Image, row func(pix []byte) error) error {
+	bounds := img.Bounds()
+
+	if nrgba, ok := img.(*image.NRGBA); ok {
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			i := nrgba.PixOffset(bounds.Min.X, y)
+			if err := row(nrgba.Pix[i : i+bounds.Dx()*4]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return renderRows(ctx, rowWriter(row), bounds.Dy(), bounds.Dx(), func(i int) []byte {
+		pix := make([]byte, 0, bounds.Dx()*4)
+		y := bounds.Min.Y + i
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			pix = append(pix, c.R, c.G, c.B, c.A)
+		}
+		return pix
+	}, discardProgress{}, "")
+}
+
+// rowWriter passes each write to a function.
+// renderRows writes each row in a single call, so each write is a whole row.
+type rowWriter func(pix []byte) error
+
+func (w rowWriter) Write(b []byte) (int, error) {
+	return len(b), w(b)
+}
+
+// frameRate returns fps as a fraction with the given denominator, reduced.
+func frameRate(fps float64, denominator int) (int, int) {
+	numerator := int(math.Round(fps * float64(denominator)))
+	a, b := numerator, denominator
+	for b != 0 {
+		a, b = b, a%b
+	}
+	if a == 0 {
+		return numerator, denominator
+	}
+	return numerator / a, denominator / a
+}
+
+// y4mWriter writes uncompressed 4:2:0 YUV4MPEG2, for piping to video encoders.
+//
+// Luma rows are written as they arrive, but chroma follows the whole luma plane
+// so is accumulated for the frame.
+type y4mWriter struct {
+	w             *bufio.Writer
+	width, height int
+	cb, cr        []float32
+}
+
+func newY4MWriter(w io.Writer, width, height int, fps float64) (*y4mWriter, error) {
+	y := &y4mWriter{
+		w:      bufio.NewWriter(w),
+		width:  width,
+		height: height,
+		cb:     make([]float32, ((width+1)/2)*((height+1)/2)),
+		cr:     make([]float32, ((width+1)/2)*((height+1)/2)),
+	}
+
+	numerator, denominator := frameRate(fps, 1000)
+	_, err := fmt.Fprintf(y.w, "YUV4MPEG2 W%v H%v F%v:%v Ip A1:1 C420jpeg\n", width, height, numerator, denominator)
+	return y, err
+}
+
+func (y *y4mWriter) WriteFrame(ctx context.Context, img image.Image, _ programs.Uniforms) error {
+	if _, err := y.w.WriteString("FRAME\n"); err != nil {
+		return err
+	}
+
+	clear(y.cb)
+	clear(y.cr)
+
+	chromaWidth := (y.width + 1) / 2
+	luma := make([]byte, y.width)
+	row := 0
+
+	err := streamRows(ctx, img, func(pix []byte) error {
+		for x := range luma {
+			// BT.601 studio range, as assumed by most encoders when y4m doesn't say
+			r, g, b := float32(pix[x*4])/255, float32(pix[x*4+1])/255, float32(pix[x*4+2])/255
+			luma[x] = uint8(16 + 65.481*r + 128.553*g + 24.966*b + .5)
+
+			i := row/2*chromaWidth + x/2
+			y.cb[i] += 128 - 37.797*r - 74.203*g + 112*b
+			y.cr[i] += 128 + 112*r - 93.786*g - 18.214*b
+		}
+		row++
+
+		_, err := y.w.Write(luma)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, plane := range [][]float32{y.cb, y.cr} {
+		for i, sum := range plane {
+			x, row := i%chromaWidth, i/chromaWidth
+			samples := float32(min(2, y.width-x*2) * min(2, y.height-row*2))
+			if err := y.w.WriteByte(uint8(sum/samples + .5)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (y *y4mWriter) Close() error {
+	return y.w.Flush()
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+)
+
+// maxWebPSize is the largest width or height a WebP image can have.
+const maxWebPSize = 1 << 14
+
+var ErrWebPTooLarge = errors.New("WebP images cannot be larger than 16384x16384")
+
+// encodeWebP writes img as a lossless WebP, with xmp as its XMP metadata if it isn't empty.
+//
+// The encoder uses no transforms, and only looks for backward references to the pixel to the left
+// and the pixel above, which suits the large flat areas in fractals.
+func encodeWebP(w io.Writer, img image.Image, xmp string) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > maxWebPSize || height > maxWebPSize {
+		return ErrWebPTooLarge
+	}
+
+	argb := make([]uint32, 0, width*height)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			argb = append(argb, uint32(c.A)<<24|uint32(c.R)<<16|uint32(c.G)<<8|uint32(c.B))
+		}
+	}
+
+	var bits bitWriter
+	bits.write(0x2f, 8)
+	bits.write(uint32(width-1), 14)
+	bits.write(uint32(height-1), 14)
+	bits.write(0, 1) // alpha is unused
+	bits.write(0, 3) // version
+	bits.write(0, 1) // no transforms
+	bits.write(0, 1) // no colour cache
+	bits.write(0, 1) // no meta prefix codes
+	writeVP8LImage(&bits, argb, width)
+	vp8l := bits.bytes()
+
+	var chunks bytes.Buffer
+	if xmp != "" {
+		vp8x := make([]byte, 10)
+		vp8x[0] = 1 << 2 // XMP present
+		putUint24(vp8x[4:], uint32(width-1))
+		putUint24(vp8x[7:], uint32(height-1))
+		writeRIFFChunk(&chunks, "VP8X", vp8x)
+	}
+	writeRIFFChunk(&chunks, "VP8L", vp8l)
+	if xmp != "" {
+		writeRIFFChunk(&chunks, "XMP ", []byte(xmp))
+	}
+
+	header := make([]byte, 12)
+	copy(header, "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(4+chunks.Len()))
+	copy(header[8:], "WEBP")
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(chunks.Bytes())
+	return err
+}
+
+func putUint24(b []byte, v uint32) {
+	b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+}
+
+func writeRIFFChunk(w *bytes.Buffer, fourCC string, data []byte) {
+	w.WriteString(fourCC)
+	binary.Write(w, binary.LittleEndian, uint32(len(data)))
+	w.Write(data)
+	if len(data)%2 == 1 {
+		w.WriteByte(0)
+	}
+}
+
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits uint
+}
+
+// write writes the low n bits of v, least significant first.
+func (b *bitWriter) write(v uint32, n uint) {
+	b.acc |= uint64(v&(1<<n-1)) << b.nbits
+	b.nbits += n
+	for b.nbits >= 8 {
+		b.buf = append(b.buf, byte(b.acc))
+		b.acc >>= 8
+		b.nbits -= 8
+	}
+}
+
+func (b *bitWriter) bytes() []byte {
+	if b.nbits > 0 {
+		b.buf = append(b.buf, byte(b.acc))
+		b.acc, b.nbits = 0, 0
+	}
+	return b.buf
+}
+
+const (
+	vp8lLengthCodes   = 24
+	vp8lDistanceCodes = 40
+	vp8lMaxLength     = 4096
+	// the distance codes for the pixel above and the pixel to the left
+	vp8lDistanceAbove = 1
+	vp8lDistanceLeft  = 2
+)
+
+// vp8lSymbol is either a literal pixel, or a backward reference when length is non-zero.
+type vp8lSymbol struct {
+	argb     uint32
+	length   int
+	distance int
+}
+
+// vp8lPrefix encodes v in the VP8L prefix coding used for lengths and distances.
+func vp8lPrefix(v int) (prefix int, extraBits uint, extra uint32) {
+	d := v - 1
+	if d < 4 {
+		return d, 0, 0
+	}
+	h := 0
+	for d>>(h+1) != 0 {
+		h++
+	}
+	second := (d >> (h - 1)) & 1
+	extraBits = uint(h - 1)
+	return 2*h + second, extraBits, uint32(d) & (1<<extraBits - 1)
+}
+
+func writeVP8LImage(bits *bitWriter, argb []uint32, width int) {
+	var symbols []vp8lSymbol
+	for i := 0; i < len(argb); {
+		best, distance := 0, 0
+		for _, candidate := range [...]struct{ offset, code int }{
+			{1, vp8lDistanceLeft},
+			{width, vp8lDistanceAbove},
+		} {
+			if i < candidate.offset {
+				continue
+			}
+			n := 0
+			for i+n < len(argb) && n < vp8lMaxLength && argb[i+n] == argb[i+n-candidate.offset] {
+				n++
+			}
+			if n > best {
+				best, distance = n, candidate.code
+			}
+		}
+
+		if best >= 3 {
+			symbols = append(symbols, vp8lSymbol{length: best, distance: distance})
+			i += best
+		} else {
+			symbols = append(symbols, vp8lSymbol{argb: argb[i]})
+			i++
+		}
+	}
+
+	green := make([]int, 256+vp8lLengthCodes)
+	red := make([]int, 256)
+	blue := make([]int, 256)
+	alpha := make([]int, 256)
+	distance := make([]int, vp8lDistanceCodes)
+	for _, s := range symbols {
+		if s.length > 0 {
+			prefix, _, _ := vp8lPrefix(s.length)
+			green[256+prefix]++
+			prefix, _, _ = vp8lPrefix(s.distance)
+			distance[prefix]++
+		} else {
+			green[s.argb>>8&0xff]++
+			red[s.argb>>16&0xff]++
+			blue[s.argb&0xff]++
+			alpha[s.argb>>24]++
+		}
+	}
+
+	codes := [5]prefixCode{}
+	for i, histogram := range [][]int{green, red, blue, alpha, distance} {
+		codes[i] = writePrefixCode(bits, histogram)
+	}
+
+	for _, s := range symbols {
+		if s.length > 0 {
+			prefix, extraBits, extra := vp8lPrefix(s.length)
+			codes[0].write(bits, 256+prefix)
+			bits.write(extra, extraBits)
+			prefix, extraBits, extra = vp8lPrefix(s.distance)
+			codes[4].write(bits, prefix)
+			bits.write(extra, extraBits)
+		} else {
+			codes[0].write(bits, int(s.argb>>8&0xff))
+			codes[1].write(bits, int(s.argb>>16&0xff))
+			codes[2].write(bits, int(s.argb&0xff))
+			codes[3].write(bits, int(s.argb>>24))
+		}
+	}
+}
+
+// prefixCode holds bit reversed canonical Huffman codes, ready to be written least significant bit first.
+type prefixCode struct {
+	lengths []uint8
+	codes   []uint32
+}
+
+func (c prefixCode) write(bits *bitWriter, symbol int) {
+	bits.write(c.codes[symbol], uint(c.lengths[symbol]))
+}
+
+var codeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// writePrefixCode writes a prefix code for the histogram, returning the code.
+func writePrefixCode(bits *bitWriter, histogram []int) prefixCode {
+	var used []int
+	for symbol, count := range histogram {
+		if count > 0 {
+			used = append(used, symbol)
+		}
+	}
+
+	// a single symbol, or none at all, takes no bits to write
+	if len(used) == 0 || len(used) == 1 && used[0] < 256 {
+		symbol := 0
+		if len(used) == 1 {
+			symbol = used[0]
+		}
+		bits.write(1, 1) // simple code
+		bits.write(0, 1) // one symbol
+		if symbol < 2 {
+			bits.write(0, 1)
+			bits.write(uint32(symbol), 1)
+		} else {
+			bits.write(1, 1)
+			bits.write(uint32(symbol), 8)
+		}
+		return prefixCode{
+			lengths: make([]uint8, len(histogram)),
+			codes:   make([]uint32, len(histogram)),
+		}
+	}
+
+	lengths := huffmanLengths(histogram, 15)
+
+	// code lengths are themselves run length encoded and written with a prefix code
+	type token struct {
+		symbol    int
+		extra     uint32
+		extraBits uint
+	}
+	var tokens []token
+	for i := 0; i < len(lengths); {
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == lengths[i] {
+			run++
+		}
+
+		switch {
+		case lengths[i] == 0 && run >= 11:
+			run = min(run, 138)
+			tokens = append(tokens, token{18, uint32(run - 11), 7})
+		case lengths[i] == 0 && run >= 3:
+			tokens = append(tokens, token{17, uint32(run - 3), 3})
+		default:
+			run = 1
+			tokens = append(tokens, token{int(lengths[i]), 0, 0})
+		}
+		i += run
+	}
+
+	lengthHistogram := make([]int, 19)
+	for _, t := range tokens {
+		lengthHistogram[t.symbol]++
+	}
+	lengthCode := canonicalCode(huffmanLengths(lengthHistogram, 7))
+
+	numCodes := 19
+	for numCodes > 4 && lengthCode.lengths[codeLengthOrder[numCodes-1]] == 0 {
+		numCodes--
+	}
+
+	bits.write(0, 1) // normal code
+	bits.write(uint32(numCodes-4), 4)
+	for _, symbol := range codeLengthOrder[:numCodes] {
+		bits.write(uint32(lengthCode.lengths[symbol]), 3)
+	}
+	bits.write(0, 1) // code lengths for every symbol follow
+
+	for _, t := range tokens {
+		lengthCode.write(bits, t.symbol)
+		bits.write(t.extra, t.extraBits)
+	}
+
+	return canonicalCode(lengths)
+}
+
+// canonicalCode assigns canonical Huffman codes to lengths.
+func canonicalCode(lengths []uint8) prefixCode {
+	code := prefixCode{
+		lengths: lengths,
+		codes:   make([]uint32, len(lengths)),
+	}
+
+	next := uint32(0)
+	for length := uint8(1); length <= 15; length++ {
+		for symbol, l := range lengths {
+			if l != length {
+				continue
+			}
+			// reverse the code so the most significant bit is written first
+			reversed := uint32(0)
+			for i := uint8(0); i < length; i++ {
+				reversed |= (next >> i & 1) << (length - 1 - i)
+			}
+			code.codes[symbol] = reversed
+			next++
+		}
+		next <<= 1
+	}
+
+	return code
+}
+
+type huffmanNode struct {
+	count  int
+	symbol int
+	left   *huffmanNode
+	right  *huffmanNode
+}
+
+type huffmanHeap []*huffmanNode
+
+func (h huffmanHeap) Len() int { return len(h) }
+func (h huffmanHeap) Less(i, j int) bool {
+	if h[i].count == h[j].count {
+		return h[i].symbol < h[j].symbol
+	}
+	return h[i].count < h[j].count
+}
+func (h huffmanHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *huffmanHeap) Push(x any)   { *h = append(*h, x.(*huffmanNode)) }
+func (h *huffmanHeap) Pop() any {
+	old := *h
+	n := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return n
+}
+
+// huffmanLengths returns Huffman code lengths for the histogram no longer than maxLength.
+//
+// Lengths are limited by flattening the histogram until the tree is shallow enough.
+// At least two symbols are always given a length, so the code is complete.
+func huffmanLengths(histogram []int, maxLength uint8) []uint8 {
+	lengths := make([]uint8, len(histogram))
+
+	for minCount := 1; ; minCount *= 2 {
+		var h huffmanHeap
+		for symbol, count := range histogram {
+			if count > 0 {
+				h = append(h, &huffmanNode{count: max(count, minCount), symbol: symbol})
+			}
+		}
+		for symbol := 0; len(h) < 2; symbol++ {
+			if histogram[symbol] == 0 {
+				h = append(h, &huffmanNode{count: minCount, symbol: symbol})
+			}
+		}
+		heap.Init(&h)
+
+		for next := len(histogram); h.Len() > 1; next++ {
+			a := heap.Pop(&h).(*huffmanNode)
+			b := heap.Pop(&h).(*huffmanNode)
+			heap.Push(&h, &huffmanNode{count: a.count + b.count, symbol: next, left: a, right: b})
+		}
+
+		for i := range lengths {
+			lengths[i] = 0
+		}
+		deepest := uint8(0)
+		var walk func(n *huffmanNode, depth uint8)
+		walk = func(n *huffmanNode, depth uint8) {
+			if n.left == nil {
+				lengths[n.symbol] = depth
+				deepest = max(deepest, depth)
+				return
+			}
+			walk(n.left, depth+1)
+			walk(n.right, depth+1)
+		}
+		walk(h[0], 0)
+
+		if deepest <= maxLength {
+			return lengths
+		}
+	}
+}
@@ -0,0 +1,542 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/stewi1014/glfractal/programs"
+)
+
+var frameRendererNames = []string{"Native", "OpenGL"}
+
+func (w *ConfigWindow) openAnimation() {
+	if w.animationWindow != nil {
+		w.animationWindow.Present()
+		return
+	}
+
+	if w.animation == nil {
+		w.animation = NewAnimation()
+	}
+
+	var err error
+	w.animationWindow, err = NewAnimationWindow(w)
+	if err != nil {
+		NewErrorDialog(w, err, 0)
+		return
+	}
+	w.animationWindow.Connect("destroy", func() {
+		w.animationWindow = nil
+	})
+}
+
+// gpuFrameImage renders frames with the render window's shaders, at the size set in opts.
+func (w *ConfigWindow) gpuFrameImage(opts SaveOptions) frameImage {
+	return func(ctx context.Context, program programs.Program, uniforms programs.Uniforms) (image.Image, error) {
+		if opts.ExpMap {
+			var err error
+			program, err = expMapProgram(program, opts.Width, opts.Height)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		frame, err := w.requestFrame(ctx, FrameRequest{
+			Width:    opts.Width,
+			Height:   opts.Height,
+			Program:  program,
+			Uniforms: uniforms,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return &image.NRGBA{
+			Pix:    frame.Pix,
+			Stride: frame.Width * 4,
+			Rect:   image.Rect(0, 0, frame.Width, frame.Height),
+		}, nil
+	}
+}
+
+// gpuFrameRenderer renders PNG frames with the render window's shaders.
+func (w *ConfigWindow) gpuFrameRenderer(opts SaveOptions) frameRenderer {
+	frame := w.gpuFrameImage(opts)
+	return func(ctx context.Context, out io.Writer, program programs.Program, uniforms programs.Uniforms) error {
+		img, err := frame(ctx, program, uniforms)
+		if err != nil {
+			return err
+		}
+		return encodePNG(out, img, opts.PNGCompression, renderParameters(program, uniforms), nil)
+	}
+}
+
+func NewAnimationWindow(config *ConfigWindow) (*AnimationWindow, error) {
+	var err error
+	w := &AnimationWindow{
+		config:    config,
+		animation: config.animation,
+	}
+
+	w.ApplicationWindow, err = gtk.ApplicationWindowNew(config.app)
+	if err != nil {
+		return nil, fmt.Errorf("gtk.ApplicationWindowNew: %w", err)
+	}
+	w.SetTitle("GLFractal Animation")
+	w.SetIcon(iconPixbuf)
+	w.Connect("destroy", func() {
+		w.stop()
+	})
+
+	g, _ := gtk.GridNew()
+	g.SetRowSpacing(10)
+	g.SetColumnSpacing(10)
+	g.SetHExpand(true)
+	y := 0
+
+	label, _ := gtk.LabelNew("Keyframes")
+	addButton, _ := gtk.ButtonNewWithLabel("Add Keyframe")
+	addButton.SetTooltipText("Add the current view two seconds after the last keyframe")
+	addButton.Connect("clicked", func() {
+		t := 0.
+		if len(w.animation.Keyframes) > 0 {
+			t = w.animation.Duration() + 2
+		}
+		w.animation.Add(w.snapshot(t))
+		w.refresh()
+	})
+	loadButton, _ := gtk.ButtonNewWithLabel("Load")
+	loadButton.Connect("clicked", w.load)
+	saveButton, _ := gtk.ButtonNewWithLabel("Save")
+	saveButton.Connect("clicked", w.save)
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(addButton, 1, y, 1, 1)
+	g.Attach(loadButton, 2, y, 1, 1)
+	g.Attach(saveButton, 3, y, 1, 1)
+	y++
+
+	w.list, _ = gtk.ListBoxNew()
+	w.list.SetSelectionMode(gtk.SELECTION_NONE)
+	scroll, _ := gtk.ScrolledWindowNew(nil, nil)
+	scroll.SetPolicy(gtk.POLICY_NEVER, gtk.POLICY_AUTOMATIC)
+	scroll.SetMinContentHeight(200)
+	scroll.SetVExpand(true)
+	scroll.Add(w.list)
+	g.Attach(scroll, 0, y, 4, 1)
+	y++
+
+	label, _ = gtk.LabelNew("Preview")
+	w.scrubber, _ = gtk.ScaleNewWithRange(gtk.ORIENTATION_HORIZONTAL, 0, 1, 0.01)
+	w.scrubber.SetSizeRequest(400, 20)
+	w.scrubber.Connect("value-changed", func(s *gtk.Scale) {
+		if len(w.animation.Keyframes) > 0 {
+			w.config.show(w.animation.At(s.GetValue()))
+		}
+	})
+	w.play, _ = gtk.ToggleButtonNewWithLabel("Play")
+	w.play.Connect("toggled", func(b *gtk.ToggleButton) {
+		if b.GetActive() {
+			w.start()
+		} else {
+			w.stop()
+		}
+	})
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(w.scrubber, 1, y, 2, 1)
+	g.Attach(w.play, 3, y, 1, 1)
+	y++
+
+	label, _ = gtk.LabelNew("Frame Rate")
+	fps, _ := gtk.SpinButtonNewWithRange(1, 240, 1)
+	fps.SetValue(w.animation.FPS)
+	fps.Connect("value-changed", func(b *gtk.SpinButton) {
+		w.animation.FPS = b.GetValue()
+		w.refresh()
+	})
+	w.duration, _ = gtk.LabelNew("")
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(fps, 1, y, 1, 1)
+	g.Attach(w.duration, 2, y, 2, 1)
+	y++
+
+	seperator, _ := gtk.SeparatorNew(gtk.ORIENTATION_HORIZONTAL)
+	g.Attach(seperator, 0, y, 4, 1)
+	y++
+
+	w.curves = make(map[string]*gtk.ComboBoxText)
+	for i, name := range animatedParameters {
+		label, _ := gtk.LabelNew(name)
+		curve, _ := gtk.ComboBoxTextNew()
+		for _, curveName := range curveNames {
+			curve.AppendText(curveName)
+		}
+		curve.SetActive(int(w.animation.curve(name)))
+		curve.Connect("changed", func(c *gtk.ComboBoxText) {
+			w.animation.Curves[name] = Curve(c.GetActive())
+			w.preview()
+		})
+		w.curves[name] = curve
+
+		col := i % 2 * 2
+		g.Attach(label, col, y, 1, 1)
+		g.Attach(curve, col+1, y, 1, 1)
+		if col > 0 {
+			y++
+		}
+	}
+	if len(animatedParameters)%2 == 1 {
+		y++
+	}
+
+	seperator, _ = gtk.SeparatorNew(gtk.ORIENTATION_HORIZONTAL)
+	g.Attach(seperator, 0, y, 4, 1)
+	y++
+
+	label, _ = gtk.LabelNew("Render Frames")
+	renderer, _ := gtk.ComboBoxTextNew()
+	for _, name := range frameRendererNames {
+		renderer.AppendText(name)
+	}
+	renderer.SetActive(0)
+	renderer.SetTooltipText("Native rendering uses the image render settings, OpenGL only the size and PNG compression")
+	output, _ := gtk.ComboBoxTextNew()
+	for _, name := range videoFormatNames {
+		output.AppendText(name)
+	}
+	output.SetActive(int(VideoPNGFrames))
+	output.SetTooltipText("GIF uses the fractal's colours as its palette, so looks best without supersampling")
+	renderButton, _ := gtk.ButtonNewWithLabel("Render")
+	renderButton.Connect("clicked", func() {
+		w.render(renderer.GetActive() == 1, VideoFormat(output.GetActive()))
+	})
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(renderer, 1, y, 1, 1)
+	g.Attach(output, 2, y, 1, 1)
+	g.Attach(renderButton, 3, y, 1, 1)
+	y++
+
+	label, _ = gtk.LabelNew("Zoom From Strip")
+	decadeSeconds, _ := gtk.SpinButtonNewWithRange(0.1, 60, 0.1)
+	decadeSeconds.SetDigits(1)
+	decadeSeconds.SetValue(2)
+	decadeSeconds.SetTooltipText("Seconds to zoom in by each factor of ten")
+	stripButton, _ := gtk.ButtonNewWithLabel("Render")
+	stripButton.SetTooltipText("Rebuild frames zooming into the centre of an exponential map, at the frame rate, image size and output above")
+	stripButton.Connect("clicked", func() {
+		w.renderStrip(decadeSeconds.GetValue(), VideoFormat(output.GetActive()))
+	})
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(decadeSeconds, 1, y, 1, 1)
+	g.Attach(stripButton, 3, y, 1, 1)
+	y++
+
+	w.Add(g)
+	w.refresh()
+	w.ShowAll()
+	return w, nil
+}
+
+// AnimationWindow edits the config window's keyframes, previewing them in the render window.
+type AnimationWindow struct {
+	*gtk.ApplicationWindow
+	config    *ConfigWindow
+	animation *Animation
+
+	list     *gtk.ListBox
+	scrubber *gtk.Scale
+	play     *gtk.ToggleButton
+	duration *gtk.Label
+	curves   map[string]*gtk.ComboBoxText
+
+	playing glib.SourceHandle
+}
+
+// snapshot returns the config window's current view as a keyframe at time t.
+func (w *AnimationWindow) snapshot(t float64) Keyframe {
+	return Keyframe{
+		Time:     t,
+		Program:  w.config.program.Name,
+		Uniforms: w.config.uniforms,
+	}
+}
+
+// refresh rebuilds the keyframe list and timeline after the animation changes.
+func (w *AnimationWindow) refresh() {
+	w.list.GetChildren().Foreach(func(item interface{}) {
+		if widget, ok := item.(*gtk.Widget); ok {
+			widget.Destroy()
+		}
+	})
+
+	for i, k := range w.animation.Keyframes {
+		row, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 10)
+
+		at, _ := gtk.SpinButtonNewWithRange(0, 3600, 0.1)
+		at.SetDigits(2)
+		at.SetValue(k.Time)
+		at.Connect("value-changed", func(b *gtk.SpinButton) {
+			i = w.animation.SetTime(i, b.GetValue())
+			// rebuilding destroys the spin button while its signal is being handled
+			glib.IdleAdd(w.refresh)
+		})
+
+		label, _ := gtk.LabelNew(fmt.Sprintf("%v, zoom %.3g", k.Program, k.Uniforms.Zoom))
+		label.SetHExpand(true)
+		label.SetXAlign(0)
+
+		goTo, _ := gtk.ButtonNewWithLabel("Show")
+		goTo.Connect("clicked", func() {
+			w.scrubber.SetValue(w.animation.Keyframes[i].Time)
+			w.preview()
+		})
+
+		update, _ := gtk.ButtonNewWithLabel("Update")
+		update.SetTooltipText("Replace this keyframe with the current view")
+		update.Connect("clicked", func() {
+			w.animation.Keyframes[i] = w.snapshot(w.animation.Keyframes[i].Time)
+			w.refresh()
+		})
+
+		remove, _ := gtk.ButtonNewWithLabel("Remove")
+		remove.Connect("clicked", func() {
+			w.animation.Remove(i)
+			w.refresh()
+		})
+
+		row.Add(at)
+		row.Add(label)
+		row.Add(goTo)
+		row.Add(update)
+		row.Add(remove)
+		w.list.Insert(row, -1)
+	}
+	w.list.ShowAll()
+
+	duration := w.animation.Duration()
+	w.scrubber.ClearMarks()
+	w.scrubber.SetRange(0, max(duration, 0.01))
+	for _, k := range w.animation.Keyframes {
+		w.scrubber.AddMark(k.Time, gtk.POS_BOTTOM, "")
+	}
+
+	w.duration.SetText(fmt.Sprintf("%.2fs, %v frames", duration, w.animation.Frames()))
+}
+
+// preview shows the animation at the scrubber's position.
+func (w *AnimationWindow) preview() {
+	if len(w.animation.Keyframes) > 0 {
+		w.config.show(w.animation.At(w.scrubber.GetValue()))
+	}
+}
+
+// start plays the animation in real time from the scrubber's position.
+func (w *AnimationWindow) start() {
+	w.stop()
+
+	from := w.scrubber.GetValue()
+	if from >= w.animation.Duration() {
+		from = 0
+	}
+	start := time.Now()
+
+	w.playing = glib.TimeoutAdd(uint(1000/w.animation.FPS), func() bool {
+		t := from + time.Since(start).Seconds()
+		if t >= w.animation.Duration() {
+			t = w.animation.Duration()
+			w.playing = 0
+			w.play.SetActive(false)
+		}
+
+		w.scrubber.SetValue(t)
+		return w.playing != 0
+	})
+}
+
+func (w *AnimationWindow) stop() {
+	if w.playing != 0 {
+		glib.SourceRemove(w.playing)
+		w.playing = 0
+	}
+}
+
+// chooseFile asks for a file name, returning false if the user cancels.
+func chooseFile(parent gtk.IWindow, title string, action gtk.FileChooserAction, name string) (string, bool) {
+	accept := "Open"
+	if action != gtk.FILE_CHOOSER_ACTION_OPEN {
+		accept = "Save"
+	}
+
+	dialog, err := gtk.FileChooserNativeDialogNew(title, parent, action, accept, "Cancel")
+	if err != nil {
+		log.Println(err)
+		return "", false
+	}
+	defer dialog.Destroy()
+
+	if action == gtk.FILE_CHOOSER_ACTION_SAVE {
+		dialog.SetDoOverwriteConfirmation(true)
+		dialog.SetCurrentName(name)
+	}
+
+	if dialog.Run() != int(gtk.RESPONSE_ACCEPT) {
+		return "", false
+	}
+	return dialog.GetFilename(), true
+}
+
+func (w *AnimationWindow) load() {
+	name, ok := chooseFile(w, "Load Animation", gtk.FILE_CHOOSER_ACTION_OPEN, "")
+	if !ok {
+		return
+	}
+
+	animation, err := LoadAnimation(name)
+	if err != nil {
+		NewErrorDialog(w, err, 0)
+		return
+	}
+
+	*w.animation = *animation
+	for _, name := range animatedParameters {
+		w.curves[name].SetActive(int(w.animation.curve(name)))
+	}
+	w.refresh()
+	w.preview()
+}
+
+func (w *AnimationWindow) save() {
+	name, ok := chooseFile(w, "Save Animation", gtk.FILE_CHOOSER_ACTION_SAVE, "animation.json")
+	if !ok {
+		return
+	}
+
+	if err := w.animation.Save(name); err != nil {
+		NewErrorDialog(w, err, 0)
+	}
+}
+
+// chooseOutput asks for a directory for PNG frames, or a file for any other format.
+func (w *AnimationWindow) chooseOutput(format VideoFormat, name string) (string, bool) {
+	if format == VideoPNGFrames {
+		return chooseFile(w, "Render Frames", gtk.FILE_CHOOSER_ACTION_SELECT_FOLDER, "")
+	}
+	return chooseFile(w, "Render Video", gtk.FILE_CHOOSER_ACTION_SAVE, name+format.Extension())
+}
+
+// render renders every frame into a chosen directory or video file,
+// using the render window's shaders if gpu is set.
+func (w *AnimationWindow) render(gpu bool, format VideoFormat) {
+	name, ok := w.chooseOutput(format, "animation")
+	if !ok {
+		return
+	}
+
+	opts := w.config.saveOpts
+
+	// the animation can be edited while rendering
+	animation := *w.animation
+	animation.Keyframes = slices.Clone(w.animation.Keyframes)
+	animation.Curves = maps.Clone(w.animation.Curves)
+
+	w.renderInBackground(name, func(ctx context.Context, progress progressReporter) (int, error) {
+		if format == VideoPNGFrames {
+			render := cpuFrameRenderer(opts)
+			if gpu {
+				render = w.config.gpuFrameRenderer(opts)
+			}
+			return animation.Frames(), renderFrames(ctx, name, &animation, render, progress)
+		}
+
+		source := cpuFrameImage(opts)
+		if gpu {
+			source = w.config.gpuFrameImage(opts)
+		}
+		frames := animation.Frames()
+		return frames, renderVideoFile(ctx, name, format, frames, animation.FPS, animationFrames(&animation, source), opts, progress)
+	})
+}
+
+// renderStrip rebuilds frames zooming into a chosen exponential map strip,
+// taking decadeSeconds to zoom in by each factor of ten.
+func (w *AnimationWindow) renderStrip(decadeSeconds float64, format VideoFormat) {
+	stripName, ok := chooseFile(w, "Open Exponential Map", gtk.FILE_CHOOSER_ACTION_OPEN, "")
+	if !ok {
+		return
+	}
+
+	name, ok := w.chooseOutput(format, "zoom")
+	if !ok {
+		return
+	}
+
+	opts := w.config.saveOpts
+	uniforms := w.config.uniforms
+	fps := w.animation.FPS
+
+	w.renderInBackground(name, func(ctx context.Context, progress progressReporter) (int, error) {
+		strip, err := LoadStrip(stripName)
+		if err != nil {
+			return 0, err
+		}
+
+		frames, source := stripFrames(strip, uniforms, opts, fps, decadeSeconds)
+		if format == VideoPNGFrames {
+			return frames, saveFrames(ctx, name, frames, source, opts, progress)
+		}
+		return frames, renderVideoFile(ctx, name, format, frames, fps, source, opts, progress)
+	})
+}
+
+// renderInBackground runs render with a progress dialog,
+// telling the user how many frames it rendered to name when it finishes.
+func (w *AnimationWindow) renderInBackground(name string, render func(ctx context.Context, progress progressReporter) (int, error)) {
+	ctx, cancel := WithErrorDialogCancelCause(w, w.config.ctx)
+	defer CatchPanicToContext(cancel)
+
+	progress, err := NewProgressBarDialog(
+		ctx, w, "Render Frames",
+		fmt.Sprintf("Rendering to %v", name),
+		func() { cancel(context.Canceled) },
+	)
+	if err != nil {
+		cancel(err)
+		return
+	}
+
+	go func() {
+		defer CatchPanicToContext(cancel)
+
+		start := time.Now()
+		frames, err := render(ctx, progress)
+		if err != nil {
+			cancel(err)
+			return
+		}
+
+		log.Printf("rendered %v frames to %v in %v", frames, name, time.Since(start))
+		cancel(context.Canceled)
+
+		glib.IdleAdd(func() {
+			dialog := gtk.MessageDialogNew(
+				w,
+				gtk.DIALOG_DESTROY_WITH_PARENT,
+				gtk.MESSAGE_INFO,
+				gtk.BUTTONS_CLOSE,
+				"Rendered %v frames to %v",
+				frames,
+				name,
+			)
+			dialog.SetIcon(iconPixbuf)
+			dialog.Connect("response", dialog.Destroy)
+			dialog.Show()
+		})
+	}()
+}
@@ -3,13 +3,16 @@ package main
 import (
 	"context"
 	"encoding/gob"
+	"errors"
 	"fmt"
+	"image"
 	"log"
 	"math/rand"
 	"net"
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-gl/mathgl/mgl32"
@@ -168,13 +171,37 @@ func NewConfigWindow(
 
 	label, _ := gtk.LabelNew("Program")
 	programMenu, _ := gtk.ComboBoxTextNew()
+	w.programMenu = programMenu
 	for i := 0; i < programs.NumPrograms(); i++ {
 		programMenu.AppendText(programs.GetProgram(i).Name)
 	}
+	programMenu.AppendText("Hybrid")
+	w.hybrid, _ = defaultHybrid.Program()
 	w.program = programs.GetProgram(0)
 	programMenu.SetActive(0)
 	programMenu.Connect("changed", func(c *gtk.ComboBoxText) {
-		w.program = programs.GetProgram(c.GetActive())
+		previous := w.program
+		if i := c.GetActive(); i < programs.NumPrograms() {
+			w.program = programs.GetProgram(i)
+		} else {
+			w.program = w.hybrid
+		}
+
+		// keep a changed bailout and sliders unless the new program uses them differently
+		if b := w.program.DefaultBailout(); b != previous.DefaultBailout() {
+			w.uniforms.SetBailout(b)
+			w.showBailout()
+		}
+		for i := range w.uniforms.Sliders {
+			if s := w.program.Slider(i); s != previous.Slider(i) {
+				w.uniforms.Sliders[i] = s.Default
+			}
+		}
+		w.showSliders()
+		if w.program.Is3D() && w.program.Camera3D != previous.Camera3D {
+			w.uniforms.SetCamera3D(w.program.Camera3D)
+			w.showCamera()
+		}
 		w.sendMessage <- w.program
 		w.sendMessage <- w.uniforms
 	})
@@ -183,6 +210,351 @@ func NewConfigWindow(
 	g.Attach(programMenu, 1, y, 3, 1)
 	y++
 
+	hybridButton, _ := gtk.ButtonNewWithLabel("Edit Sequence")
+	hybridButton.SetTooltipText("Build a hybrid fractal that alternates between formulas each iteration")
+	hybridButton.Connect("clicked", w.openHybrid)
+	label, _ = gtk.LabelNew("Hybrid")
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(hybridButton, 1, y, 1, 1)
+	y++
+
+	juliaX, _ := gtk.SpinButtonNewWithRange(-4, 4, 0.001)
+	juliaX.SetDigits(8)
+	juliaX.SetValue(-1)
+	juliaX.Connect("value-changed", func(b *gtk.SpinButton) {
+		w.uniforms.JuliaC[0] = b.GetValue()
+		w.sendMessage <- w.uniforms
+	})
+	juliaY, _ := gtk.SpinButtonNewWithRange(-4, 4, 0.001)
+	juliaY.SetDigits(8)
+	juliaY.SetValue(0)
+	juliaY.Connect("value-changed", func(b *gtk.SpinButton) {
+		w.uniforms.JuliaC[1] = b.GetValue()
+		w.sendMessage <- w.uniforms
+	})
+	juliaSwitch, _ := gtk.ButtonNewWithLabel("Switch Space")
+	juliaSwitch.SetTooltipText("Switch between parameter space and Julia space, using the centre of the view as c")
+	juliaSwitch.SetSensitive(w.program.Family != "")
+	programMenu.Connect("changed", func() {
+		juliaSwitch.SetSensitive(w.program.Family != "")
+	})
+	juliaSwitch.Connect("clicked", func() {
+		other, ok := w.program.Counterpart()
+		if !ok {
+			return
+		}
+
+		if other.Julia {
+			c := w.uniforms.Pos.Mul(-1)
+			w.uniforms.Zoom, w.uniforms.Pos, w.uniforms.JuliaC = 2, mgl64.Vec2{}, c
+			juliaX.SetValue(c[0])
+			juliaY.SetValue(c[1])
+		} else {
+			w.uniforms.Zoom, w.uniforms.Pos = 2, w.uniforms.JuliaC.Mul(-1)
+		}
+
+		w.selectProgram(other)
+	})
+	label, _ = gtk.LabelNew("Julia C")
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(juliaX, 1, y, 1, 1)
+	g.Attach(juliaY, 2, y, 1, 1)
+	g.Attach(juliaSwitch, 3, y, 1, 1)
+	y++
+
+	w.rootIndex, _ = gtk.SpinButtonNewWithRange(1, 3, 1)
+	w.rootIndex.SetTooltipText("The root to edit")
+	w.rootIndex.Connect("value-changed", w.showRoot)
+	w.rootCount, _ = gtk.SpinButtonNewWithRange(1, programs.MaxRoots, 1)
+	w.rootCount.SetTooltipText("Degree of the polynomial Newton's method solves. Roots can be dragged in the render window")
+	w.rootCount.SetValue(3)
+	w.rootCount.Connect("value-changed", func(b *gtk.SpinButton) {
+		if w.showingUniforms {
+			return
+		}
+		w.uniforms.RootCount = uint32(b.GetValueAsInt())
+		w.rootIndex.SetRange(1, b.GetValue())
+		w.sendMessage <- w.uniforms
+	})
+	label, _ = gtk.LabelNew("Polynomial Roots")
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(w.rootCount, 1, y, 1, 1)
+	g.Attach(w.rootIndex, 2, y, 1, 1)
+	y++
+
+	setRoot := func(axis int) func(*gtk.SpinButton) {
+		return func(b *gtk.SpinButton) {
+			if w.showingUniforms {
+				return
+			}
+			w.uniforms.Roots[w.rootIndex.GetValueAsInt()-1][axis] = b.GetValue()
+			w.sendMessage <- w.uniforms
+		}
+	}
+	w.rootX, _ = gtk.SpinButtonNewWithRange(-4, 4, 0.001)
+	w.rootX.SetDigits(8)
+	w.rootX.SetValue(1)
+	w.rootX.Connect("value-changed", setRoot(0))
+	w.rootY, _ = gtk.SpinButtonNewWithRange(-4, 4, 0.001)
+	w.rootY.SetDigits(8)
+	w.rootY.Connect("value-changed", setRoot(1))
+	label, _ = gtk.LabelNew("Root")
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(w.rootX, 1, y, 1, 1)
+	g.Attach(w.rootY, 2, y, 1, 1)
+	y++
+
+	w.bailoutTest, _ = gtk.ComboBoxTextNew()
+	for _, name := range programs.BailoutTestNames {
+		w.bailoutTest.AppendText(name)
+	}
+	w.bailoutTest.SetActive(int(w.program.DefaultBailout().Test))
+	w.bailoutTest.SetTooltipText("What is compared to the bailout radius. Exponential maps escape to the right, and trigonometric maps up and down")
+	w.bailoutTest.Connect("changed", func(c *gtk.ComboBoxText) {
+		if w.showingUniforms {
+			return
+		}
+		w.uniforms.BailoutTest = programs.BailoutTest(c.GetActive())
+		w.sendMessage <- w.uniforms
+	})
+	w.bailout, _ = gtk.SpinButtonNewWithRange(0.01, 1e6, 0.1)
+	w.bailout.SetDigits(2)
+	w.bailout.SetValue(w.program.DefaultBailout().Radius)
+	w.bailout.SetTooltipText("Points past this have escaped")
+	w.bailout.Connect("value-changed", func(b *gtk.SpinButton) {
+		if w.showingUniforms {
+			return
+		}
+		w.uniforms.Bailout = b.GetValue()
+		w.sendMessage <- w.uniforms
+	})
+	bailoutReset, _ := gtk.ButtonNewWithLabel("Reset Bailout")
+	bailoutReset.Connect("clicked", func() {
+		w.uniforms.SetBailout(w.program.DefaultBailout())
+		w.showBailout()
+		w.sendMessage <- w.uniforms
+	})
+	label, _ = gtk.LabelNew("Bailout")
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(w.bailoutTest, 1, y, 1, 1)
+	g.Attach(w.bailout, 2, y, 1, 1)
+	g.Attach(bailoutReset, 3, y, 1, 1)
+	y++
+
+	cameraMode, _ := gtk.ComboBoxTextNew()
+	for _, name := range cameraModeNames {
+		cameraMode.AppendText(name)
+	}
+	cameraMode.SetActive(int(w.cameraMode))
+	cameraMode.SetTooltipText("Orbit around the centre of the view, or fly and look around when dragging the render window. W, A, S, D, Q and E move the camera")
+	cameraMode.Connect("changed", func(c *gtk.ComboBoxText) {
+		w.cameraMode = CameraMode(c.GetActive())
+		w.sendMessage <- CameraControl{Mode: w.cameraMode}
+	})
+	cameraReset, _ := gtk.ButtonNewWithLabel("Reset Camera")
+	cameraReset.Connect("clicked", func() {
+		w.uniforms.SetCamera3D(w.program.Camera3D)
+		w.showCamera()
+		w.sendMessage <- w.uniforms
+	})
+	label, _ = gtk.LabelNew("3D Camera")
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(cameraMode, 1, y, 1, 1)
+	g.Attach(cameraReset, 3, y, 1, 1)
+	y++
+
+	setCameraPos := func(axis int) func(*gtk.SpinButton) {
+		return func(b *gtk.SpinButton) {
+			if w.showingUniforms {
+				return
+			}
+			w.uniforms.CameraPos[axis] = b.GetValue()
+			w.sendMessage <- w.uniforms
+		}
+	}
+	for axis := range w.cameraPos {
+		w.cameraPos[axis], _ = gtk.SpinButtonNewWithRange(-100, 100, 0.01)
+		w.cameraPos[axis].SetDigits(6)
+		w.cameraPos[axis].Connect("value-changed", setCameraPos(axis))
+	}
+	w.cameraPos[0].SetTooltipText("X")
+	w.cameraPos[1].SetTooltipText("Y, up")
+	w.cameraPos[2].SetTooltipText("Z, towards the camera before it's turned")
+	label, _ = gtk.LabelNew("Camera Position")
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(w.cameraPos[0], 1, y, 1, 1)
+	g.Attach(w.cameraPos[1], 2, y, 1, 1)
+	g.Attach(w.cameraPos[2], 3, y, 1, 1)
+	y++
+
+	w.cameraYaw, _ = gtk.SpinButtonNewWithRange(-360, 360, 1)
+	w.cameraYaw.SetDigits(2)
+	w.cameraYaw.SetTooltipText("Degrees turned to the right")
+	w.cameraYaw.Connect("value-changed", func(b *gtk.SpinButton) {
+		if w.showingUniforms {
+			return
+		}
+		w.uniforms.CameraYaw = b.GetValue()
+		w.sendMessage <- w.uniforms
+	})
+	w.cameraPitch, _ = gtk.SpinButtonNewWithRange(-89.9, 89.9, 1)
+	w.cameraPitch.SetDigits(2)
+	w.cameraPitch.SetTooltipText("Degrees looked up")
+	w.cameraPitch.Connect("value-changed", func(b *gtk.SpinButton) {
+		if w.showingUniforms {
+			return
+		}
+		w.uniforms.CameraPitch = b.GetValue()
+		w.sendMessage <- w.uniforms
+	})
+	w.fieldOfView, _ = gtk.SpinButtonNewWithRange(1, 170, 1)
+	w.fieldOfView.SetDigits(1)
+	w.fieldOfView.SetTooltipText("Field of view in degrees, across the longer side of the view")
+	w.fieldOfView.Connect("value-changed", func(b *gtk.SpinButton) {
+		if w.showingUniforms {
+			return
+		}
+		w.uniforms.FieldOfView = b.GetValue()
+		w.sendMessage <- w.uniforms
+	})
+	label, _ = gtk.LabelNew("Camera Angle")
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(w.cameraYaw, 1, y, 1, 1)
+	g.Attach(w.cameraPitch, 2, y, 1, 1)
+	g.Attach(w.fieldOfView, 3, y, 1, 1)
+	y++
+
+	cameraWidgets := []gtk.IWidget{cameraMode, cameraReset, w.cameraPos[0], w.cameraPos[1], w.cameraPos[2], w.cameraYaw, w.cameraPitch, w.fieldOfView}
+	setCameraSensitive := func() {
+		for _, widget := range cameraWidgets {
+			widget.ToWidget().SetSensitive(w.program.Is3D())
+		}
+	}
+	setCameraSensitive()
+	programMenu.Connect("changed", setCameraSensitive)
+
+	w.densitySampling, _ = gtk.ComboBoxTextNew()
+	for _, name := range programs.DensitySamplingNames {
+		w.densitySampling.AppendText(name)
+	}
+	w.densitySampling.SetTooltipText("How the points whose orbits are counted are chosen. Metropolis-Hastings favours orbits that cross the view, which is much faster when zoomed in")
+	w.densitySampling.Connect("changed", func(c *gtk.ComboBoxText) {
+		if w.showingUniforms {
+			return
+		}
+		w.uniforms.DensitySampling = programs.DensitySampling(c.GetActive())
+		w.sendMessage <- w.uniforms
+	})
+	w.densitySamples, _ = gtk.SpinButtonNewWithRange(0.1, 1e5, 1)
+	w.densitySamples.SetDigits(1)
+	w.densitySamples.SetTooltipText("Orbits counted for each pixel. More take longer, with less noise")
+	w.densitySamples.Connect("value-changed", func(b *gtk.SpinButton) {
+		if w.showingUniforms {
+			return
+		}
+		w.uniforms.DensitySamples = b.GetValue()
+		w.sendMessage <- w.uniforms
+	})
+	w.toneMap, _ = gtk.ComboBoxTextNew()
+	for _, name := range programs.ToneMapNames {
+		w.toneMap.AppendText(name)
+	}
+	w.toneMap.SetTooltipText("How the number of orbits crossing each pixel is turned into brightness")
+	w.toneMap.Connect("changed", func(c *gtk.ComboBoxText) {
+		if w.showingUniforms {
+			return
+		}
+		w.uniforms.ToneMap = programs.ToneMap(c.GetActive())
+		w.sendMessage <- w.uniforms
+	})
+	label, _ = gtk.LabelNew("Density")
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(w.densitySampling, 1, y, 1, 1)
+	g.Attach(w.densitySamples, 2, y, 1, 1)
+	g.Attach(w.toneMap, 3, y, 1, 1)
+	y++
+
+	setDensitySensitive := func() {
+		w.densitySamples.SetSensitive(w.program.Density != nil)
+		// flames choose their points by playing the chaos game, and have their own tone map
+		for _, widget := range []gtk.IWidget{w.densitySampling, w.toneMap} {
+			widget.ToWidget().SetSensitive(w.program.Density != nil && !w.program.IsFlame())
+		}
+	}
+	setDensitySensitive()
+	programMenu.Connect("changed", setDensitySensitive)
+
+	flameButton, _ := gtk.ButtonNewWithLabel("Edit Transforms")
+	flameButton.SetTooltipText("Edit the affine transforms and variations of the flame")
+	flameButton.Connect("clicked", w.openFlame)
+	flameImport, _ := gtk.ButtonNewWithLabel("Import")
+	flameImport.SetTooltipText("Read a flam3 or Apophysis flame, with its view, quality and palette")
+	flameImport.Connect("clicked", func() {
+		name, ok := chooseFile(w, "Import Flame", gtk.FILE_CHOOSER_ACTION_OPEN, "")
+		if !ok {
+			return
+		}
+		uniforms := w.uniforms
+		if _, _, err := loadFlame(name, &uniforms); err != nil {
+			NewErrorDialog(w, err, 0)
+			return
+		}
+		w.uniforms = uniforms
+		w.palletSource = uniforms.PalletSource
+		w.showDensity()
+		w.showFlame()
+		w.sendMessage <- w.uniforms
+	})
+	flameExport, _ := gtk.ButtonNewWithLabel("Export")
+	flameExport.SetTooltipText("Save the flame as a flam3 file, viewed as in an image of the save size")
+	flameExport.Connect("clicked", func() {
+		name, ok := chooseFile(w, "Export Flame", gtk.FILE_CHOOSER_ACTION_SAVE, "flame.flam3")
+		if !ok {
+			return
+		}
+		if err := saveFlame(name, &w.uniforms, w.saveOpts.Width, w.saveOpts.Height); err != nil {
+			NewErrorDialog(w, err, 0)
+		}
+	})
+	label, _ = gtk.LabelNew("Flame")
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(flameButton, 1, y, 1, 1)
+	g.Attach(flameImport, 2, y, 1, 1)
+	g.Attach(flameExport, 3, y, 1, 1)
+	y++
+
+	flameTone := func(high, step float64, tooltip string, value func() *float64) *gtk.SpinButton {
+		b, _ := gtk.SpinButtonNewWithRange(0, high, step)
+		b.SetDigits(2)
+		b.SetTooltipText(tooltip)
+		b.Connect("value-changed", func(b *gtk.SpinButton) {
+			if w.showingUniforms {
+				return
+			}
+			*value() = b.GetValue()
+			w.sendMessage <- w.uniforms
+		})
+		return b
+	}
+	w.flameBrightness = flameTone(100, .1, "Brightness of the log density tone map", func() *float64 { return &w.uniforms.Flame.Brightness })
+	w.flameGamma = flameTone(100, .1, "Gamma applied to the brightness, lifting sparse areas", func() *float64 { return &w.uniforms.Flame.Gamma })
+	w.flameVibrancy = flameTone(1, .05, "How much gamma is applied to the brightness instead of each colour, keeping colours saturated", func() *float64 { return &w.uniforms.Flame.Vibrancy })
+	label, _ = gtk.LabelNew("Flame Tone")
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(w.flameBrightness, 1, y, 1, 1)
+	g.Attach(w.flameGamma, 2, y, 1, 1)
+	g.Attach(w.flameVibrancy, 3, y, 1, 1)
+	y++
+
+	flameWidgets := []gtk.IWidget{flameButton, flameImport, flameExport, w.flameBrightness, w.flameGamma, w.flameVibrancy}
+	setFlameSensitive := func() {
+		for _, widget := range flameWidgets {
+			widget.ToWidget().SetSensitive(w.program.IsFlame())
+		}
+	}
+	setFlameSensitive()
+	programMenu.Connect("changed", setFlameSensitive)
+
 	seperator, _ := gtk.SeparatorNew(gtk.ORIENTATION_HORIZONTAL)
 	g.Attach(seperator, 0, y, 4, 1)
 	y++
@@ -208,6 +580,19 @@ func NewConfigWindow(
 		w.generateColour()
 	})
 
+	label, _ = gtk.LabelNew("Pallet Generator")
+	generator, _ := gtk.ComboBoxTextNew()
+	for _, name := range palletGeneratorNames {
+		generator.AppendText(name)
+	}
+	generator.SetActive(int(GenerateRandomWalk))
+	palletRandomize, _ := gtk.ButtonNewWithLabel("Randomize")
+	palletRandomize.SetTooltipText("Pick a random preset, or a random walk with a new seed")
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(generator, 1, y, 2, 1)
+	g.Attach(palletRandomize, 3, y, 1, 1)
+	y++
+
 	label, _ = gtk.LabelNew("Colour Pallet")
 	colourSeedButton, _ := gtk.ButtonNewWithLabel("Randomize Seed")
 	colourSeedButton.Connect("clicked", func(button *gtk.Button) {
@@ -244,6 +629,278 @@ func NewConfigWindow(
 	g.Attach(colourStartG, 2, y, 1, 1)
 	g.Attach(colourStartB, 3, y, 1, 1)
 	y++
+	randomWalkWidgets := []gtk.IWidget{colourWalkRate, colourSeedButton, colourStartButton, colourStartR, colourStartG, colourStartB}
+
+	w.gradient = programs.DefaultGradient()
+	w.gradients, err = loadGradients()
+	if err != nil {
+		log.Println(err)
+	}
+
+	// a gradient edited by hand no longer comes from where it was loaded
+	editGradient := func() {
+		w.palletSource = ""
+		w.generateColour()
+	}
+	gradientEditor := NewGradientEditor(&w.gradient, editGradient)
+	gradientEditor.Area.SetTooltipText("Drag stops to move them, double click to add one")
+	label, _ = gtk.LabelNew("Gradient")
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(gradientEditor.Area, 1, y, 3, 1)
+	y++
+
+	interpolation, _ := gtk.ComboBoxTextNew()
+	for _, name := range programs.InterpolationNames {
+		interpolation.AppendText(name)
+	}
+	interpolation.SetActive(int(w.gradient.Interpolation))
+	interpolation.SetTooltipText("Colour space the stops are mixed in")
+	interpolation.Connect("changed", func(c *gtk.ComboBoxText) {
+		w.gradient.Interpolation = programs.Interpolation(c.GetActive())
+		gradientEditor.Refresh()
+		editGradient()
+	})
+	label, _ = gtk.LabelNew("Stop")
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(gradientEditor.Colour, 1, y, 1, 1)
+	g.Attach(gradientEditor.Remove, 2, y, 1, 1)
+	g.Attach(interpolation, 3, y, 1, 1)
+	y++
+
+	gradientRepeat, _ := gtk.SpinButtonNewWithRange(1, 100, 1)
+	gradientRepeat.SetValue(float64(w.gradient.Repeat))
+	gradientRepeat.SetTooltipText("Times the gradient is repeated over the pallet")
+	gradientRepeat.Connect("value-changed", func(b *gtk.SpinButton) {
+		w.gradient.Repeat = b.GetValueAsInt()
+		editGradient()
+	})
+	gradientReverse, _ := gtk.CheckButtonNewWithLabel("Reverse")
+	gradientReverse.Connect("toggled", func(b *gtk.CheckButton) {
+		w.gradient.Reverse = b.GetActive()
+		editGradient()
+	})
+	label, _ = gtk.LabelNew("Repeat")
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(gradientRepeat, 1, y, 1, 1)
+	g.Attach(gradientReverse, 2, y, 1, 1)
+	y++
+
+	gradientName, _ := gtk.ComboBoxTextNewWithEntry()
+	listGradients := func() {
+		gradientName.RemoveAll()
+		names := make([]string, 0, len(w.gradients))
+		for name := range w.gradients {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			gradientName.AppendText(name)
+		}
+	}
+	listGradients()
+	setGradient := func(gradient programs.Gradient, source string) {
+		w.gradient = gradient
+		w.gradient.Stops = slices.Clone(gradient.Stops)
+		interpolation.SetActive(int(w.gradient.Interpolation))
+		gradientRepeat.SetValue(float64(w.gradient.Repeat))
+		gradientReverse.SetActive(w.gradient.Reverse)
+		gradientEditor.Refresh()
+		// after the widgets, whose handlers clear it
+		w.palletSource = source
+		w.generateColour()
+	}
+	gradientName.Connect("changed", func(c *gtk.ComboBoxText) {
+		gradient, ok := w.gradients[c.GetActiveText()]
+		if c.GetActive() < 0 || !ok {
+			return
+		}
+		setGradient(gradient, "")
+	})
+	gradientSave, _ := gtk.ButtonNewWithLabel("Save")
+	gradientSave.SetTooltipText("Save the gradient with this name")
+	gradientSave.Connect("clicked", func() {
+		name := gradientName.GetActiveText()
+		if name == "" {
+			return
+		}
+		gradient := w.gradient
+		gradient.Stops = slices.Clone(w.gradient.Stops)
+		w.gradients[name] = gradient
+		if err := saveGradients(w.gradients); err != nil {
+			NewErrorDialog(w, err, 0)
+		}
+		listGradients()
+	})
+	gradientDelete, _ := gtk.ButtonNewWithLabel("Delete")
+	gradientDelete.Connect("clicked", func() {
+		name := gradientName.GetActiveText()
+		if _, ok := w.gradients[name]; !ok {
+			return
+		}
+		delete(w.gradients, name)
+		if err := saveGradients(w.gradients); err != nil {
+			NewErrorDialog(w, err, 0)
+		}
+		listGradients()
+	})
+	label, _ = gtk.LabelNew("Saved Gradients")
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(gradientName, 1, y, 1, 1)
+	g.Attach(gradientSave, 2, y, 1, 1)
+	g.Attach(gradientDelete, 3, y, 1, 1)
+	y++
+
+	presetMenu, err := newPresetMenu()
+	if err != nil {
+		quit(fmt.Errorf("newPresetMenu: %w", err))
+		return nil
+	}
+	presetMenu.SetTooltipText("Built-in gradients")
+	loadPreset := func(i int) {
+		generator.SetActive(int(GenerateGradient))
+		setGradient(programs.PalletPresets[i].Clone(), "")
+	}
+	presetMenu.Connect("changed", func(c *gtk.ComboBox) {
+		if i := c.GetActive(); i >= 0 {
+			loadPreset(i)
+		}
+	})
+	palletRandomize.Connect("clicked", func() {
+		i := rand.Intn(len(programs.PalletPresets) + 1)
+		switch {
+		case i == len(programs.PalletPresets):
+			w.colourSeed = rand.Int63()
+			generator.SetActive(int(GenerateRandomWalk))
+			colourStartButton.Clicked() // also generates the pallet
+		case i == presetMenu.GetActive():
+			loadPreset(i)
+		default:
+			presetMenu.SetActive(i)
+		}
+	})
+	label, _ = gtk.LabelNew("Preset")
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(presetMenu, 1, y, 3, 1)
+	y++
+
+	palletImport, _ := gtk.ButtonNewWithLabel("Import")
+	palletImport.SetTooltipText("Read a Fractint, Ultra Fractal, GIMP, CSV or JSON pallet into the gradient")
+	palletImport.Connect("clicked", func() {
+		name, ok := chooseFile(w, "Import Pallet", gtk.FILE_CHOOSER_ACTION_OPEN, "")
+		if !ok {
+			return
+		}
+		gradient, err := importPallet(name)
+		if err != nil {
+			NewErrorDialog(w, err, 0)
+			return
+		}
+		generator.SetActive(int(GenerateGradient))
+		setGradient(gradient, name)
+	})
+	palletExport, _ := gtk.ButtonNewWithLabel("Export")
+	palletExport.SetTooltipText("Save the pallet as .map, .ugr, .ggr, .gpl, .csv or .json")
+	palletExport.Connect("clicked", func() {
+		name, ok := chooseFile(w, "Export Pallet", gtk.FILE_CHOOSER_ACTION_SAVE, "pallet.map")
+		if !ok {
+			return
+		}
+		if err := exportPallet(name, w.uniforms.ColourPallet); err != nil {
+			NewErrorDialog(w, err, 0)
+		}
+	})
+	label, _ = gtk.LabelNew("Pallet File")
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(palletImport, 1, y, 1, 1)
+	g.Attach(palletExport, 2, y, 1, 1)
+	y++
+
+	imageColours, _ := gtk.SpinButtonNewWithRange(1, 32, 1)
+	imageColours.SetValue(8)
+	imageColours.SetTooltipText("Number of colours to extract from the image")
+	imageMethod, _ := gtk.ComboBoxTextNew()
+	for _, name := range programs.ExtractMethodNames {
+		imageMethod.AppendText(name)
+	}
+	imageMethod.SetActive(int(programs.ExtractKMeans))
+	imageMethod.SetTooltipText("How the dominant colours are found")
+	imageOrder, _ := gtk.ComboBoxTextNew()
+	for _, name := range programs.PalletOrderNames {
+		imageOrder.AppendText(name)
+	}
+	imageOrder.SetActive(int(programs.OrderLightness))
+	imageOrder.SetTooltipText("How the colours are ordered along the gradient")
+
+	// the last image opened, extracted from again when the options change
+	var palletImage image.Image
+	var palletImageName string
+	extract := func() {
+		if palletImage == nil {
+			return
+		}
+		opts := programs.ExtractOptions{
+			Colours: imageColours.GetValueAsInt(),
+			Method:  programs.ExtractMethod(imageMethod.GetActive()),
+			Order:   programs.PalletOrder(imageOrder.GetActive()),
+		}
+		gradient, err := programs.ExtractPallet(palletImage, opts)
+		if err != nil {
+			NewErrorDialog(w, err, 0)
+			return
+		}
+		generator.SetActive(int(GenerateGradient))
+		setGradient(gradient, palletImageSource(palletImageName, opts))
+	}
+	imageOpen, _ := gtk.ButtonNewWithLabel("From Image")
+	imageOpen.SetTooltipText("Make a gradient from the dominant colours of a PNG or JPEG")
+	imageOpen.Connect("clicked", func() {
+		name, ok := chooseFile(w, "Pallet From Image", gtk.FILE_CHOOSER_ACTION_OPEN, "")
+		if !ok {
+			return
+		}
+		img, err := loadPalletImage(name)
+		if err != nil {
+			NewErrorDialog(w, err, 0)
+			return
+		}
+		palletImage, palletImageName = img, name
+		extract()
+	})
+	imageColours.Connect("value-changed", extract)
+	imageMethod.Connect("changed", extract)
+	imageOrder.Connect("changed", extract)
+	label, _ = gtk.LabelNew("Image Pallet")
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(imageOpen, 1, y, 1, 1)
+	g.Attach(imageColours, 2, y, 1, 1)
+	g.Attach(imageMethod, 3, y, 1, 1)
+	y++
+	label, _ = gtk.LabelNew("Colour Order")
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(imageOrder, 1, y, 1, 1)
+	y++
+
+	gradientWidgets := []gtk.IWidget{
+		gradientEditor.Area, gradientEditor.Colour, gradientEditor.Remove, interpolation,
+		gradientRepeat, gradientReverse, gradientName, gradientSave, gradientDelete,
+	}
+	setGenerator := func(generator PalletGenerator) {
+		w.palletGenerator = generator
+		if generator != GenerateGradient {
+			w.palletSource = ""
+		}
+		for _, widget := range randomWalkWidgets {
+			widget.ToWidget().SetSensitive(generator == GenerateRandomWalk)
+		}
+		for _, widget := range gradientWidgets {
+			widget.ToWidget().SetSensitive(generator == GenerateGradient)
+		}
+	}
+	setGenerator(GenerateRandomWalk)
+	generator.Connect("changed", func(c *gtk.ComboBoxText) {
+		setGenerator(PalletGenerator(c.GetActive()))
+		w.generateColour()
+	})
 
 	colourEmptyR, _ := gtk.SpinButtonNewWithRange(0, 1, 0.05)
 	colourEmptyR.SetValue(0.1)
@@ -273,6 +930,76 @@ func NewConfigWindow(
 	g.Attach(colourEmptyB, 3, y, 1, 1)
 	y++
 
+	// the pallet texture can be as long as the smallest maximum texture size OpenGL 4.6 allows
+	w.palletLength = programs.DefaultPalletLength
+	palletLength, _ := gtk.SpinButtonNewWithRange(1, 16384, 1)
+	palletLength.SetValue(float64(w.palletLength))
+	palletLength.SetTooltipText("Number of colours in the pallet")
+	palletLength.Connect("value-changed", func(b *gtk.SpinButton) {
+		w.palletLength = b.GetValueAsInt()
+		w.generateColour()
+	})
+	palletLinear, _ := gtk.CheckButtonNewWithLabel("Linear")
+	palletLinear.SetTooltipText("Mix between colours instead of taking the nearest")
+	palletLinear.Connect("toggled", func(b *gtk.CheckButton) {
+		w.uniforms.PalletLinear = b.GetActive()
+		w.sendMessage <- w.uniforms
+	})
+	label, _ = gtk.LabelNew("Pallet Length")
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(palletLength, 1, y, 1, 1)
+	g.Attach(palletLinear, 2, y, 1, 1)
+	y++
+
+	palletScale, _ := gtk.SpinButtonNewWithRange(0.01, 100, 0.05)
+	palletScale.SetDigits(2)
+	palletScale.SetValue(1)
+	palletScale.SetTooltipText("Colours moved along the pallet each iteration. Less than 1 stretches the pallet over more iterations")
+	palletScale.Connect("value-changed", func(b *gtk.SpinButton) {
+		w.uniforms.PalletScale = float32(b.GetValue())
+		w.sendMessage <- w.uniforms
+	})
+	label, _ = gtk.LabelNew("Pallet Scale")
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(palletScale, 1, y, 1, 1)
+	y++
+
+	w.palletOffset, _ = gtk.SpinButtonNewWithRange(0, 100000, 1)
+	w.palletOffset.SetTooltipText("Shift the pallet by this many colours. Offsets past the end of the pallet cycle it more than once in animations")
+	w.palletOffset.Connect("value-changed", func(b *gtk.SpinButton) {
+		w.uniforms.PalletOffset = uint32(b.GetValueAsInt())
+		w.sendMessage <- w.uniforms
+	})
+
+	palletSpeed, _ := gtk.ScaleNewWithRange(gtk.ORIENTATION_HORIZONTAL, -60, 60, 1)
+	palletSpeed.SetValue(10)
+	palletSpeed.SetTooltipText("Colours per second")
+
+	palletCycle, _ := gtk.ToggleButtonNewWithLabel("Cycle")
+	cycle := func() {
+		speed := 0.
+		if palletCycle.GetActive() {
+			speed = palletSpeed.GetValue()
+		}
+		w.sendMessage <- PalletCycle{
+			Speed:  speed,
+			Offset: w.uniforms.PalletOffset,
+		}
+	}
+	palletCycle.Connect("toggled", cycle)
+	palletSpeed.Connect("value-changed", func() {
+		if palletCycle.GetActive() {
+			cycle()
+		}
+	})
+
+	label, _ = gtk.LabelNew("Pallet Offset")
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(w.palletOffset, 1, y, 1, 1)
+	g.Attach(palletSpeed, 2, y, 1, 1)
+	g.Attach(palletCycle, 3, y, 1, 1)
+	y++
+
 	seperator, _ = gtk.SeparatorNew(gtk.ORIENTATION_HORIZONTAL)
 	g.Attach(seperator, 0, y, 4, 1)
 	y++
@@ -288,31 +1015,34 @@ func NewConfigWindow(
 	g.Attach(iterationsButton, 1, y, 3, 1)
 	y++
 
-	sliders := make([]*gtk.Scale, len(w.uniforms.Sliders))
+	w.sliders = make([]*gtk.Scale, len(w.uniforms.Sliders))
+	w.sliderLabels = make([]*gtk.Label, len(w.uniforms.Sliders))
 	for i := range w.uniforms.Sliders {
-		label, _ := gtk.LabelNew(fmt.Sprintf("Slider %v", i))
-		sliders[i], _ = gtk.ScaleNewWithRange(gtk.ORIENTATION_HORIZONTAL, -2, 2, 0.00000001)
-		sliders[i].SetProperty("digits", 7)
-		sliders[i].SetValue(0)
-		sliders[i].Connect("value-changed", func(s *gtk.Scale) {
+		slider := w.program.Slider(i)
+		w.sliderLabels[i], _ = gtk.LabelNew(slider.Name)
+		w.sliders[i], _ = gtk.ScaleNewWithRange(gtk.ORIENTATION_HORIZONTAL, slider.Min, slider.Max, 0.00000001)
+		w.sliders[i].SetProperty("digits", 7)
+		w.sliders[i].SetValue(slider.Default)
+		w.sliders[i].Connect("value-changed", func(s *gtk.Scale) {
+			if w.showingUniforms {
+				return
+			}
 			w.uniforms.Sliders[i] = s.GetValue()
 			w.sendMessage <- w.uniforms
 		})
 
-		sliders[i].SetSizeRequest(300, 20)
+		w.sliders[i].SetSizeRequest(300, 20)
 
-		g.Attach(label, 0, y, 1, 1)
-		g.Attach(sliders[i], 1, y, 3, 1)
+		g.Attach(w.sliderLabels[i], 0, y, 1, 1)
+		g.Attach(w.sliders[i], 1, y, 3, 1)
 
 		y++
 	}
 
 	sliderReset, _ := gtk.ButtonNewWithLabel("Reset Sliders")
 	sliderReset.Connect("clicked", func(button *gtk.Button) {
-		for i := range w.uniforms.Sliders {
-			w.uniforms.Sliders[i] = 0
-			sliders[i].SetValue(0)
-		}
+		w.uniforms.Sliders = w.program.DefaultSliders()
+		w.showSliders()
 		w.sendMessage <- w.uniforms
 	})
 
@@ -361,16 +1091,6 @@ func NewConfigWindow(
 		heightEntry.SetText(strconv.Itoa(imageSize.height))
 		w.saveOpts.Width = imageSize.width
 	})
-	imageAntiAlias, _ := gtk.CheckButtonNewWithLabel("Antialias")
-	imageAntiAlias.SetActive(true)
-	w.saveOpts.Antialias = float32(1) / 3
-	imageAntiAlias.Connect("toggled", func(b *gtk.CheckButton) {
-		if b.GetActive() {
-			w.saveOpts.Antialias = float32(1) / 3
-		} else {
-			w.saveOpts.Antialias = 0
-		}
-	})
 	imageMultithread, _ := gtk.CheckButtonNewWithLabel("Multithread/Buffered")
 	imageMultithread.SetTooltipText("Disable if you have issues")
 	imageMultithread.SetActive(true)
@@ -379,9 +1099,42 @@ func NewConfigWindow(
 		w.saveOpts.Multithread = b.GetActive()
 	})
 	g.Attach(label, 0, y, 1, 1)
+	imageFormat, _ := gtk.ComboBoxTextNew()
+	for _, name := range imageFormatNames {
+		imageFormat.AppendText(name)
+	}
+	imageFormat.SetActive(int(FormatPNG))
+	imageFormat.SetTooltipText("Data formats store iteration counts and the final value of z instead of colours")
+	pngCompression, _ := gtk.ComboBoxTextNew()
+	for _, name := range pngCompressionNames {
+		pngCompression.AppendText(name)
+	}
+	pngCompression.SetTooltipText("PNG compression")
+	pngCompression.SetActive(0)
+	pngCompression.Connect("changed", func(c *gtk.ComboBoxText) {
+		w.saveOpts.PNGCompression = pngCompressionLevels[c.GetActive()]
+	})
+	w.saveOpts.JPEGQuality = 90
+	jpegQuality, _ := gtk.SpinButtonNewWithRange(1, 100, 1)
+	jpegQuality.SetTooltipText("JPEG quality")
+	jpegQuality.SetValue(float64(w.saveOpts.JPEGQuality))
+	jpegQuality.SetSensitive(false)
+	jpegQuality.Connect("value-changed", func(b *gtk.SpinButton) {
+		w.saveOpts.JPEGQuality = b.GetValueAsInt()
+	})
+	imageFormat.Connect("changed", func(c *gtk.ComboBoxText) {
+		w.saveOpts.Format = ImageFormat(c.GetActive())
+		pngCompression.SetSensitive(w.saveOpts.Format == FormatPNG)
+		jpegQuality.SetSensitive(w.saveOpts.Format == FormatJPEG)
+	})
 	g.Attach(saveButton, 1, y, 1, 1)
-	g.Attach(imageAntiAlias, 2, y, 1, 1)
-	g.Attach(imageMultithread, 3, y, 1, 1)
+	g.Attach(imageMultithread, 2, y, 1, 1)
+	g.Attach(imageFormat, 3, y, 1, 1)
+	y++
+	label, _ = gtk.LabelNew("Format Options")
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(pngCompression, 1, y, 1, 1)
+	g.Attach(jpegQuality, 2, y, 1, 1)
 	y++
 	label, _ = gtk.LabelNew("Size")
 	g.Attach(label, 0, y, 1, 1)
@@ -396,11 +1149,116 @@ func NewConfigWindow(
 	g.Attach(b, 2, y, 2, 1)
 	y++
 
+	w.saveOpts.Supersample = SupersampleOptions{
+		Pattern: SampleGrid,
+		Samples: 3,
+		Filter:  FilterBox,
+	}
+	samplePattern, _ := gtk.ComboBoxTextNew()
+	for _, name := range samplePatternNames {
+		samplePattern.AppendText(name)
+	}
+	samplePattern.SetActive(int(w.saveOpts.Supersample.Pattern))
+	samplePattern.Connect("changed", func(c *gtk.ComboBoxText) {
+		w.saveOpts.Supersample.Pattern = SamplePattern(c.GetActive())
+	})
+	sampleCount, _ := gtk.SpinButtonNewWithRange(1, 16, 1)
+	sampleCount.SetTooltipText("Samples along each axis")
+	sampleCount.SetValue(float64(w.saveOpts.Supersample.Samples))
+	sampleCount.Connect("value-changed", func(b *gtk.SpinButton) {
+		w.saveOpts.Supersample.Samples = b.GetValueAsInt()
+	})
+	sampleFilter, _ := gtk.ComboBoxTextNew()
+	for _, name := range sampleFilterNames {
+		sampleFilter.AppendText(name)
+	}
+	sampleFilter.SetActive(int(w.saveOpts.Supersample.Filter))
+	sampleFilter.Connect("changed", func(c *gtk.ComboBoxText) {
+		w.saveOpts.Supersample.Filter = SampleFilter(c.GetActive())
+	})
+	label, _ = gtk.LabelNew("Supersampling")
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(samplePattern, 1, y, 1, 1)
+	g.Attach(sampleCount, 2, y, 1, 1)
+	g.Attach(sampleFilter, 3, y, 1, 1)
+	y++
+
+	w.saveOpts.Supersample.Threshold = 0.05
+	sampleAdaptive, _ := gtk.CheckButtonNewWithLabel("Edges Only")
+	sampleAdaptive.SetTooltipText("Only supersample pixels that differ from their neighbours")
+	sampleAdaptive.Connect("toggled", func(b *gtk.CheckButton) {
+		w.saveOpts.Supersample.Adaptive = b.GetActive()
+	})
+	sampleThreshold, _ := gtk.SpinButtonNewWithRange(0, 1, 0.01)
+	sampleThreshold.SetTooltipText("How different a neighbouring pixel must be for a pixel to be supersampled")
+	sampleThreshold.SetValue(float64(w.saveOpts.Supersample.Threshold))
+	sampleThreshold.Connect("value-changed", func(b *gtk.SpinButton) {
+		w.saveOpts.Supersample.Threshold = float32(b.GetValue())
+	})
+	label, _ = gtk.LabelNew("Adaptive")
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(sampleAdaptive, 1, y, 1, 1)
+	g.Attach(sampleThreshold, 2, y, 1, 1)
+	y++
+
+	w.saveOpts.BitDepth = 8
+	bitDepth, _ := gtk.ComboBoxTextNew()
+	bitDepth.AppendText("8 bit")
+	bitDepth.AppendText("16 bit")
+	bitDepth.SetActive(0)
+	bitDepth.Connect("changed", func(c *gtk.ComboBoxText) {
+		w.saveOpts.BitDepth = 8 << c.GetActive()
+	})
+	dither, _ := gtk.CheckButtonNewWithLabel("Dither")
+	dither.SetTooltipText("Hide banding in 8 bit images")
+	dither.Connect("toggled", func(b *gtk.CheckButton) {
+		w.saveOpts.Dither = b.GetActive()
+	})
+	label, _ = gtk.LabelNew("Colour Depth")
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(bitDepth, 1, y, 1, 1)
+	g.Attach(dither, 2, y, 1, 1)
+	y++
+
+	imageMetadata, _ := gtk.CheckButtonNewWithLabel("Write Statistics")
+	imageMetadata.SetTooltipText("Store render time, pixels per second and threads used in the PNG")
+	imageMetadata.Connect("toggled", func(b *gtk.CheckButton) {
+		w.saveOpts.Metadata = b.GetActive()
+	})
+	label, _ = gtk.LabelNew("Metadata")
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(imageMetadata, 1, y, 1, 1)
+	y++
+
+	expMap, _ := gtk.CheckButtonNewWithLabel("Exponential Map")
+	expMap.SetTooltipText("Render a log-polar strip, once around the centre across and zooming in down it. Each width of height zooms in by e^2π, about 535 times")
+	expMap.Connect("toggled", func(b *gtk.CheckButton) {
+		w.saveOpts.ExpMap = b.GetActive()
+	})
+	label, _ = gtk.LabelNew("Projection")
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(expMap, 1, y, 2, 1)
+	y++
+
+	seperator, _ = gtk.SeparatorNew(gtk.ORIENTATION_HORIZONTAL)
+	g.Attach(seperator, 0, y, 4, 1)
+	y++
+
+	animationButton, _ := gtk.ButtonNewWithLabel("Keyframes")
+	animationButton.Connect("clicked", w.openAnimation)
+	label, _ = gtk.LabelNew("Animation")
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(animationButton, 1, y, 1, 1)
+	y++
+
 	w.Add(g)
 	w.ShowAll()
 	w.SetKeepAbove(true)
 
 	w.uniforms.DefaultValues()
+	w.showCamera()
+	w.showDensity()
+	w.showFlame()
 	w.generateColour()
 
 	return w
@@ -413,15 +1271,54 @@ type ConfigWindow struct {
 	ctx  context.Context
 	quit func(error)
 
-	colourSeed     int64
-	colourWalkRate float32
-	startingColour mgl32.Vec3
+	palletGenerator PalletGenerator
+	palletLength    int
+	palletSource    string
+	colourSeed      int64
+	colourWalkRate  float32
+	startingColour  mgl32.Vec3
+	gradient        programs.Gradient
+	gradients       map[string]programs.Gradient
+
+	uniforms     programs.Uniforms
+	program      programs.Program
+	programMenu  *gtk.ComboBoxText
+	palletOffset *gtk.SpinButton
+
+	// the root being edited
+	rootCount, rootIndex, rootX, rootY *gtk.SpinButton
+
+	bailoutTest *gtk.ComboBoxText
+	bailout     *gtk.SpinButton
+
+	cameraMode                          CameraMode
+	cameraPos                           [3]*gtk.SpinButton
+	cameraYaw, cameraPitch, fieldOfView *gtk.SpinButton
+
+	densitySampling, toneMap *gtk.ComboBoxText
+	densitySamples           *gtk.SpinButton
 
-	uniforms    programs.Uniforms
-	program     programs.Program
-	sendMessage chan interface{}
+	flameBrightness, flameGamma, flameVibrancy *gtk.SpinButton
+	flameWindow                                *FlameWindow
+
+	sliders      []*gtk.Scale
+	sliderLabels []*gtk.Label
+
+	// set while widgets are being set to match the uniforms, so they don't send them back
+	showingUniforms bool
+	sendMessage     chan interface{}
 
 	saveOpts SaveOptions
+
+	animation       *Animation
+	animationWindow *AnimationWindow
+
+	hybrid       programs.Program // the program of the hybrid entry in the program menu
+	hybridWindow *HybridWindow
+
+	frames      map[int]chan *Frame
+	nextFrame   int
+	framesMutex sync.Mutex
 }
 
 func (w *ConfigWindow) realize(_ *gtk.ApplicationWindow) {
@@ -430,24 +1327,168 @@ func (w *ConfigWindow) realize(_ *gtk.ApplicationWindow) {
 
 func (w *ConfigWindow) getSaveName() string {
 	return fmt.Sprintf(
-		"fractal_%v_%vx%v_%v.png",
+		"fractal_%v_%vx%v_%v%v",
 		w.program.Name,
 		w.saveOpts.Width,
 		w.saveOpts.Height,
 		rand.Intn(10000),
+		w.saveOpts.Format.Extension(),
 	)
 }
 
+// showSliders names and ranges the sliders for the program,
+// and sets them to match the uniforms without sending them back.
+func (w *ConfigWindow) showSliders() {
+	w.showingUniforms = true
+	for i, s := range w.sliders {
+		slider, value := w.program.Slider(i), w.uniforms.Sliders[i]
+		w.sliderLabels[i].SetText(slider.Name)
+		s.SetRange(min(slider.Min, value), max(slider.Max, value))
+		s.SetValue(value)
+	}
+	w.showingUniforms = false
+}
+
+// showBailout sets the bailout widgets to match the uniforms without sending them back.
+func (w *ConfigWindow) showBailout() {
+	w.showingUniforms = true
+	w.bailoutTest.SetActive(int(w.uniforms.BailoutTest))
+	w.bailout.SetValue(w.uniforms.Bailout)
+	w.showingUniforms = false
+}
+
+// showCamera sets the 3D camera widgets to match the uniforms without sending them back.
+func (w *ConfigWindow) showCamera() {
+	w.showingUniforms = true
+	for axis, b := range w.cameraPos {
+		b.SetValue(w.uniforms.CameraPos[axis])
+	}
+	w.cameraYaw.SetValue(w.uniforms.CameraYaw)
+	w.cameraPitch.SetValue(w.uniforms.CameraPitch)
+	w.fieldOfView.SetValue(w.uniforms.FieldOfView)
+	w.showingUniforms = false
+}
+
+// showDensity sets the density program widgets to match the uniforms without sending them back.
+func (w *ConfigWindow) showDensity() {
+	w.showingUniforms = true
+	w.densitySampling.SetActive(int(w.uniforms.DensitySampling))
+	w.densitySamples.SetValue(w.uniforms.DensitySamples)
+	w.toneMap.SetActive(int(w.uniforms.ToneMap))
+	w.showingUniforms = false
+}
+
+// showFlame sets the flame tone widgets and transform editor to match the uniforms without sending them back.
+func (w *ConfigWindow) showFlame() {
+	w.showingUniforms = true
+	w.flameBrightness.SetValue(w.uniforms.Flame.Brightness)
+	w.flameGamma.SetValue(w.uniforms.Flame.Gamma)
+	w.flameVibrancy.SetValue(w.uniforms.Flame.Vibrancy)
+	w.showingUniforms = false
+
+	if w.flameWindow != nil {
+		w.flameWindow.load()
+	}
+}
+
+// showRoot sets the root spin buttons to match the uniforms without sending them back.
+func (w *ConfigWindow) showRoot() {
+	if w.showingUniforms {
+		return // changing the range changed the selected root
+	}
+	w.showingUniforms = true
+	w.rootCount.SetValue(float64(w.uniforms.RootCount))
+	w.rootIndex.SetRange(1, w.rootCount.GetValue())
+	root := w.uniforms.Roots[w.rootIndex.GetValueAsInt()-1]
+	w.rootX.SetValue(root[0])
+	w.rootY.SetValue(root[1])
+	w.showingUniforms = false
+}
+
 func (w *ConfigWindow) generateColour() {
-	w.uniforms.ColourPallet = programs.RandomColourPallet(
-		w.startingColour,
-		w.colourWalkRate,
-		rand.New(rand.NewSource(w.colourSeed)),
-	)
+	switch w.palletGenerator {
+	case GenerateGradient:
+		w.uniforms.ColourPallet = w.gradient.Pallet(w.palletLength)
+	default:
+		w.uniforms.ColourPallet = programs.RandomColourPallet(
+			w.startingColour,
+			w.colourWalkRate,
+			rand.New(rand.NewSource(w.colourSeed)),
+			w.palletLength,
+		)
+	}
+	w.uniforms.PalletSource = w.palletSource
+
+	w.sendMessage <- w.uniforms
+}
+
+// selectProgram chooses program in the program menu, which sends it and the uniforms.
+// Hybrids share the last entry.
+func (w *ConfigWindow) selectProgram(program programs.Program) {
+	for i := 0; i < programs.NumPrograms(); i++ {
+		if programs.GetProgram(i).Name == program.Name {
+			w.programMenu.SetActive(i)
+			return
+		}
+	}
+
+	w.hybrid = program
+	if w.programMenu.GetActive() == programs.NumPrograms() {
+		w.programMenu.Emit("changed", glib.TYPE_NONE)
+	} else {
+		w.programMenu.SetActive(programs.NumPrograms())
+	}
+}
 
+// show makes k the current view, sending it to the render window.
+func (w *ConfigWindow) show(k Keyframe) {
+	if k.Program != w.program.Name {
+		if program, ok := programs.ProgramByName(k.Program); ok {
+			w.selectProgram(program) // sends the program, with the keyframe's uniforms following
+		}
+	}
+	w.uniforms = k.Uniforms
+	w.showRoot()
+	w.showBailout()
+	w.showSliders()
+	w.showCamera()
+	w.showDensity()
+	w.showFlame()
 	w.sendMessage <- w.uniforms
 }
 
+// requestFrame has the render window draw req offscreen, waiting for the result.
+func (w *ConfigWindow) requestFrame(ctx context.Context, req FrameRequest) (*Frame, error) {
+	result := make(chan *Frame, 1)
+
+	w.framesMutex.Lock()
+	if w.frames == nil {
+		w.frames = make(map[int]chan *Frame)
+	}
+	w.nextFrame++
+	req.ID = w.nextFrame
+	w.frames[req.ID] = result
+	w.framesMutex.Unlock()
+
+	defer func() {
+		w.framesMutex.Lock()
+		delete(w.frames, req.ID)
+		w.framesMutex.Unlock()
+	}()
+
+	w.sendMessage <- req
+
+	select {
+	case frame := <-result:
+		if frame.Err != "" {
+			return nil, errors.New(frame.Err)
+		}
+		return frame, nil
+	case <-ctx.Done():
+		return nil, context.Cause(ctx)
+	}
+}
+
 func (w *ConfigWindow) save() {
 	w.saveOpts.Name = w.getSaveName()
 	save(
@@ -481,11 +1522,32 @@ func (w *ConfigWindow) handleReceive(conn net.Conn) {
 			glib.IdleAdd(func() {
 				w.uniforms.Zoom = msg.Zoom
 				w.uniforms.Pos = msg.Pos
+				if w.uniforms.Roots != msg.Roots {
+					w.uniforms.Roots = msg.Roots
+					w.showRoot()
+				}
+				if camera := msg.Camera3D(); camera != w.uniforms.Camera3D() {
+					w.uniforms.SetCamera3D(camera)
+					w.showCamera()
+				}
 				w.sendMessage <- skipClient{
 					msg:  *msg,
 					addr: conn.RemoteAddr(),
 				}
 			})
+
+		case *PalletCycle:
+			glib.IdleAdd(func() {
+				w.uniforms.PalletOffset = msg.Offset
+				w.palletOffset.SetValue(float64(msg.Offset))
+			})
+
+		case *Frame:
+			w.framesMutex.Lock()
+			if result, ok := w.frames[msg.ID]; ok {
+				result <- msg
+			}
+			w.framesMutex.Unlock()
 		}
 	}
 }
@@ -520,6 +1582,8 @@ func (w *ConfigWindow) listen(listener net.Listener) {
 				client.enc.Encode(&msg)
 				msg = w.program
 				client.enc.Encode(&msg)
+				msg = CameraControl{Mode: w.cameraMode}
+				client.enc.Encode(&msg)
 
 				clients[conn.RemoteAddr()] = client
 
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/stewi1014/glfractal/programs"
+)
+
+// affineNames label the coefficients of affine transforms, in flam3's order.
+var affineNames = [6]string{"a", "d", "b", "e", "c", "f"}
+
+func (w *ConfigWindow) openFlame() {
+	if w.flameWindow != nil {
+		w.flameWindow.Present()
+		return
+	}
+
+	var err error
+	w.flameWindow, err = NewFlameWindow(w)
+	if err != nil {
+		NewErrorDialog(w, err, 0)
+		return
+	}
+	w.flameWindow.Connect("destroy", func() {
+		w.flameWindow = nil
+	})
+}
+
+func NewFlameWindow(config *ConfigWindow) (*FlameWindow, error) {
+	var err error
+	w := &FlameWindow{
+		config: config,
+	}
+
+	w.ApplicationWindow, err = gtk.ApplicationWindowNew(config.app)
+	if err != nil {
+		return nil, fmt.Errorf("gtk.ApplicationWindowNew: %w", err)
+	}
+	w.SetTitle("GLFractal Flame")
+	w.SetIcon(iconPixbuf)
+	w.SetDefaultSize(-1, 600)
+
+	g, _ := gtk.GridNew()
+	g.SetRowSpacing(10)
+	g.SetColumnSpacing(10)
+	g.SetHExpand(true)
+	y := 0
+
+	label, _ := gtk.LabelNew("Preset")
+	preset, _ := gtk.ComboBoxTextNew()
+	for _, p := range programs.FlamePresets {
+		preset.AppendText(p.Name)
+	}
+	preset.SetTooltipText("Replace the transforms with a built-in flame")
+	preset.SetHExpand(true)
+	preset.Connect("changed", func(c *gtk.ComboBoxText) {
+		i := c.GetActive()
+		if i < 0 {
+			return
+		}
+		flame := programs.FlamePresets[i].Flame()
+		w.flame.Transforms, w.flame.Final = flame.Transforms, flame.Final
+		w.final.SetActive(w.flame.Final != nil)
+		w.refresh()
+		w.apply()
+	})
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(preset, 1, y, 2, 1)
+	y++
+
+	label, _ = gtk.LabelNew("Transforms")
+	addButton, _ := gtk.ButtonNewWithLabel("Add Transform")
+	addButton.Connect("clicked", func() {
+		w.flame.Transforms = append(w.flame.Transforms, programs.NewFlameTransform(1, .5, programs.Affine{.5, 0, 0, .5, 0, 0}))
+		w.refresh()
+		w.apply()
+	})
+	w.final, _ = gtk.CheckButtonNewWithLabel("Final Transform")
+	w.final.SetTooltipText("Transform each point again before it's plotted, without moving it")
+	w.final.Connect("toggled", func(b *gtk.CheckButton) {
+		if b.GetActive() == (w.flame.Final != nil) {
+			return
+		}
+		if b.GetActive() {
+			final := programs.NewFlameTransform(1, 0, programs.IdentityAffine)
+			final.ColourSpeed = 0
+			w.flame.Final = &final
+		} else {
+			w.flame.Final = nil
+		}
+		w.refresh()
+		w.apply()
+	})
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(addButton, 1, y, 1, 1)
+	g.Attach(w.final, 2, y, 1, 1)
+	y++
+
+	w.list, _ = gtk.ListBoxNew()
+	w.list.SetSelectionMode(gtk.SELECTION_NONE)
+	scroll, _ := gtk.ScrolledWindowNew(nil, nil)
+	scroll.SetPolicy(gtk.POLICY_NEVER, gtk.POLICY_AUTOMATIC)
+	scroll.SetMinContentHeight(300)
+	scroll.SetVExpand(true)
+	scroll.Add(w.list)
+	g.Attach(scroll, 0, y, 3, 1)
+	y++
+
+	w.Add(g)
+	w.load()
+	w.ShowAll()
+	return w, nil
+}
+
+// FlameWindow edits the transforms of the flame, which is shown in the render window as it changes.
+type FlameWindow struct {
+	*gtk.ApplicationWindow
+	config *ConfigWindow
+	flame  programs.Flame // a copy of the config window's, so it can be edited while the uniforms are sent
+
+	final *gtk.CheckButton
+	list  *gtk.ListBox
+}
+
+// load copies the config window's flame to edit, after it's changed there.
+func (w *FlameWindow) load() {
+	w.flame = w.config.uniforms.Flame.Clone()
+	w.final.SetActive(w.flame.Final != nil)
+	w.refresh()
+}
+
+// refresh rebuilds the list of transforms after one is added or removed.
+func (w *FlameWindow) refresh() {
+	w.list.GetChildren().Foreach(func(item interface{}) {
+		if widget, ok := item.(*gtk.Widget); ok {
+			widget.Destroy()
+		}
+	})
+
+	for i := range w.flame.Transforms {
+		remove, _ := gtk.ButtonNewWithLabel("Remove")
+		remove.SetSensitive(len(w.flame.Transforms) > 1)
+		remove.Connect("clicked", func() {
+			w.flame.Transforms = slices.Delete(w.flame.Transforms, i, i+1)
+			// rebuilding destroys the button while its signal is being handled
+			glib.IdleAdd(w.refresh)
+			w.apply()
+		})
+		w.list.Insert(w.transformRow(fmt.Sprintf("Transform %v", i+1), &w.flame.Transforms[i], remove), -1)
+	}
+
+	if w.flame.Final != nil {
+		w.list.Insert(w.transformRow("Final", w.flame.Final, nil), -1)
+	}
+	w.list.ShowAll()
+}
+
+// transformRow returns the widgets editing t, with its own button to remove it, if any.
+func (w *FlameWindow) transformRow(title string, t *programs.FlameTransform, remove *gtk.Button) *gtk.Grid {
+	g, _ := gtk.GridNew()
+	g.SetRowSpacing(5)
+	g.SetColumnSpacing(5)
+	g.SetMarginTop(5)
+	g.SetMarginBottom(5)
+	y := 0
+
+	// imported flames can have any values, which the buttons mustn't clamp
+	spin := func(value *float64, low, high, step float64, tooltip string) *gtk.SpinButton {
+		b, _ := gtk.SpinButtonNewWithRange(low, high, step)
+		b.SetDigits(3)
+		b.SetValue(*value)
+		b.SetTooltipText(tooltip)
+		b.Connect("value-changed", func(b *gtk.SpinButton) {
+			*value = b.GetValue()
+			w.apply()
+		})
+		return b
+	}
+
+	label, _ := gtk.LabelNew(title)
+	g.Attach(label, 0, y, 1, 1)
+	for k, field := range []struct {
+		name     string
+		value    *float64
+		tooltip  string
+		weighted bool
+	}{
+		{"Weight", &t.Weight, "Chance of this transform being picked, relative to the others", true},
+		{"Colour", &t.Colour, "Position along the pallet points move towards", false},
+		{"Speed", &t.ColourSpeed, "How far points move towards the colour", false},
+	} {
+		if field.weighted && remove == nil {
+			continue // the final transform is always applied
+		}
+		label, _ := gtk.LabelNew(field.name)
+		g.Attach(label, 1+k*2, y, 1, 1)
+		g.Attach(spin(field.value, -math.MaxFloat64, math.MaxFloat64, .05, field.tooltip), 2+k*2, y, 1, 1)
+	}
+	if remove != nil {
+		g.Attach(remove, 7, y, 1, 1)
+	}
+	y++
+
+	for c, name := range affineNames {
+		label, _ := gtk.LabelNew(name)
+		g.Attach(label, c+1, y, 1, 1)
+	}
+	y++
+
+	for _, affine := range []struct {
+		name    string
+		coefs   *programs.Affine
+		tooltip string
+	}{
+		{"Affine", &t.Affine, "x' = ax + by + c, y' = dx + ey + f, before the variations"},
+		{"Post", &t.Post, "x' = ax + by + c, y' = dx + ey + f, after the variations"},
+	} {
+		label, _ := gtk.LabelNew(affine.name)
+		g.Attach(label, 0, y, 1, 1)
+		for c := range affine.coefs {
+			g.Attach(spin(&affine.coefs[c], -math.MaxFloat64, math.MaxFloat64, .01, affine.tooltip), c+1, y, 1, 1)
+		}
+		y++
+	}
+
+	for j := range t.Variations {
+		v := &t.Variations[j]
+		kind, _ := gtk.ComboBoxTextNew()
+		for _, name := range programs.VariationNames {
+			kind.AppendText(name)
+		}
+		kind.SetActive(int(v.Kind))
+		kind.Connect("changed", func(c *gtk.ComboBoxText) {
+			v.Kind = programs.Variation(c.GetActive())
+			w.apply()
+		})
+
+		removeVariation, _ := gtk.ButtonNewWithLabel("Remove")
+		removeVariation.SetSensitive(len(t.Variations) > 1)
+		removeVariation.Connect("clicked", func() {
+			t.Variations = slices.Delete(t.Variations, j, j+1)
+			glib.IdleAdd(w.refresh)
+			w.apply()
+		})
+
+		label, _ := gtk.LabelNew("Variation")
+		g.Attach(label, 0, y, 1, 1)
+		g.Attach(kind, 1, y, 3, 1)
+		g.Attach(spin(&v.Weight, -math.MaxFloat64, math.MaxFloat64, .05, "Weight of the variation in the sum of them"), 4, y, 2, 1)
+		g.Attach(removeVariation, 6, y, 1, 1)
+		y++
+	}
+
+	addVariation, _ := gtk.ButtonNewWithLabel("Add Variation")
+	addVariation.Connect("clicked", func() {
+		t.Variations = append(t.Variations, programs.FlameVariation{Kind: programs.VariationLinear, Weight: 1})
+		glib.IdleAdd(w.refresh)
+		w.apply()
+	})
+	g.Attach(addVariation, 1, y, 3, 1)
+
+	return g
+}
+
+// apply makes the edited transforms the config window's, and sends them to the render window.
+func (w *FlameWindow) apply() {
+	flame := w.flame.Clone()
+	w.config.uniforms.Flame.Transforms, w.config.uniforms.Flame.Final = flame.Transforms, flame.Final
+	w.config.sendMessage <- w.config.uniforms
+}
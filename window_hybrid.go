@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/stewi1014/glfractal/programs"
+)
+
+// defaultHybrid is the hybrid the sequence editor starts with.
+var defaultHybrid = programs.Hybrid{
+	Steps: []programs.HybridStep{
+		{Formula: "Mandelbrot", Repeat: 2},
+		{Formula: "Burning Ship", Repeat: 1},
+	},
+}
+
+func (w *ConfigWindow) openHybrid() {
+	if w.hybridWindow != nil {
+		w.hybridWindow.Present()
+		return
+	}
+
+	var err error
+	w.hybridWindow, err = NewHybridWindow(w)
+	if err != nil {
+		NewErrorDialog(w, err, 0)
+		return
+	}
+	w.hybridWindow.Connect("destroy", func() {
+		w.hybridWindow = nil
+	})
+}
+
+func NewHybridWindow(config *ConfigWindow) (*HybridWindow, error) {
+	var err error
+	w := &HybridWindow{
+		config: config,
+		hybrid: defaultHybrid,
+	}
+	if h, err := programs.ParseHybrid(config.hybrid.Name); err == nil {
+		w.hybrid = h
+	}
+	w.hybrid.Steps = slices.Clone(w.hybrid.Steps)
+
+	w.ApplicationWindow, err = gtk.ApplicationWindowNew(config.app)
+	if err != nil {
+		return nil, fmt.Errorf("gtk.ApplicationWindowNew: %w", err)
+	}
+	w.SetTitle("GLFractal Hybrid")
+	w.SetIcon(iconPixbuf)
+
+	g, _ := gtk.GridNew()
+	g.SetRowSpacing(10)
+	g.SetColumnSpacing(10)
+	g.SetHExpand(true)
+	y := 0
+
+	label, _ := gtk.LabelNew("Sequence")
+	addButton, _ := gtk.ButtonNewWithLabel("Add Step")
+	addButton.Connect("clicked", func() {
+		w.hybrid.Steps = append(w.hybrid.Steps, programs.HybridStep{
+			Formula: programs.HybridFormulas[0].Name,
+			Repeat:  1,
+		})
+		w.refresh()
+		w.apply()
+	})
+	julia, _ := gtk.CheckButtonNewWithLabel("Julia")
+	julia.SetTooltipText("Iterate in Julia space, with c from the config window")
+	julia.SetActive(w.hybrid.Julia)
+	julia.Connect("toggled", func(b *gtk.CheckButton) {
+		w.hybrid.Julia = b.GetActive()
+		w.apply()
+	})
+	g.Attach(label, 0, y, 1, 1)
+	g.Attach(addButton, 1, y, 1, 1)
+	g.Attach(julia, 2, y, 1, 1)
+	y++
+
+	w.list, _ = gtk.ListBoxNew()
+	w.list.SetSelectionMode(gtk.SELECTION_NONE)
+	scroll, _ := gtk.ScrolledWindowNew(nil, nil)
+	scroll.SetPolicy(gtk.POLICY_NEVER, gtk.POLICY_AUTOMATIC)
+	scroll.SetMinContentHeight(200)
+	scroll.SetVExpand(true)
+	scroll.Add(w.list)
+	g.Attach(scroll, 0, y, 3, 1)
+	y++
+
+	w.status, _ = gtk.LabelNew("")
+	w.status.SetXAlign(0)
+	w.status.SetLineWrap(true)
+	g.Attach(w.status, 0, y, 3, 1)
+	y++
+
+	w.Add(g)
+	w.refresh()
+	w.apply()
+	w.ShowAll()
+	return w, nil
+}
+
+// HybridWindow edits the sequence of formulas of a hybrid, which is shown in the render window as it changes.
+type HybridWindow struct {
+	*gtk.ApplicationWindow
+	config *ConfigWindow
+	hybrid programs.Hybrid
+
+	list   *gtk.ListBox
+	status *gtk.Label
+}
+
+// refresh rebuilds the list of steps after one is added or removed.
+func (w *HybridWindow) refresh() {
+	w.list.GetChildren().Foreach(func(item interface{}) {
+		if widget, ok := item.(*gtk.Widget); ok {
+			widget.Destroy()
+		}
+	})
+
+	for i, step := range w.hybrid.Steps {
+		row, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 10)
+
+		repeat, _ := gtk.SpinButtonNewWithRange(1, 16, 1)
+		repeat.SetTooltipText("Iterations to repeat the formula for")
+		repeat.SetValue(float64(step.Repeat))
+		repeat.Connect("value-changed", func(b *gtk.SpinButton) {
+			w.hybrid.Steps[i].Repeat = b.GetValueAsInt()
+			w.apply()
+		})
+
+		formula, _ := gtk.ComboBoxTextNew()
+		for _, f := range programs.HybridFormulas {
+			formula.AppendText(f.Name)
+		}
+		formula.SetActive(slices.IndexFunc(programs.HybridFormulas, func(f programs.HybridFormula) bool {
+			return f.Name == step.Formula
+		}))
+		formula.SetHExpand(true)
+		formula.Connect("changed", func(c *gtk.ComboBoxText) {
+			w.hybrid.Steps[i].Formula = c.GetActiveText()
+			w.apply()
+		})
+
+		up, _ := gtk.ButtonNewWithLabel("Up")
+		up.SetSensitive(i > 0)
+		up.Connect("clicked", func() {
+			w.hybrid.Steps[i-1], w.hybrid.Steps[i] = w.hybrid.Steps[i], w.hybrid.Steps[i-1]
+			// rebuilding destroys the button while its signal is being handled
+			glib.IdleAdd(w.refresh)
+			w.apply()
+		})
+
+		remove, _ := gtk.ButtonNewWithLabel("Remove")
+		remove.SetSensitive(len(w.hybrid.Steps) > 1)
+		remove.Connect("clicked", func() {
+			w.hybrid.Steps = slices.Delete(w.hybrid.Steps, i, i+1)
+			glib.IdleAdd(w.refresh)
+			w.apply()
+		})
+
+		row.Add(repeat)
+		row.Add(formula)
+		row.Add(up)
+		row.Add(remove)
+		w.list.Insert(row, -1)
+	}
+	w.list.ShowAll()
+}
+
+// apply builds the hybrid and makes it the config window's program.
+func (w *HybridWindow) apply() {
+	program, err := w.hybrid.Program()
+	if err != nil {
+		w.status.SetText(err.Error())
+		return
+	}
+	w.status.SetText(program.Name)
+	w.config.selectProgram(program)
+}
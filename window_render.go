@@ -13,6 +13,7 @@ import (
 	"net"
 	"reflect"
 	"runtime"
+	"slices"
 	"strings"
 	"unsafe"
 
@@ -33,8 +34,9 @@ func NewRenderWindow(
 ) *RenderWindow {
 	var err error
 	w := &RenderWindow{
-		ctx:  ctx,
-		quit: quit,
+		ctx:          ctx,
+		quit:         quit,
+		draggingRoot: -1,
 	}
 
 	go w.handleSend(conn)
@@ -65,12 +67,15 @@ func NewRenderWindow(
 	w.gla.SetEvents(
 		int(gdk.BUTTON_PRESS_MASK) |
 			int(gdk.BUTTON_RELEASE_MASK) |
-			int(gdk.SCROLL_MASK),
+			int(gdk.SCROLL_MASK) |
+			int(gdk.KEY_PRESS_MASK),
 	)
+	w.gla.SetCanFocus(true)
 	w.gla.Connect("resize", w.resize)
 	w.gla.Connect("scroll-event", w.scroll)
 	w.gla.Connect("button-press-event", w.button)
 	w.gla.Connect("button-release-event", w.button)
+	w.gla.Connect("key-press-event", w.keyPress)
 
 	w.Add(w.gla)
 	w.ShowAll()
@@ -85,6 +90,8 @@ type RenderWindow struct {
 	gla           *gtk.GLArea
 	clickingMouse *gdk.Device
 	clickPos      mgl32.Vec2
+	draggingRoot  int // index of the polynomial root being dragged instead of the view, or -1
+	cameraMode    CameraMode
 	width         int
 	height        int
 
@@ -97,6 +104,35 @@ type RenderWindow struct {
 	vertexAttrib     uint32
 	uniformLocations map[string]int32
 
+	// program used by the last FrameRequest, kept to avoid recompiling it every frame
+	frameProgram          uint32
+	frameProgramName      string
+	frameUniformLocations map[string]int32
+
+	// colour pallet texture, and the pallet last loaded into it
+	palletTexture uint32
+	pallet        programs.ColourPallet
+
+	// pallet cycling, advanced by a tick callback on the frame clock
+	palletCycle int
+	palletSpeed float64
+	palletPhase float64
+	palletTime  int64
+
+	// histogram of the density program being shown, counted in the background and tone mapped into a texture
+	densityProgram programs.Program
+	density        *programs.Histogram
+	densityCancel  context.CancelFunc
+	densityTexture uint32
+	densityShown   uint64 // orbits counted when the texture was last tone mapped
+	densityStale   bool   // set when the texture needs colouring again
+
+	// the histogram tone mapped off the main thread into densityPixels, which are loaded into the texture when ready
+	densityImage   *programs.HistogramImage
+	densityPixels  []float32
+	densityMapping bool
+	densityReady   bool
+
 	uniforms    programs.Uniforms
 	sendMessage chan interface{}
 }
@@ -190,6 +226,19 @@ func (w *RenderWindow) glaRealize(gla *gtk.GLArea) {
 	gl.BindBuffer(gl.ARRAY_BUFFER, w.vbo)
 	gl.BufferData(gl.ARRAY_BUFFER, len(verticies)*4, gl.Ptr(verticies), gl.STATIC_DRAW)
 
+	gl.GenTextures(1, &w.palletTexture)
+	gl.ActiveTexture(gl.TEXTURE0 + palletTextureUnit)
+	gl.BindTexture(gl.TEXTURE_1D, w.palletTexture)
+	gl.TexParameteri(gl.TEXTURE_1D, gl.TEXTURE_WRAP_S, gl.REPEAT)
+
+	gl.GenTextures(1, &w.densityTexture)
+	gl.ActiveTexture(gl.TEXTURE0 + densityTextureUnit)
+	gl.BindTexture(gl.TEXTURE_2D, w.densityTexture)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+
 	w.uniforms.DefaultValues()
 	w.resize(w.gla, w.width, w.height)
 
@@ -202,8 +251,15 @@ func (w *RenderWindow) glaRealize(gla *gtk.GLArea) {
 func (w *RenderWindow) glaRender(gla *gtk.GLArea) {
 	if w.clickingMouse != nil {
 		pos := w.getMousePos()
-		d := pos.Sub(w.clickPos)
-		w.uniforms.Pos = w.uniforms.Pos.Add(mgl64.Vec2{float64(d.X()), -float64(d.Y())}.Mul(w.uniforms.Zoom * 2))
+		d := mgl64.Vec2{float64(pos.X() - w.clickPos.X()), -float64(pos.Y() - w.clickPos.Y())}
+		switch {
+		case w.is3D():
+			w.turnCamera(d.Mul(cameraDragDegrees))
+		case w.draggingRoot >= 0:
+			w.uniforms.Roots[w.draggingRoot] = w.uniforms.Roots[w.draggingRoot].Add(d.Mul(w.uniforms.Zoom * 2))
+		default:
+			w.uniforms.Pos = w.uniforms.Pos.Add(d.Mul(w.uniforms.Zoom * 2))
+		}
 		w.clickPos = pos
 		gla.QueueDraw()
 		w.sendMessage <- w.uniforms
@@ -211,7 +267,11 @@ func (w *RenderWindow) glaRender(gla *gtk.GLArea) {
 
 	gl.Clear(gl.COLOR_BUFFER_BIT)
 	gl.UseProgram(w.program)
-	w.loadUniforms()
+	w.loadPallet(&w.uniforms)
+	loadUniforms(&w.uniforms, w.uniformLocations)
+	if w.densityProgram.Density != nil {
+		w.loadDensity()
+	}
 	gl.BindVertexArray(w.vao)
 	gl.DrawArrays(gl.TRIANGLES, 0, 3)
 }
@@ -220,14 +280,16 @@ func (w *RenderWindow) glaUnrealize(gla *gtk.GLArea) {}
 
 func (w *RenderWindow) resize(gla *gtk.GLArea, width, height int) {
 	w.width, w.height = width, height
+	w.uniforms.Camera = cameraMatrix(w.width, w.height)
+	gl.Viewport(0, 0, int32(w.width), int32(w.height))
+}
 
-	if w.height > w.width {
-		w.uniforms.Camera = mgl32.Scale3D(float32(w.height)/float32(w.width), 1, 1)
-	} else {
-		w.uniforms.Camera = mgl32.Scale3D(1, float32(w.width)/float32(w.height), 1)
+// cameraMatrix returns the camera that fits the fractal to a view of the given size.
+func cameraMatrix(width, height int) mgl32.Mat4 {
+	if height > width {
+		return mgl32.Scale3D(float32(height)/float32(width), 1, 1)
 	}
-
-	gl.Viewport(0, 0, int32(w.width), int32(w.height))
+	return mgl32.Scale3D(1, float32(width)/float32(height), 1)
 }
 
 func (w *RenderWindow) getMousePos() mgl32.Vec2 {
@@ -255,17 +317,54 @@ func (w *RenderWindow) button(gla *gtk.GLArea, event *gdk.Event) {
 		obj := &glib.Object{glib.ToGObject(unsafe.Pointer(C_GdkDevice))}
 		w.clickingMouse = &gdk.Device{obj}
 		w.clickPos = w.getMousePos()
+		w.draggingRoot = w.rootAt(button.X(), button.Y())
+		gla.GrabFocus() // for the camera keys
 
 	} else if button.Type() == gdk.EVENT_BUTTON_RELEASE {
 		w.clickingMouse = nil
+		w.draggingRoot = -1
 		w.sendMessage <- w.uniforms
 	}
 }
 
+// rootDragDistance is how close in pixels a click must be to a polynomial root to drag it.
+const rootDragDistance = 8
+
+// rootAt returns the index of the polynomial root at x, y in the window,
+// or -1 if there isn't one or the program doesn't use roots.
+func (w *RenderWindow) rootAt(x, y float64) int {
+	if loc, ok := w.uniformLocations["roots"]; !ok || loc < 0 {
+		return -1
+	}
+
+	// the same as the camera; the longer side spans -1 to 1
+	width, height := float64(w.gla.GetAllocatedWidth()), float64(w.gla.GetAllocatedHeight())
+	size := max(width, height)
+	point := mgl64.Vec2{(2*x - width) / size, (height - 2*y) / size}.Mul(w.uniforms.Zoom).Sub(w.uniforms.Pos)
+
+	closest, distance := -1, rootDragDistance*2/size*w.uniforms.Zoom
+	for i := 0; i < int(min(max(w.uniforms.RootCount, 1), programs.MaxRoots)); i++ {
+		if d := w.uniforms.Roots[i].Sub(point).Len(); d < distance {
+			closest, distance = i, d
+		}
+	}
+	return closest
+}
+
 func (w *RenderWindow) scroll(gla *gtk.GLArea, event *gdk.Event) {
 	scroll := gdk.EventScrollNewFromEvent(event)
 	gla.QueueRender()
 
+	if w.is3D() {
+		switch scroll.Direction() {
+		case gdk.SCROLL_UP:
+			w.moveCamera(mgl64.Vec3{0, 0, 1})
+		case gdk.SCROLL_DOWN:
+			w.moveCamera(mgl64.Vec3{0, 0, -1})
+		}
+		return
+	}
+
 	if scroll.Direction() == gdk.SCROLL_DOWN {
 		w.uniforms.Zoom += (w.uniforms.Zoom * .1)
 	} else if scroll.Direction() == gdk.SCROLL_UP {
@@ -282,6 +381,80 @@ func (w *RenderWindow) scroll(gla *gtk.GLArea, event *gdk.Event) {
 	w.sendMessage <- w.uniforms
 }
 
+// CameraMode is how dragging the render window turns the camera of 3D programs.
+type CameraMode int
+
+const (
+	CameraOrbit CameraMode = iota // around the point ahead, as far away as the origin
+	CameraFly                     // in place, looking around
+)
+
+var cameraModeNames = []string{"Orbit", "Fly"}
+
+func (m CameraMode) String() string { return cameraModeNames[m] }
+
+// CameraControl sets how the render window moves the camera of 3D programs.
+type CameraControl struct {
+	Mode CameraMode
+}
+
+const (
+	cameraDragDegrees = 180  // turned dragging across the longer side of the window
+	cameraStep        = .05  // moved each key press or scroll, as a fraction of the distance to the origin
+	minCameraStep     = 1e-4 // so the camera can still leave the origin
+)
+
+// cameraKeys move the camera right, up and forward, like Move.
+var cameraKeys = map[uint]mgl64.Vec3{
+	gdk.KEY_w: {0, 0, 1},
+	gdk.KEY_s: {0, 0, -1},
+	gdk.KEY_a: {-1, 0, 0},
+	gdk.KEY_d: {1, 0, 0},
+	gdk.KEY_e: {0, 1, 0},
+	gdk.KEY_q: {0, -1, 0},
+}
+
+// is3D returns true if the program is seen through the 3D camera instead of panned and zoomed.
+func (w *RenderWindow) is3D() bool {
+	loc, ok := w.uniformLocations["camera_position"]
+	return ok && loc >= 0
+}
+
+// turnCamera turns the 3D camera by d, its yaw and pitch in degrees.
+func (w *RenderWindow) turnCamera(d mgl64.Vec2) {
+	camera := w.uniforms.Camera3D()
+	if w.cameraMode == CameraOrbit {
+		camera = camera.Orbit(camera.Position.Len(), d[0], d[1])
+	} else {
+		camera = camera.Turn(d[0], d[1])
+	}
+	w.uniforms.SetCamera3D(camera)
+}
+
+// moveCamera moves the 3D camera a step along d, which is right, up and forward,
+// slowing down as it gets closer to the fractal.
+func (w *RenderWindow) moveCamera(d mgl64.Vec3) {
+	camera := w.uniforms.Camera3D()
+	step := max(camera.Position.Len()*cameraStep, minCameraStep)
+	w.uniforms.SetCamera3D(camera.Move(d.Mul(step)))
+	w.gla.QueueRender()
+	w.sendMessage <- w.uniforms
+}
+
+func (w *RenderWindow) keyPress(gla *gtk.GLArea, event *gdk.Event) bool {
+	if !w.is3D() {
+		return false
+	}
+
+	key := gdk.EventKeyNewFromEvent(event)
+	d, ok := cameraKeys[gdk.KeyvalToLower(key.KeyVal())]
+	if !ok {
+		return false
+	}
+	w.moveCamera(d)
+	return true
+}
+
 func (w *RenderWindow) handleSend(conn net.Conn) {
 	enc := gob.NewEncoder(conn)
 	w.sendMessage = make(chan interface{})
@@ -328,28 +501,317 @@ func (w *RenderWindow) handleReceive(conn net.Conn) {
 
 		case *programs.Uniforms:
 			glib.IdleAdd(func() {
+				offset := w.uniforms.PalletOffset
 				w.uniforms = *msg
+				if w.palletCycle != 0 {
+					w.uniforms.PalletOffset = offset
+				}
+				w.densityStale = true
 				w.resize(w.gla, w.width, w.height)
 				w.gla.QueueDraw()
 			})
+
+		case *PalletCycle:
+			glib.IdleAdd(func() {
+				w.cyclePallet(*msg)
+			})
+
+		case *CameraControl:
+			glib.IdleAdd(func() {
+				w.cameraMode = msg.Mode
+			})
+
+		case *FrameRequest:
+			glib.IdleAdd(func() {
+				w.sendMessage <- w.renderFrame(*msg)
+			})
+
 		default:
 			log.Println("unknown message received", reflect.TypeOf(v))
 		}
 	}
 }
 
-func (w *RenderWindow) loadUniforms() {
-	v := reflect.ValueOf(&w.uniforms).Elem()
+// PalletCycle starts, changes or stops cycling the pallet in the render window.
+// The offset is advanced on the window's frame clock, so uniforms aren't sent every frame.
+//
+// When cycling stops the render window sends one back with the offset it stopped at.
+type PalletCycle struct {
+	Speed  float64 // colours per second, zero to stop
+	Offset uint32  // where to start, ignored if already cycling
+}
+
+func (w *RenderWindow) cyclePallet(cycle PalletCycle) {
+	if cycle.Speed == 0 {
+		if w.palletCycle != 0 {
+			w.gla.RemoveTickCallback(w.palletCycle)
+			w.palletCycle = 0
+			w.sendMessage <- PalletCycle{Offset: w.uniforms.PalletOffset}
+		}
+		return
+	}
+
+	w.palletSpeed = cycle.Speed
+	if w.palletCycle != 0 {
+		return
+	}
+
+	colours := float64(len(w.uniforms.ColourPallet))
+	w.palletPhase = math.Mod(float64(cycle.Offset), colours)
+	w.palletTime = 0
+	w.palletCycle = w.gla.AddTickCallback(func(_ *gtk.Widget, clock *gdk.FrameClock) bool {
+		now := clock.GetFrameTime()
+		if w.palletTime != 0 {
+			w.palletPhase += w.palletSpeed * float64(now-w.palletTime) / 1e6
+			w.palletPhase -= math.Floor(w.palletPhase/colours) * colours
+		}
+		w.palletTime = now
+
+		w.uniforms.PalletOffset = uint32(w.palletPhase)
+		w.densityStale = true
+		w.gla.QueueRender()
+		return true
+	})
+}
+
+// FrameRequest asks the render window to draw a frame offscreen and send back its pixels as a Frame.
+type FrameRequest struct {
+	ID            int
+	Width, Height int
+	Program       programs.Program
+	Uniforms      programs.Uniforms
+}
+
+// Frame is a frame drawn for a FrameRequest, as NRGBA pixels with the top row first.
+type Frame struct {
+	ID            int
+	Width, Height int
+	Pix           []byte
+	Err           string
+}
+
+// renderFrame draws req into an offscreen framebuffer and reads it back.
+// The window's own view is left as it was.
+func (w *RenderWindow) renderFrame(req FrameRequest) Frame {
+	frame := Frame{
+		ID:     req.ID,
+		Width:  req.Width,
+		Height: req.Height,
+	}
+
+	if req.Program.Density != nil {
+		frame.Err = fmt.Sprintf("%v counts orbits on the CPU, so its frames can only be rendered natively", req.Program.Name)
+		return frame
+	}
+
+	w.gla.MakeCurrent()
+
+	var maxSize int32
+	gl.GetIntegerv(gl.MAX_RENDERBUFFER_SIZE, &maxSize)
+	if req.Width <= 0 || req.Height <= 0 || req.Width > int(maxSize) || req.Height > int(maxSize) {
+		frame.Err = fmt.Sprintf("can't render %vx%v frames on the GPU, the largest supported size is %vx%v", req.Width, req.Height, maxSize, maxSize)
+		return frame
+	}
+
+	if req.Program.Name != w.frameProgramName {
+		program, locations, err := linkProgram(req.Program)
+		if err != nil {
+			frame.Err = err.Error()
+			return frame
+		}
+		gl.DeleteProgram(w.frameProgram)
+		w.frameProgram, w.frameUniformLocations, w.frameProgramName = program, locations, req.Program.Name
+	}
+
+	var fbo, rbo uint32
+	gl.GenFramebuffers(1, &fbo)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, fbo)
+	defer gl.DeleteFramebuffers(1, &fbo)
+
+	gl.GenRenderbuffers(1, &rbo)
+	gl.BindRenderbuffer(gl.RENDERBUFFER, rbo)
+	defer gl.DeleteRenderbuffers(1, &rbo)
+
+	gl.RenderbufferStorage(gl.RENDERBUFFER, gl.RGBA8, int32(req.Width), int32(req.Height))
+	gl.FramebufferRenderbuffer(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.RENDERBUFFER, rbo)
+
+	// GtkGLArea binds its own framebuffer before each render, so only the viewport needs restoring
+	defer gl.Viewport(0, 0, int32(w.width), int32(w.height))
+	defer gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+
+	if status := gl.CheckFramebufferStatus(gl.FRAMEBUFFER); status != gl.FRAMEBUFFER_COMPLETE {
+		frame.Err = fmt.Sprintf("incomplete framebuffer: 0x%x", status)
+		return frame
+	}
+
+	uniforms := req.Uniforms
+	uniforms.Camera = cameraMatrix(req.Width, req.Height)
+
+	gl.Viewport(0, 0, int32(req.Width), int32(req.Height))
+	gl.Clear(gl.COLOR_BUFFER_BIT)
+	gl.UseProgram(w.frameProgram)
+	w.loadPallet(&uniforms)
+	loadUniforms(&uniforms, w.frameUniformLocations)
+	gl.BindVertexArray(w.vao)
+	gl.DrawArrays(gl.TRIANGLES, 0, 3)
+
+	stride := req.Width * 4
+	pix := make([]byte, stride*req.Height)
+	gl.PixelStorei(gl.PACK_ALIGNMENT, 1)
+	gl.ReadPixels(0, 0, int32(req.Width), int32(req.Height), gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(pix))
+
+	// GL reads bottom up, and shaders only write RGB
+	frame.Pix = make([]byte, len(pix))
+	for y := 0; y < req.Height; y++ {
+		row := frame.Pix[y*stride : (y+1)*stride]
+		copy(row, pix[(req.Height-1-y)*stride:])
+		for x := 3; x < stride; x += 4 {
+			row[x] = 0xff
+		}
+	}
+
+	gl.UseProgram(w.program)
+	return frame
+}
+
+// palletTextureUnit is the texture unit the colour pallet is bound to.
+const palletTextureUnit = 0
+
+// loadPallet loads the colour pallet of uniforms into the pallet texture if it isn't the one already there,
+// and sets how the texture is filtered.
+func (w *RenderWindow) loadPallet(uniforms *programs.Uniforms) {
+	gl.ActiveTexture(gl.TEXTURE0 + palletTextureUnit)
+	gl.BindTexture(gl.TEXTURE_1D, w.palletTexture)
+
+	filter := int32(gl.NEAREST)
+	if uniforms.PalletLinear {
+		filter = gl.LINEAR
+	}
+	gl.TexParameteri(gl.TEXTURE_1D, gl.TEXTURE_MIN_FILTER, filter)
+	gl.TexParameteri(gl.TEXTURE_1D, gl.TEXTURE_MAG_FILTER, filter)
+
+	if len(uniforms.ColourPallet) == 0 || slices.Equal(uniforms.ColourPallet, w.pallet) {
+		return
+	}
+
+	w.pallet = slices.Clone(uniforms.ColourPallet)
+	gl.PixelStorei(gl.UNPACK_ALIGNMENT, 1)
+	gl.TexImage1D(gl.TEXTURE_1D, 0, gl.RGB32F, int32(len(w.pallet)), 0, gl.RGB, gl.FLOAT, gl.Ptr(w.pallet))
+}
+
+// densityTextureUnit is the texture unit the histogram of density programs is bound to.
+const densityTextureUnit = 1
+
+// densityFrameTime is how often in milliseconds the histogram of density programs is shown again as orbits are counted.
+const densityFrameTime = 250
+
+// loadDensity starts counting the orbits of the density program again if the view has changed,
+// and tone maps those counted so far into the density texture.
+func (w *RenderWindow) loadDensity() {
+	if w.density == nil || !w.density.Shows(&w.uniforms, w.width, w.height) {
+		w.stopDensity()
+
+		h, err := w.densityProgram.GetHistogram(w.uniforms, w.width, w.height)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		ctx, cancel := context.WithCancel(w.ctx)
+		w.density, w.densityCancel, w.densityShown = h, cancel, 0
+		go h.Accumulate(ctx, renderThreads())
+
+		glib.TimeoutAdd(densityFrameTime, func() bool {
+			w.gla.QueueRender()
+			return ctx.Err() == nil && h.Samples() < h.Target()
+		})
+	}
+
+	gl.ActiveTexture(gl.TEXTURE0 + densityTextureUnit)
+	gl.BindTexture(gl.TEXTURE_2D, w.densityTexture)
+	gl.Uniform1i(gl.GetUniformLocation(w.program, gl.Str("density\x00")), densityTextureUnit)
+
+	// the last view is left in the texture until orbits of the new one are counted
+	bounds := w.density.Bounds()
+	if w.densityReady {
+		w.densityReady = false
+		gl.PixelStorei(gl.UNPACK_ALIGNMENT, 1)
+		gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGB32F, int32(bounds.Dx()), int32(bounds.Dy()), 0, gl.RGB, gl.FLOAT, gl.Ptr(w.densityPixels))
+	}
+
+	samples := w.density.Samples()
+	if w.densityMapping || (samples == w.densityShown && !w.densityStale) {
+		return
+	}
+	rescan := samples != w.densityShown
+	w.densityShown, w.densityStale = samples, false
+
+	if size := bounds.Dx() * bounds.Dy() * 3; len(w.densityPixels) != size {
+		w.densityPixels = make([]float32, size)
+	}
+	h, img, pix, uniforms := w.density, w.densityImage, w.densityPixels, w.uniforms
+	w.densityMapping = true
+
+	go func() {
+		if img == nil {
+			img = h.Image(&uniforms)
+		} else {
+			if rescan {
+				img.Update()
+			}
+			img.Recolour(&uniforms)
+		}
+
+		bounds := img.Bounds()
+		scaleFactor := pixelScale(bounds)
+		i := 0
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				c := img.GetPixel(pixelPos(scaleFactor, x, y))
+				i += copy(pix[i:], c[:])
+			}
+		}
+
+		glib.IdleAdd(func() {
+			w.densityMapping = false
+			// the view may have changed while it was tone mapped
+			if h == w.density && len(pix) == len(w.densityPixels) {
+				w.densityImage, w.densityReady = img, true
+			}
+			w.gla.QueueRender()
+		})
+	}()
+}
+
+// stopDensity stops counting the orbits of the density program.
+func (w *RenderWindow) stopDensity() {
+	if w.densityCancel != nil {
+		w.densityCancel()
+	}
+	w.density, w.densityCancel, w.densityImage, w.densityReady = nil, nil, nil, false
+}
+
+func loadUniforms(uniforms *programs.Uniforms, locations map[string]int32) {
+	v := reflect.ValueOf(uniforms).Elem()
 	for i := 0; i < v.NumField(); i++ {
 		f := v.Field(i)
 
+		name := v.Type().Field(i).Tag.Get("uniform")
+		if name == "-" {
+			continue
+		}
+
 		ptr := f.Addr().UnsafePointer()
-		loc := w.uniformLocations[v.Type().Field(i).Tag.Get("uniform")]
+		loc := locations[name]
 
 		count := int32(1)
 
 	SwitchElem:
 		switch f.Type() {
+		// Textures, loaded separately
+		case reflect.TypeOf(programs.ColourPallet{}):
+			gl.Uniform1i(loc, palletTextureUnit)
+			continue
+
 		// Natural Array types
 		case reflect.TypeOf(mgl32.Vec2{}):
 			gl.Uniform2fv(loc, count, (*float32)(ptr))
@@ -381,7 +843,7 @@ func (w *RenderWindow) loadUniforms() {
 		case reflect.TypeOf(int32(0)):
 			gl.Uniform1iv(loc, count, (*int32)(ptr))
 			continue
-		case reflect.TypeOf(uint32(0)):
+		case reflect.TypeOf(uint32(0)), reflect.TypeOf(programs.BailoutTest(0)):
 			gl.Uniform1uiv(loc, count, (*uint32)(ptr))
 			continue
 		case reflect.TypeOf(float32(0)):
@@ -403,50 +865,70 @@ func (w *RenderWindow) loadUniforms() {
 }
 
 func (w *RenderWindow) loadProgram(program programs.Program) error {
-	vertexShader, err := compileShader(program.VertexShader+"\x00", gl.VERTEX_SHADER)
+	var err error
+	w.program, w.uniformLocations, err = linkProgram(program)
 	if err != nil {
 		return err
 	}
+	gl.UseProgram(w.program)
 
-	fragmentShader, err := compileShader(program.FragmentShader+"\x00", gl.FRAGMENT_SHADER)
-	if err != nil {
-		return err
+	// density programs are shown by counting orbits here, so they need the program's CPU implementation
+	w.stopDensity()
+	w.densityProgram = programs.Program{}
+	if program.Density != nil {
+		w.densityProgram, _ = programs.ProgramByName(program.Name)
 	}
 
-	w.program = gl.CreateProgram()
-	gl.AttachShader(w.program, vertexShader)
-	gl.AttachShader(w.program, fragmentShader)
-	gl.LinkProgram(w.program)
-	gl.UseProgram(w.program)
+	w.vertexAttrib = uint32(gl.GetAttribLocation(w.program, gl.Str("vert\x00")))
+	gl.EnableVertexAttribArray(w.vertexAttrib)
+	gl.VertexAttribPointerWithOffset(w.vertexAttrib, 2, gl.FLOAT, false, 2*4, 0)
+
+	return nil
+}
 
+// linkProgram compiles and links program, returning it with the location of each uniform.
+func linkProgram(program programs.Program) (uint32, map[string]int32, error) {
+	vertexShader, err := compileShader(program.VertexShader+"\x00", gl.VERTEX_SHADER)
+	if err != nil {
+		return 0, nil, err
+	}
 	defer gl.DeleteShader(vertexShader)
+
+	fragmentShader, err := compileShader(program.FragmentShader+"\x00", gl.FRAGMENT_SHADER)
+	if err != nil {
+		return 0, nil, err
+	}
 	defer gl.DeleteShader(fragmentShader)
 
+	p := gl.CreateProgram()
+	gl.AttachShader(p, vertexShader)
+	gl.AttachShader(p, fragmentShader)
+	gl.LinkProgram(p)
+
 	var status int32
-	gl.GetProgramiv(w.program, gl.LINK_STATUS, &status)
+	gl.GetProgramiv(p, gl.LINK_STATUS, &status)
 	if status == gl.FALSE {
 		var l int32
-		gl.GetProgramiv(w.program, gl.INFO_LOG_LENGTH, &l)
+		gl.GetProgramiv(p, gl.INFO_LOG_LENGTH, &l)
 
 		log := strings.Repeat("\x00", int(l+1))
-		gl.GetProgramInfoLog(w.program, l, nil, gl.Str(log))
-		return fmt.Errorf("failed to link program: %v", log)
+		gl.GetProgramInfoLog(p, l, nil, gl.Str(log))
+		gl.DeleteProgram(p)
+		return 0, nil, fmt.Errorf("failed to link program: %v", log)
 	}
 
-	w.uniformLocations = make(map[string]int32)
-	t := reflect.TypeOf(w.uniforms)
+	locations := make(map[string]int32)
+	t := reflect.TypeOf(programs.Uniforms{})
 	for i := 0; i < t.NumField(); i++ {
 		name := strings.ToLower(t.Field(i).Tag.Get("uniform"))
-		w.uniformLocations[name] = gl.GetUniformLocation(w.program, gl.Str(name+"\x00"))
+		if name == "-" {
+			continue
+		}
+		locations[name] = gl.GetUniformLocation(p, gl.Str(name+"\x00"))
 	}
 
-	gl.BindFragDataLocation(w.program, 0, gl.Str("outputColor\x00"))
-
-	w.vertexAttrib = uint32(gl.GetAttribLocation(w.program, gl.Str("vert\x00")))
-	gl.EnableVertexAttribArray(w.vertexAttrib)
-	gl.VertexAttribPointerWithOffset(w.vertexAttrib, 2, gl.FLOAT, false, 2*4, 0)
-
-	return nil
+	gl.BindFragDataLocation(p, 0, gl.Str("outputColor\x00"))
+	return p, locations, nil
 }
 
 func compileShader(source string, shaderType uint32) (uint32, error) {